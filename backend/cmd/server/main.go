@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -15,9 +16,16 @@ import (
 	"github.com/marko/backend/internal/auth"
 	"github.com/marko/backend/internal/config"
 	"github.com/marko/backend/internal/db"
+	"github.com/marko/backend/internal/devices"
+	"github.com/marko/backend/internal/eventbus"
+	"github.com/marko/backend/internal/geo"
 	"github.com/marko/backend/internal/groups"
 	"github.com/marko/backend/internal/locations"
 	"github.com/marko/backend/internal/notifications"
+	"github.com/marko/backend/internal/outbox"
+	"github.com/marko/backend/internal/stream"
+	"github.com/marko/backend/internal/users"
+	"github.com/marko/backend/internal/watchlists"
 )
 
 func main() {
@@ -48,7 +56,99 @@ func main() {
 	defer database.Close()
 
 	// Initialize services
-	notificationService := notifications.NewService(cfg.ExpoPushToken)
+	geocoder, err := geo.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load country boundaries")
+	}
+
+	expoClient := notifications.NewExpoClient(cfg.ExpoAPIURL, cfg.ExpoPushToken)
+	pushProviders := []notifications.PushProvider{expoClient}
+	if cfg.FCMCredentialsFile != "" {
+		fcmClient, err := notifications.NewFCMClient(cfg.FCMAPIURL, cfg.FCMCredentialsFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create FCM client")
+		}
+		pushProviders = append(pushProviders, fcmClient)
+	}
+	if cfg.APNSKeyFile != "" {
+		apnsBaseURL := notifications.DefaultAPNsBaseURL
+		if cfg.APNSSandbox {
+			apnsBaseURL = notifications.APNsSandboxBaseURL
+		}
+		apnsClient, err := notifications.NewAPNsClient(notifications.APNsConfig{
+			BaseURL: apnsBaseURL,
+			KeyFile: cfg.APNSKeyFile,
+			KeyID:   cfg.APNSKeyID,
+			TeamID:  cfg.APNSTeamID,
+			Topic:   cfg.APNSTopic,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create APNs client")
+		}
+		pushProviders = append(pushProviders, apnsClient)
+	}
+
+	var mailer *notifications.SMTPClient
+	if cfg.SMTPHost != "" {
+		mailer, err = notifications.NewSMTPClient(notifications.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to create SMTP client")
+		}
+	}
+
+	// Start background workers. Each one is awaited on shutdown, before the
+	// database is closed.
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var workers sync.WaitGroup
+	startWorker := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workerCtx)
+		}()
+	}
+
+	// Real-time events and cache invalidations travel over the event bus, so
+	// they reach every replica
+	var bus eventbus.Bus = eventbus.NewLocal()
+	if cfg.EventBus == "postgres" {
+		pgBus := eventbus.NewPostgres(database, cfg.DatabaseURL)
+		startWorker(pgBus.Run)
+		bus = pgBus
+	}
+	hub := stream.NewHub(bus)
+	invalidations := eventbus.NewInvalidations(bus)
+	notificationService := notifications.NewService(database, hub, mailer, pushProviders...)
+
+	outboxWorker := outbox.NewWorker(database, outbox.Config{
+		Workers:      cfg.OutboxWorkers,
+		PollInterval: cfg.OutboxPollInterval,
+		MaxAttempts:  cfg.OutboxMaxAttempts,
+		Retention:    cfg.OutboxRetention,
+	})
+	outboxWorker.Handle(db.EventLocationUpdated, locations.NewFanOut(database, cfg.LocationDebounceWindow).HandleLocationUpdated)
+	outboxWorker.Handle(db.EventNotificationCreated, notificationService.HandleNotificationCreated)
+	outboxWorker.Handle(db.EventNotificationDigest, notificationService.HandleNotificationDigest)
+	outboxWorker.Handle(db.EventNotificationEmail, notificationService.HandleNotificationEmail)
+	// Webhooks may point at local test servers during development
+	webhookSender := notifications.NewWebhookSender(database, cfg.Environment == "development")
+	outboxWorker.Handle(db.EventWebhookDelivery, webhookSender.HandleWebhookDelivery)
+
+	startWorker(outboxWorker.Run)
+
+	receiptWorker := notifications.NewReceiptWorker(database, expoClient, cfg.PushReceiptPollInterval, cfg.PushReceiptDelay)
+	startWorker(receiptWorker.Run)
+
+	digestWorker := notifications.NewDigestWorker(database, cfg.DigestInterval)
+	startWorker(digestWorker.Run)
 
 	// Create Gin router
 	router := gin.New()
@@ -69,23 +169,43 @@ func main() {
 	api := router.Group("/api/v1")
 	
 	// Auth middleware
-	authMiddleware := auth.AuthMiddleware(cfg.SupabaseJWTSecret)
+	verifierConfig := auth.VerifierConfig{
+		Secret:      cfg.SupabaseJWTSecret,
+		JWKSURL:     cfg.SupabaseJWKSURL,
+		Audience:    cfg.JWTAudience,
+		Issuer:      cfg.JWTIssuer,
+		Invalidator: invalidations,
+	}
+	verifierConfig.AllowTestToken = auth.TestTokenAllowed(cfg.Environment, verifierConfig)
+	verifier := auth.NewVerifier(verifierConfig)
+	provisioner := auth.NewProvisioner(database, 0, invalidations)
+	authMiddleware := auth.AuthMiddleware(verifier, provisioner)
 
 	// Initialize handlers
-	groupsHandler := groups.NewHandler(database)
-	locationsHandler := locations.NewHandler(database, notificationService)
+	groupsHandler := groups.NewHandler(database, cfg.InviteURLBase)
+	locationsHandler := locations.NewHandler(database, geocoder, cfg.LocationDebounceWindow, hub)
 	notificationsHandler := notifications.NewHandler(database)
+	devicesHandler := devices.NewHandler(database)
+	usersHandler := users.NewHandler(database)
+	watchlistsHandler := watchlists.NewHandler(database)
+	streamHandler := stream.NewHandler(hub, cfg.StreamHeartbeatInterval)
 
 	// Register routes
 	groupsHandler.RegisterRoutes(api, authMiddleware)
 	locationsHandler.RegisterRoutes(api, authMiddleware)
 	notificationsHandler.RegisterRoutes(api, authMiddleware)
+	devicesHandler.RegisterRoutes(api, authMiddleware)
+	usersHandler.RegisterRoutes(api, authMiddleware)
+	watchlistsHandler.RegisterRoutes(api, authMiddleware)
+	streamHandler.RegisterRoutes(api, authMiddleware)
 
 	// Create HTTP server
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
 		Handler: router,
 	}
+	// Open streams never finish on their own
+	srv.RegisterOnShutdown(hub.Close)
 
 	// Start server in a goroutine
 	go func() {
@@ -102,7 +222,9 @@ func main() {
 
 	log.Info().Msg("Shutting down server...")
 
-	// Give outstanding requests a deadline for completion
+	// Give outstanding requests a deadline for completion. The server goes
+	// first, since requests still enqueue outbox events and open streams
+	// still need the event bus.
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -111,6 +233,10 @@ func main() {
 		log.Error().Err(err).Msg("Server forced to shutdown")
 	}
 
+	// Stop background workers and let in-flight work finish
+	stopWorkers()
+	workers.Wait()
+
 	log.Info().Msg("Server exited")
 }
 
@@ -172,7 +298,7 @@ func corsMiddleware() gin.HandlerFunc {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
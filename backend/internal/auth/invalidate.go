@@ -0,0 +1,19 @@
+package auth
+
+import "context"
+
+// Names of the caches kept in sync across instances
+const (
+	JWKSCacheName      = "jwks"
+	ProvisionCacheName = "provisioned_users"
+)
+
+// Invalidator carries cache invalidations between instances, e.g. an
+// *eventbus.Invalidations
+type Invalidator interface {
+	// Register sets handler to be called when another instance invalidates
+	// an entry of the named cache; an empty key stands for the whole cache
+	Register(cache string, handler func(key string))
+	// Invalidate tells the other instances to drop key from the named cache
+	Invalidate(ctx context.Context, cache, key string)
+}
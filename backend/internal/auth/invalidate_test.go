@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/marko/backend/internal/eventbus"
+)
+
+func TestJWKSKeySetChangeInvalidatesOtherInstances(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two instances sharing a bus
+	bus := eventbus.NewLocal()
+	srv := newJWKSServer(t, ecJWK("old", &oldKey.PublicKey))
+	a := NewJWKSCache(srv.URL, time.Hour, eventbus.NewInvalidations(bus))
+	b := NewJWKSCache(srv.URL, time.Hour, eventbus.NewInvalidations(bus))
+	ctx := context.Background()
+
+	for _, cache := range []*JWKSCache{a, b} {
+		if _, err := cache.Key(ctx, "old"); err != nil {
+			t.Fatalf("Key(old) error = %v", err)
+		}
+	}
+
+	// The old key is revoked. Instance a learns about it from a token
+	// signed with the new key and tells b.
+	srv.setKeys(ecJWK("new", &newKey.PublicKey))
+	a.mu.Lock()
+	a.lastAttempt = time.Now().Add(-minJWKSRefetchInterval)
+	a.mu.Unlock()
+	if _, err := a.Key(ctx, "new"); err != nil {
+		t.Fatalf("Key(new) error = %v", err)
+	}
+	if _, err := b.Key(ctx, "old"); err == nil || !strings.Contains(err.Error(), "unknown key id") {
+		t.Fatalf("Key(old) on the other instance error = %v, want unknown key id", err)
+	}
+	if got := srv.requests.Load(); got != 4 {
+		t.Errorf("JWKS requests = %d, want 4", got)
+	}
+
+	// b's refetch was caused by the invalidation, so it isn't sent back
+	a.mu.RLock()
+	fetchedAt := a.fetchedAt
+	a.mu.RUnlock()
+	if fetchedAt.IsZero() {
+		t.Error("the instance that saw the new key set was invalidated by its own change")
+	}
+}
+
+func TestProvisionerForgetsInvalidatedUsers(t *testing.T) {
+	bus := eventbus.NewLocal()
+	other := eventbus.NewInvalidations(bus)
+	p := NewProvisioner(nil, time.Hour, eventbus.NewInvalidations(bus))
+
+	changed, unchanged := uuid.New(), uuid.New()
+	now := time.Now()
+	p.remember(changed, provisionedUser{syncedAt: now})
+	p.remember(unchanged, provisionedUser{syncedAt: now})
+
+	ctx := context.Background()
+	other.Invalidate(ctx, ProvisionCacheName, changed.String())
+	other.Invalidate(ctx, ProvisionCacheName, "not-a-uuid")
+	if _, ok := p.users[changed]; ok {
+		t.Error("invalidated user is still cached")
+	}
+	if _, ok := p.users[unchanged]; !ok {
+		t.Error("user that wasn't invalidated was dropped")
+	}
+
+	other.Invalidate(ctx, ProvisionCacheName, "")
+	if len(p.users) != 0 {
+		t.Errorf("cached %d users after invalidating the whole cache, want 0", len(p.users))
+	}
+}
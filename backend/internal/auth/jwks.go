@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultJWKSRefreshInterval is how long fetched keys are trusted before a refetch
+	defaultJWKSRefreshInterval = 15 * time.Minute
+	// minJWKSRefetchInterval limits refetches triggered by unknown key IDs
+	minJWKSRefetchInterval = 30 * time.Second
+)
+
+// jwk represents a single JSON Web Key as served by a JWKS endpoint
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwkSet represents the document served by a JWKS endpoint
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// JWKSCache fetches and caches public keys from a JWKS endpoint.
+// Keys are refreshed periodically and on demand when an unknown key ID is
+// seen, so signing key rotation is picked up without a restart. When a
+// refresh finds a different key set, the other instances are told to
+// refetch too, so a revoked key stops working everywhere at once.
+type JWKSCache struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+	invalidator     Invalidator
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	// invalidated is set when another instance reported a new key set, so
+	// the resulting refetch isn't reported back
+	invalidated bool
+}
+
+// NewJWKSCache creates a new JWKS cache for the given endpoint. A nil
+// invalidator keeps the cache local to this instance.
+func NewJWKSCache(url string, refreshInterval time.Duration, invalidator Invalidator) *JWKSCache {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultJWKSRefreshInterval
+	}
+	c := &JWKSCache{
+		url:             url,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		refreshInterval: refreshInterval,
+		invalidator:     invalidator,
+		keys:            make(map[string]crypto.PublicKey),
+	}
+	if invalidator != nil {
+		invalidator.Register(JWKSCacheName, func(string) { c.invalidate() })
+	}
+	return c
+}
+
+// invalidate makes the next lookup refetch the key set
+func (c *JWKSCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fetchedAt = time.Time{}
+	c.invalidated = true
+}
+
+// Key returns the public key for the given key ID, fetching the key set if
+// the cache is stale or the key ID is unknown
+func (c *JWKSCache) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	fresh := time.Since(c.fetchedAt) < c.refreshInterval
+	c.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	changed, err := c.refresh(ctx, !ok)
+	if err != nil {
+		// Keep serving a known key if the endpoint is temporarily unavailable
+		if ok {
+			log.Warn().Err(err).Msg("Failed to refresh JWKS, using cached key")
+			return key, nil
+		}
+		return nil, err
+	}
+	if changed && c.invalidator != nil {
+		c.invalidator.Invalidate(ctx, JWKSCacheName, "")
+	}
+
+	c.mu.RLock()
+	key, ok = c.keys[kid]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// refresh refetches the key set and reports whether other instances should
+// refetch too: the set changed, and not because another instance said so.
+// Refetches caused by an unknown key ID are rate limited so that tokens with
+// bogus key IDs cannot hammer the endpoint.
+func (c *JWKSCache) refresh(ctx context.Context, unknownKid bool) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another goroutine may have refreshed while we were waiting for the lock
+	if time.Since(c.fetchedAt) < c.refreshInterval && !unknownKid {
+		return false, nil
+	}
+	if unknownKid && time.Since(c.lastAttempt) < minJWKSRefetchInterval {
+		return false, nil
+	}
+	c.lastAttempt = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("JWKS request failed with status %d", resp.StatusCode)
+	}
+
+	var set jwkSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return false, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Warn().Err(err).Str("kid", k.Kid).Msg("Skipping unsupported JWK")
+			continue
+		}
+		keys[k.Kid] = key
+	}
+
+	// The first fetch has nothing to compare against
+	changed := len(c.keys) > 0 && !c.invalidated && !sameKeyIDs(c.keys, keys)
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.invalidated = false
+	log.Debug().Int("keys", len(keys)).Msg("JWKS refreshed")
+	return changed, nil
+}
+
+// sameKeyIDs reports whether two key sets hold the same key IDs
+func sameKeyIDs(a, b map[string]crypto.PublicKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for kid := range a {
+		if _, ok := b[kid]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// publicKey converts the JWK into an RSA or ECDSA public key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("EC point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url-encoded big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// testTokenUserID is the fixed user returned for "test-token" in development mode
+var testTokenUserID = uuid.MustParse("12345678-1234-1234-1234-123456789012")
+
+// VerifierConfig holds the settings used to verify Supabase JWTs
+type VerifierConfig struct {
+	// Secret is the Supabase JWT secret used for HS256 tokens
+	Secret string
+	// JWKSURL is an optional JWKS endpoint used for RS256/ES256 tokens
+	JWKSURL string
+	// JWKSRefreshInterval controls how long fetched keys are cached
+	JWKSRefreshInterval time.Duration
+	// Audience is the expected "aud" claim (skipped when empty)
+	Audience string
+	// Issuer is the expected "iss" claim (skipped when empty)
+	Issuer string
+	// AllowTestToken accepts the literal "test-token" for local development
+	AllowTestToken bool
+	// Invalidator tells other instances when the JWKS key set changes
+	// (optional)
+	Invalidator Invalidator
+}
+
+// Verifier verifies Supabase JWTs and maps their claims to a User
+type Verifier struct {
+	secret         []byte
+	jwks           *JWKSCache
+	allowTestToken bool
+	parser         *jwt.Parser
+}
+
+// Claims represents the Supabase JWT claims we care about
+type Claims struct {
+	Email        string         `json:"email"`
+	Role         string         `json:"role"`
+	UserMetadata map[string]any `json:"user_metadata"`
+	jwt.RegisteredClaims
+}
+
+// TestTokenAllowed reports whether the literal "test-token" may be accepted:
+// only in development, and only when no real verification key is configured
+func TestTokenAllowed(environment string, cfg VerifierConfig) bool {
+	return environment == "development" && cfg.Secret == "" && cfg.JWKSURL == ""
+}
+
+// NewVerifier creates a new JWT verifier
+func NewVerifier(cfg VerifierConfig) *Verifier {
+	var methods []string
+	if cfg.Secret != "" {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	var jwks *JWKSCache
+	if cfg.JWKSURL != "" {
+		jwks = NewJWKSCache(cfg.JWKSURL, cfg.JWKSRefreshInterval, cfg.Invalidator)
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+
+	return &Verifier{
+		secret:         []byte(cfg.Secret),
+		jwks:           jwks,
+		allowTestToken: cfg.AllowTestToken,
+		parser:         jwt.NewParser(opts...),
+	}
+}
+
+// Verify validates the token signature and standard claims and returns the
+// authenticated user
+func (v *Verifier) Verify(ctx context.Context, tokenString string) (*User, error) {
+	if tokenString == "" {
+		return nil, fmt.Errorf("empty token")
+	}
+
+	if v.allowTestToken && tokenString == "test-token" {
+		return &User{
+			ID:    testTokenUserID,
+			Email: "test@example.com",
+			Name:  "Test User",
+		}, nil
+	}
+
+	if len(v.secret) == 0 && v.jwks == nil {
+		return nil, fmt.Errorf("no JWT verification key configured")
+	}
+
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		return v.keyFor(ctx, token)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify token: %w", err)
+	}
+
+	return claims.user()
+}
+
+// keyFor returns the verification key for the token's signing method
+func (v *Verifier) keyFor(ctx context.Context, token *jwt.Token) (any, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(v.secret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return v.secret, nil
+
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		if v.jwks == nil {
+			return nil, errors.New("asymmetric tokens are not accepted")
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token is missing key id")
+		}
+		return v.jwks.Key(ctx, kid)
+
+	default:
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+}
+
+// user maps verified claims to a User
+func (c *Claims) user() (*User, error) {
+	id, err := uuid.Parse(c.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject claim: %w", err)
+	}
+
+	name, _ := c.UserMetadata["name"].(string)
+	if name == "" {
+		name, _ = c.UserMetadata["full_name"].(string)
+	}
+
+	user := &User{
+		ID:    id,
+		Email: c.Email,
+		Name:  name,
+	}
+	user.Name = displayName(user)
+	return user, nil
+}
@@ -0,0 +1,381 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	testSecret   = "super-secret-jwt-token-with-at-least-32-characters"
+	testAudience = "authenticated"
+	testIssuer   = "https://example.supabase.co/auth/v1"
+)
+
+var testUserID = uuid.MustParse("0b8f6e36-7f0e-4c1a-9d4b-2f4c1f3a5e6d")
+
+// jwksServer serves a mutable key set and counts requests
+type jwksServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	keys     []jwk
+	requests atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...jwk) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(jwkSet{Keys: s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) setKeys(keys ...jwk) {
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jwk {
+	return jwk{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) jwk {
+	return jwk{
+		Kty: "EC",
+		Kid: kid,
+		Use: "sig",
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"sub":           testUserID.String(),
+		"email":         "ana@example.com",
+		"aud":           testAudience,
+		"iss":           testIssuer,
+		"iat":           now.Unix(),
+		"exp":           now.Add(time.Hour).Unix(),
+		"user_metadata": map[string]any{"full_name": "Ana Lima"},
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func with(claims jwt.MapClaims, key string, value any) jwt.MapClaims {
+	claims[key] = value
+	return claims
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := newJWKSServer(t, rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+	verifier := NewVerifier(VerifierConfig{
+		Secret:   testSecret,
+		JWKSURL:  jwks.URL,
+		Audience: testAudience,
+		Issuer:   testIssuer,
+	})
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{
+			name:  "HS256",
+			token: sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), validClaims()),
+		},
+		{
+			name:  "RS256",
+			token: sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims()),
+		},
+		{
+			name:  "ES256",
+			token: sign(t, jwt.SigningMethodES256, "ec-1", ecKey, validClaims()),
+		},
+		{
+			name:    "wrong secret",
+			token:   sign(t, jwt.SigningMethodHS256, "", []byte("not-the-secret"), validClaims()),
+			wantErr: "signature is invalid",
+		},
+		{
+			name:    "wrong key for kid",
+			token:   sign(t, jwt.SigningMethodES256, "ec-1", otherKey, validClaims()),
+			wantErr: "signature is invalid",
+		},
+		{
+			name:    "wrong audience",
+			token:   sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(validClaims(), "aud", "anon")),
+			wantErr: "aud",
+		},
+		{
+			name:    "wrong issuer",
+			token:   sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with(validClaims(), "iss", "https://evil.example.com")),
+			wantErr: "iss",
+		},
+		{
+			name:    "expired",
+			token:   sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(validClaims(), "exp", time.Now().Add(-time.Hour).Unix())),
+			wantErr: "expired",
+		},
+		{
+			name:    "missing expiry",
+			token:   sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), func() jwt.MapClaims { c := validClaims(); delete(c, "exp"); return c }()),
+			wantErr: "exp",
+		},
+		{
+			name:    "missing kid",
+			token:   sign(t, jwt.SigningMethodES256, "", ecKey, validClaims()),
+			wantErr: "missing key id",
+		},
+		{
+			name:    "invalid subject",
+			token:   sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), with(validClaims(), "sub", "not-a-uuid")),
+			wantErr: "invalid subject",
+		},
+		{
+			name:    "test token not allowed",
+			token:   "test-token",
+			wantErr: "failed to verify token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := verifier.Verify(context.Background(), tt.token)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if user.ID != testUserID || user.Email != "ana@example.com" || user.Name != "Ana Lima" {
+				t.Errorf("Verify() user = %+v", user)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsAlgorithmsWithoutKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a secret is configured, so asymmetric tokens must be refused
+	// without contacting any JWKS endpoint
+	verifier := NewVerifier(VerifierConfig{Secret: testSecret})
+	token := sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims())
+	if _, err := verifier.Verify(context.Background(), token); err == nil {
+		t.Fatal("Verify() accepted an RS256 token without a JWKS URL")
+	}
+
+	// And with only a JWKS URL, HS256 tokens must be refused
+	jwks := newJWKSServer(t, rsaJWK("rsa-1", &rsaKey.PublicKey))
+	verifier = NewVerifier(VerifierConfig{JWKSURL: jwks.URL})
+	token = sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), validClaims())
+	if _, err := verifier.Verify(context.Background(), token); err == nil {
+		t.Fatal("Verify() accepted an HS256 token without a secret")
+	}
+}
+
+func TestJWKSUnknownKidRefetch(t *testing.T) {
+	oldKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := newJWKSServer(t, ecJWK("old", &oldKey.PublicKey))
+	verifier := NewVerifier(VerifierConfig{JWKSURL: jwks.URL})
+	ctx := context.Background()
+
+	if _, err := verifier.Verify(ctx, sign(t, jwt.SigningMethodES256, "old", oldKey, validClaims())); err != nil {
+		t.Fatalf("Verify() with old key error = %v", err)
+	}
+	if got := jwks.requests.Load(); got != 1 {
+		t.Fatalf("JWKS requests after first token = %d, want 1", got)
+	}
+
+	// Cached keys are reused
+	if _, err := verifier.Verify(ctx, sign(t, jwt.SigningMethodES256, "old", oldKey, validClaims())); err != nil {
+		t.Fatalf("Verify() with cached key error = %v", err)
+	}
+	if got := jwks.requests.Load(); got != 1 {
+		t.Fatalf("JWKS requests after cached token = %d, want 1", got)
+	}
+
+	// Rotate the signing key. A token with the new kid refetches the set
+	// once the rate limit window has passed.
+	jwks.setKeys(ecJWK("old", &oldKey.PublicKey), ecJWK("new", &newKey.PublicKey))
+	verifier.jwks.mu.Lock()
+	verifier.jwks.lastAttempt = time.Now().Add(-minJWKSRefetchInterval)
+	verifier.jwks.mu.Unlock()
+
+	if _, err := verifier.Verify(ctx, sign(t, jwt.SigningMethodES256, "new", newKey, validClaims())); err != nil {
+		t.Fatalf("Verify() with rotated key error = %v", err)
+	}
+	if got := jwks.requests.Load(); got != 2 {
+		t.Fatalf("JWKS requests after rotation = %d, want 2", got)
+	}
+}
+
+func TestJWKSRefetchRateLimit(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := newJWKSServer(t, ecJWK("known", &key.PublicKey))
+	verifier := NewVerifier(VerifierConfig{JWKSURL: jwks.URL})
+	ctx := context.Background()
+
+	// The first unknown kid fetches the set; the following ones fall inside
+	// the rate limit window and must not hit the endpoint again
+	for i := 0; i < 5; i++ {
+		token := sign(t, jwt.SigningMethodES256, uuid.NewString(), key, validClaims())
+		_, err := verifier.Verify(ctx, token)
+		if err == nil || !strings.Contains(err.Error(), "unknown key id") {
+			t.Fatalf("Verify() error = %v, want unknown key id", err)
+		}
+	}
+	if got := jwks.requests.Load(); got != 1 {
+		t.Fatalf("JWKS requests = %d, want 1", got)
+	}
+
+	// Known keys keep working while refetches are rate limited
+	if _, err := verifier.Verify(ctx, sign(t, jwt.SigningMethodES256, "known", key, validClaims())); err != nil {
+		t.Fatalf("Verify() with known key error = %v", err)
+	}
+}
+
+func TestJWKSServesCachedKeyWhenEndpointFails(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(jwkSet{Keys: []jwk{ecJWK("k", &key.PublicKey)}})
+	}))
+	defer srv.Close()
+
+	cache := NewJWKSCache(srv.URL, time.Minute, nil)
+	if _, err := cache.Key(context.Background(), "k"); err != nil {
+		t.Fatalf("Key() error = %v", err)
+	}
+
+	// Make the cache stale and the endpoint unavailable
+	failing.Store(true)
+	cache.mu.Lock()
+	cache.fetchedAt = time.Now().Add(-time.Hour)
+	cache.mu.Unlock()
+
+	if _, err := cache.Key(context.Background(), "k"); err != nil {
+		t.Fatalf("Key() with stale cache error = %v", err)
+	}
+}
+
+func TestTestToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		cfg         VerifierConfig
+		want        bool
+	}{
+		{name: "development without keys", environment: "development", want: true},
+		{name: "production", environment: "production", want: false},
+		{name: "staging", environment: "staging", want: false},
+		{name: "development with secret", environment: "development", cfg: VerifierConfig{Secret: testSecret}, want: false},
+		{name: "development with JWKS", environment: "development", cfg: VerifierConfig{JWKSURL: "https://example.com/jwks"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.AllowTestToken = TestTokenAllowed(tt.environment, cfg)
+			if cfg.AllowTestToken != tt.want {
+				t.Fatalf("TestTokenAllowed() = %v, want %v", cfg.AllowTestToken, tt.want)
+			}
+
+			user, err := NewVerifier(cfg).Verify(context.Background(), "test-token")
+			if tt.want {
+				if err != nil || user.ID != testTokenUserID {
+					t.Fatalf("Verify(test-token) = %+v, %v", user, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Verify(test-token) succeeded outside development")
+			}
+		})
+	}
+}
@@ -23,8 +23,10 @@ type contextKey string
 
 const userContextKey contextKey = "user"
 
-// AuthMiddleware creates a middleware for Supabase JWT authentication
-func AuthMiddleware(supabaseJWTSecret string) gin.HandlerFunc {
+// AuthMiddleware creates a middleware for Supabase JWT authentication.
+// If a provisioner is given, the users row is created or synced from the
+// verified claims before the request continues.
+func AuthMiddleware(verifier *Verifier, provisioner *Provisioner) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -42,16 +44,26 @@ func AuthMiddleware(supabaseJWTSecret string) gin.HandlerFunc {
 			return
 		}
 
-		// For now, we'll create a simple JWT verification stub
-		// In production, you would use the Supabase GoTrue client
-		user, err := verifyJWT(tokenString, supabaseJWTSecret)
+		// Verify the token signature and claims
+		user, err := verifier.Verify(c.Request.Context(), tokenString)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to verify JWT")
+			log.Warn().Err(err).Msg("Failed to verify JWT")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		log.Debug().Str("user_id", user.ID.String()).Msg("User authenticated")
+
+		if provisioner != nil {
+			if err := provisioner.Ensure(c.Request.Context(), user); err != nil {
+				log.Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to provision user")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+				c.Abort()
+				return
+			}
+		}
+
 		// Store the user in the context
 		ctx := context.WithValue(c.Request.Context(), userContextKey, user)
 		c.Request = c.Request.WithContext(ctx)
@@ -60,47 +72,6 @@ func AuthMiddleware(supabaseJWTSecret string) gin.HandlerFunc {
 	}
 }
 
-// verifyJWT is a simplified JWT verification (in production, use proper JWT library)
-func verifyJWT(tokenString, _secret string) (*User, error) {
-	// This is a simplified implementation
-	// In production, you should use a proper JWT library like jwt-go
-	// and integrate with Supabase's GoTrue service
-
-	// For development, we'll extract user info from a mock token
-	// In production, this would verify the JWT signature and extract claims
-
-	// Mock implementation - extract user ID from token (for development)
-	// In production, replace with proper JWT verification
-	if tokenString == "" {
-		return nil, fmt.Errorf("empty token")
-	}
-
-	// Create a mock user for development
-	// In production, this would come from verified JWT claims
-	var user *User
-
-	// Use a deterministic user ID for test-token to make testing easier
-	if tokenString == "test-token" {
-		// Use a fixed UUID for test-token
-		testUUID, _ := uuid.Parse("12345678-1234-1234-1234-123456789012")
-		user = &User{
-			ID:    testUUID, // Fixed UUID for test-token
-			Email: "test@example.com", // This should come from JWT claims
-			Name:  "Test User", // This should come from JWT claims
-		}
-	} else {
-		// For other tokens, generate a new UUID (current behavior)
-		user = &User{
-			ID:    uuid.New(), // This should come from JWT claims
-			Email: "user@example.com", // This should come from JWT claims
-			Name:  "Test User", // This should come from JWT claims
-		}
-	}
-
-	log.Debug().Str("user_id", user.ID.String()).Msg("User authenticated")
-	return user, nil
-}
-
 // GetUser retrieves the authenticated user from the context
 func GetUser(ctx context.Context) (*User, error) {
 	user, ok := ctx.Value(userContextKey).(*User)
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/db"
+)
+
+// defaultProvisionCacheTTL is how long a synced user is trusted before the
+// users row is upserted again
+const defaultProvisionCacheTTL = 10 * time.Minute
+
+// provisionedUser is a cache entry for a user whose row is known to be in sync
+type provisionedUser struct {
+	email    string
+	name     string
+	syncedAt time.Time
+}
+
+// Provisioner creates and updates users rows from verified JWT claims.
+// Synced users are cached in memory so Postgres is only hit on the first
+// request, after the TTL expires, or when the claims change. Expired entries
+// are swept once per TTL, so the cache only holds recently active users.
+// When a user's claims change, the other instances drop their entry for
+// the user.
+type Provisioner struct {
+	db          *db.DB
+	ttl         time.Duration
+	invalidator Invalidator
+
+	mu        sync.Mutex
+	users     map[uuid.UUID]provisionedUser
+	lastSweep time.Time
+}
+
+// NewProvisioner creates a new user provisioner. A nil invalidator keeps
+// the cache local to this instance.
+func NewProvisioner(database *db.DB, ttl time.Duration, invalidator Invalidator) *Provisioner {
+	if ttl <= 0 {
+		ttl = defaultProvisionCacheTTL
+	}
+	p := &Provisioner{
+		db:          database,
+		ttl:         ttl,
+		invalidator: invalidator,
+		users:       make(map[uuid.UUID]provisionedUser),
+		lastSweep:   time.Now(),
+	}
+	if invalidator != nil {
+		invalidator.Register(ProvisionCacheName, p.forget)
+	}
+	return p
+}
+
+// Ensure makes sure a users row exists for the user and matches their claims
+func (p *Provisioner) Ensure(ctx context.Context, user *User) error {
+	name := displayName(user)
+
+	p.mu.Lock()
+	cached, ok := p.users[user.ID]
+	p.mu.Unlock()
+
+	if ok && cached.email == user.Email && cached.name == name && time.Since(cached.syncedAt) < p.ttl {
+		return nil
+	}
+
+	if _, err := p.db.UpsertUser(ctx, user.ID, user.Email, name); err != nil {
+		return err
+	}
+
+	p.remember(user.ID, provisionedUser{email: user.Email, name: name, syncedAt: time.Now()})
+
+	if ok && (cached.email != user.Email || cached.name != name) && p.invalidator != nil {
+		p.invalidator.Invalidate(ctx, ProvisionCacheName, user.ID.String())
+	}
+	if !ok {
+		log.Debug().Str("user_id", user.ID.String()).Msg("User provisioned")
+	}
+	return nil
+}
+
+// remember caches a synced user, first dropping expired entries if the last
+// sweep is more than a TTL ago
+func (p *Provisioner) remember(userID uuid.UUID, entry provisionedUser) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry.syncedAt.Sub(p.lastSweep) >= p.ttl {
+		for id, cached := range p.users {
+			if entry.syncedAt.Sub(cached.syncedAt) >= p.ttl {
+				delete(p.users, id)
+			}
+		}
+		p.lastSweep = entry.syncedAt
+	}
+	p.users[userID] = entry
+}
+
+// forget drops a user from the cache, so their next request syncs the row
+// again. An empty key drops every user.
+func (p *Provisioner) forget(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key == "" {
+		clear(p.users)
+		return
+	}
+	userID, err := uuid.Parse(key)
+	if err != nil {
+		log.Warn().Str("key", key).Msg("Ignoring invalid user ID in cache invalidation")
+		return
+	}
+	delete(p.users, userID)
+}
+
+// displayName returns the user's name, falling back to their email local part
+func displayName(user *User) string {
+	if user.Name != "" {
+		return user.Name
+	}
+	if local, _, ok := strings.Cut(user.Email, "@"); ok && local != "" {
+		return local
+	}
+	return "User"
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestProvisionerSweepsExpiredUsers(t *testing.T) {
+	p := NewProvisioner(nil, time.Minute, nil)
+	start := p.lastSweep
+
+	stale, active, fresh := uuid.New(), uuid.New(), uuid.New()
+	p.remember(stale, provisionedUser{syncedAt: start.Add(time.Second)})
+	p.remember(active, provisionedUser{syncedAt: start.Add(40 * time.Second)})
+	if len(p.users) != 2 {
+		t.Fatalf("cached %d users, want 2 before the first sweep is due", len(p.users))
+	}
+
+	p.remember(fresh, provisionedUser{syncedAt: start.Add(70 * time.Second)})
+	if _, ok := p.users[stale]; ok {
+		t.Error("user synced more than a TTL ago was not swept")
+	}
+	if _, ok := p.users[active]; !ok {
+		t.Error("user synced within the TTL was swept")
+	}
+	if _, ok := p.users[fresh]; !ok {
+		t.Error("newly synced user was not cached")
+	}
+
+	// The next sweep waits another TTL
+	p.remember(stale, provisionedUser{syncedAt: start.Add(110 * time.Second)})
+	if _, ok := p.users[active]; !ok {
+		t.Error("sweep ran again before a TTL had passed")
+	}
+	p.remember(fresh, provisionedUser{syncedAt: start.Add(131 * time.Second)})
+	if _, ok := p.users[active]; ok || len(p.users) != 2 {
+		t.Errorf("cached %d users after the second sweep, want 2", len(p.users))
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	tests := []struct {
+		user User
+		want string
+	}{
+		{user: User{Name: "Ana", Email: "ana@example.com"}, want: "Ana"},
+		{user: User{Email: "ana@example.com"}, want: "ana"},
+		{user: User{Email: "@example.com"}, want: "User"},
+		{user: User{}, want: "User"},
+	}
+	for _, tt := range tests {
+		if got := displayName(&tt.user); got != tt.want {
+			t.Errorf("displayName(%+v) = %q, want %q", tt.user, got, tt.want)
+		}
+	}
+}
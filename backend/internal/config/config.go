@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog/log"
@@ -21,9 +22,58 @@ type Config struct {
 	SupabaseJWTSecret string
 	SupabaseURL       string
 	SupabaseKey       string
+	SupabaseJWKSURL   string
+	JWTAudience       string
+	JWTIssuer         string
 	
 	// Expo configuration
 	ExpoPushToken string
+	ExpoAPIURL    string
+
+	// FCM configuration, for native FCM registration tokens. Disabled when no
+	// credentials file is set.
+	FCMCredentialsFile string
+	FCMAPIURL          string
+
+	// APNs configuration, for native iOS tokens. Disabled when no key file
+	// is set.
+	APNSKeyFile string
+	APNSKeyID   string
+	APNSTeamID  string
+	APNSTopic   string
+	APNSSandbox bool
+
+	// SMTP configuration for notification emails. Disabled when no host is
+	// set.
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// Group invite configuration
+	InviteURLBase string
+
+	// Location update configuration
+	LocationDebounceWindow time.Duration
+
+	// Outbox worker configuration
+	OutboxWorkers      int
+	OutboxPollInterval time.Duration
+	OutboxMaxAttempts  int
+	OutboxRetention    time.Duration
+
+	// Push receipt polling configuration
+	PushReceiptPollInterval time.Duration
+	PushReceiptDelay        time.Duration
+
+	// Notification digest configuration
+	DigestInterval time.Duration
+
+	// Event stream configuration
+	StreamHeartbeatInterval time.Duration
+	// EventBus is "postgres" to share events between replicas, or "local"
+	EventBus string
 	
 	// Environment
 	Environment string
@@ -37,13 +87,40 @@ func Load() (*Config, error) {
 	}
 	
 	config := &Config{
-		Port:              getEnv("PORT", "8080"),
-		DatabaseURL:       getEnv("DATABASE_URL", ""),
-		SupabaseJWTSecret: getEnv("SUPABASE_JWT_SECRET", ""),
-		SupabaseURL:       getEnv("SUPABASE_URL", ""),
-		SupabaseKey:       getEnv("SUPABASE_KEY", ""),
-		ExpoPushToken:     getEnv("EXPO_PUSH_TOKEN", ""),
-		Environment:       getEnv("ENVIRONMENT", "development"),
+		Port:                    getEnv("PORT", "8080"),
+		DatabaseURL:             getEnv("DATABASE_URL", ""),
+		SupabaseJWTSecret:       getEnv("SUPABASE_JWT_SECRET", ""),
+		SupabaseURL:             getEnv("SUPABASE_URL", ""),
+		SupabaseKey:             getEnv("SUPABASE_KEY", ""),
+		SupabaseJWKSURL:         getEnv("SUPABASE_JWKS_URL", ""),
+		JWTAudience:             getEnv("SUPABASE_JWT_AUDIENCE", "authenticated"),
+		JWTIssuer:               getEnv("SUPABASE_JWT_ISSUER", ""),
+		ExpoPushToken:           getEnv("EXPO_PUSH_TOKEN", ""),
+		ExpoAPIURL:              getEnv("EXPO_API_URL", "https://exp.host/--/api/v2"),
+		FCMCredentialsFile:      getEnv("FCM_CREDENTIALS_FILE", ""),
+		FCMAPIURL:               getEnv("FCM_API_URL", "https://fcm.googleapis.com/v1"),
+		APNSKeyFile:             getEnv("APNS_KEY_FILE", ""),
+		APNSKeyID:               getEnv("APNS_KEY_ID", ""),
+		APNSTeamID:              getEnv("APNS_TEAM_ID", ""),
+		APNSTopic:               getEnv("APNS_TOPIC", ""),
+		APNSSandbox:             getEnvAsBool("APNS_SANDBOX", false),
+		SMTPHost:                getEnv("SMTP_HOST", ""),
+		SMTPPort:                getEnvAsInt("SMTP_PORT", 587),
+		SMTPUsername:            getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:            getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:                getEnv("SMTP_FROM", ""),
+		InviteURLBase:           getEnv("INVITE_URL_BASE", "marko://invite/"),
+		LocationDebounceWindow:  getEnvAsDuration("LOCATION_DEBOUNCE_WINDOW", 5*time.Minute),
+		OutboxWorkers:           getEnvAsInt("OUTBOX_WORKERS", 4),
+		OutboxPollInterval:      getEnvAsDuration("OUTBOX_POLL_INTERVAL", time.Second),
+		OutboxMaxAttempts:       getEnvAsInt("OUTBOX_MAX_ATTEMPTS", 8),
+		OutboxRetention:         getEnvAsDuration("OUTBOX_RETENTION", 7*24*time.Hour),
+		PushReceiptPollInterval: getEnvAsDuration("PUSH_RECEIPT_POLL_INTERVAL", time.Minute),
+		PushReceiptDelay:        getEnvAsDuration("PUSH_RECEIPT_DELAY", 15*time.Minute),
+		DigestInterval:          getEnvAsDuration("NOTIFICATION_DIGEST_INTERVAL", 6*time.Hour),
+		StreamHeartbeatInterval: getEnvAsDuration("STREAM_HEARTBEAT_INTERVAL", 25*time.Second),
+		EventBus:                getEnv("EVENT_BUS", "postgres"),
+		Environment:             getEnv("ENVIRONMENT", "development"),
 	}
 	
 	// Validate required configuration
@@ -51,9 +128,16 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("DATABASE_URL is required")
 	}
 	
-	if config.SupabaseJWTSecret == "" {
+	if config.SupabaseJWTSecret == "" && config.SupabaseJWKSURL == "" {
+		if config.Environment != "development" {
+			return nil, fmt.Errorf("SUPABASE_JWT_SECRET or SUPABASE_JWKS_URL is required")
+		}
 		log.Warn().Msg("SUPABASE_JWT_SECRET not set, using development mode")
 	}
+
+	if config.EventBus != "postgres" && config.EventBus != "local" {
+		return nil, fmt.Errorf("EVENT_BUS must be postgres or local")
+	}
 	
 	return config, nil
 }
@@ -84,4 +168,14 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 		}
 	}
 	return defaultValue
+}
+
+// getEnvAsDuration gets an environment variable as a duration with a default value
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if durationValue, err := time.ParseDuration(value); err == nil {
+			return durationValue
+		}
+	}
+	return defaultValue
 }
\ No newline at end of file
@@ -0,0 +1,123 @@
+// Package countries is a registry of ISO 3166-1 alpha-2 country codes with
+// English names, used to validate client input and to render country names
+// in notification text.
+package countries
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+//go:embed countries.csv
+var countriesData string
+
+// registry maps upper case codes to their English names
+var registry = mustLoad()
+
+func mustLoad() map[string]string {
+	records, err := csv.NewReader(strings.NewReader(countriesData)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("countries: failed to parse registry: %v", err))
+	}
+
+	registry := make(map[string]string, len(records))
+	for _, record := range records[1:] { // skip header
+		registry[record[0]] = record[1]
+	}
+	return registry
+}
+
+// aliases maps exceptionally reserved codes that clients commonly send to
+// the assigned code
+var aliases = map[string]string{
+	"UK": "GB",
+	"EL": "GR",
+}
+
+// Normalize validates a country code and returns it in canonical upper case
+// form, e.g. " us" becomes "US" and "uk" becomes "GB". It returns false for
+// unknown codes.
+func Normalize(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if alias, ok := aliases[code]; ok {
+		code = alias
+	}
+	if _, ok := registry[code]; !ok {
+		return "", false
+	}
+	return code, true
+}
+
+// Name returns the name of a country in the given locale (a BCP 47 tag such
+// as "fr" or "pt-BR"). It falls back to the English name when the locale is
+// unknown or has no translation, and to the code itself for unknown codes.
+func Name(code, locale string) string {
+	english, ok := registry[code]
+	if !ok {
+		return code
+	}
+
+	// The registry's English names are curated, so prefer them over CLDR's
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return english
+	}
+	if base, _ := tag.Base(); base.String() == "en" {
+		return english
+	}
+	region, err := language.ParseRegion(code)
+	if err != nil {
+		return english
+	}
+	if name := display.Regions(tag).Name(region); name != "" {
+		return name
+	}
+	return english
+}
+
+// Flag returns the flag emoji for a country code, built from the regional
+// indicator symbols of its two letters
+func Flag(code string) string {
+	if len(code) != 2 {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range []byte(strings.ToUpper(code)) {
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+		b.WriteRune(rune(c-'A') + 0x1F1E6)
+	}
+	return b.String()
+}
+
+// Label returns the flag and localized name of a country, e.g. "🇫🇷 France"
+func Label(code, locale string) string {
+	if flag := Flag(code); flag != "" {
+		return flag + " " + Name(code, locale)
+	}
+	return Name(code, locale)
+}
+
+// NormalizeAll normalizes a list of country codes, dropping duplicates. It
+// returns the first unknown code and false if any code is invalid.
+func NormalizeAll(codes []string) ([]string, string, bool) {
+	normalized := make([]string, 0, len(codes))
+	seen := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		n, ok := Normalize(code)
+		if !ok {
+			return nil, code, false
+		}
+		if !seen[n] {
+			seen[n] = true
+			normalized = append(normalized, n)
+		}
+	}
+	return normalized, "", true
+}
@@ -0,0 +1,124 @@
+package countries
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		code   string
+		want   string
+		wantOK bool
+	}{
+		{code: "US", want: "US", wantOK: true},
+		{code: "us", want: "US", wantOK: true},
+		{code: " fr ", want: "FR", wantOK: true},
+		{code: "XK", want: "XK", wantOK: true},
+		{code: "xk", want: "XK", wantOK: true},
+		{code: "UK", want: "GB", wantOK: true},
+		{code: "uk", want: "GB", wantOK: true},
+		{code: "EL", want: "GR", wantOK: true},
+		{code: "QQ"},
+		{code: "USA"},
+		{code: "U"},
+		{code: ""},
+		{code: "code"},
+	}
+	for _, tt := range tests {
+		got, ok := Normalize(tt.code)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Normalize(%q) = %q, %v, want %q, %v", tt.code, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestNormalizeAll(t *testing.T) {
+	got, invalid, ok := NormalizeAll([]string{"fr", "FR", "uk", "gb", "jp"})
+	if !ok || invalid != "" || !slices.Equal(got, []string{"FR", "GB", "JP"}) {
+		t.Errorf("NormalizeAll() = %v, %q, %v, want [FR GB JP]", got, invalid, ok)
+	}
+
+	if _, invalid, ok := NormalizeAll([]string{"fr", "zz", "qq"}); ok || invalid != "zz" {
+		t.Errorf("NormalizeAll() invalid = %q, %v, want the first unknown code", invalid, ok)
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		code   string
+		locale string
+		want   string
+	}{
+		// Supported notification locales
+		{code: "DE", locale: "en", want: "Germany"},
+		{code: "DE", locale: "es", want: "Alemania"},
+		{code: "DE", locale: "fr", want: "Allemagne"},
+		{code: "DE", locale: "de", want: "Deutschland"},
+		{code: "DE", locale: "pt", want: "Alemanha"},
+		{code: "JP", locale: "pt-BR", want: "Japão"},
+		{code: "US", locale: "fr", want: "États-Unis"},
+		{code: "XK", locale: "en", want: "Kosovo"},
+		{code: "XK", locale: "de", want: "Kosovo"},
+
+		// English names come from the registry, whatever the region
+		{code: "US", locale: "en-GB", want: "United States"},
+		{code: "GB", locale: "en-US", want: "United Kingdom"},
+
+		// Unknown or invalid locales fall back to English
+		{code: "JP", locale: "", want: "Japan"},
+		{code: "JP", locale: "not a locale", want: "Japan"},
+
+		// Unknown codes are returned as is
+		{code: "QQ", locale: "fr", want: "QQ"},
+	}
+	for _, tt := range tests {
+		if got := Name(tt.code, tt.locale); got != tt.want {
+			t.Errorf("Name(%q, %q) = %q, want %q", tt.code, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestFlag(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "FR", want: "🇫🇷"},
+		{code: "jp", want: "🇯🇵"},
+		{code: "XK", want: "🇽🇰"},
+		{code: "X1", want: ""},
+		{code: "FRA", want: ""},
+		{code: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := Flag(tt.code); got != tt.want {
+			t.Errorf("Flag(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	if got := Label("FR", "de"); got != "🇫🇷 Frankreich" {
+		t.Errorf("Label(FR, de) = %q", got)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if len(registry) < 240 {
+		t.Errorf("registry has %d countries, want every ISO 3166-1 code", len(registry))
+	}
+	for code, name := range registry {
+		if len(code) != 2 || name == "" {
+			t.Errorf("invalid registry entry %q: %q", code, name)
+		}
+	}
+	for alias, code := range aliases {
+		if _, ok := registry[alias]; ok {
+			t.Errorf("alias %s shadows a registry code", alias)
+		}
+		if _, ok := registry[code]; !ok {
+			t.Errorf("alias %s points at unknown code %s", alias, code)
+		}
+	}
+}
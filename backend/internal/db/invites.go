@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the Postgres error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+// IsUniqueViolation reports whether err was caused by a unique constraint
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+// GroupInvite queries
+
+const groupInviteColumns = `id, group_id, code, created_by, expires_at, max_uses, uses, revoked_at, created_at`
+
+// CreateGroupInvite creates an invite code for a group. Callers should check
+// IsUniqueViolation and retry with a new code on collision.
+func (db *DB) CreateGroupInvite(ctx context.Context, groupID, createdBy uuid.UUID, code string, expiresAt *time.Time, maxUses *int) (*GroupInvite, error) {
+	invite, err := scanGroupInvite(db.QueryRowContext(ctx, `
+		INSERT INTO group_invites (group_id, code, created_by, expires_at, max_uses)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+groupInviteColumns,
+		groupID, code, createdBy, expiresAt, maxUses))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group invite: %w", err)
+	}
+	return invite, nil
+}
+
+// GetGroupInviteByCode gets an invite by its code
+func (db *DB) GetGroupInviteByCode(ctx context.Context, code string) (*GroupInvite, error) {
+	invite, err := scanGroupInvite(db.QueryRowContext(ctx, `
+		SELECT `+groupInviteColumns+`
+		FROM group_invites
+		WHERE code = $1
+	`, code))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get group invite: %w", err)
+	}
+	return invite, nil
+}
+
+// ListGroupInvites lists a group's invites that can still be used
+func (db *DB) ListGroupInvites(ctx context.Context, groupID uuid.UUID) ([]*GroupInvite, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+groupInviteColumns+`
+		FROM group_invites
+		WHERE group_id = $1
+		  AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		  AND (max_uses IS NULL OR uses < max_uses)
+		ORDER BY created_at DESC
+	`, groupID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []*GroupInvite
+	for rows.Next() {
+		invite, err := scanGroupInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+
+	return invites, nil
+}
+
+// RevokeGroupInvite revokes an invite of the given group. It returns false
+// if no such invite exists or it was already revoked.
+func (db *DB) RevokeGroupInvite(ctx context.Context, groupID, inviteID uuid.UUID) (bool, error) {
+	result, err := db.ExecContext(ctx, `
+		UPDATE group_invites
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND group_id = $2 AND revoked_at IS NULL
+	`, inviteID, groupID)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke group invite: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke group invite: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RedeemGroupInvite consumes one use of an invite and adds the user to its
+// group. The use is only counted if the invite is still valid at that
+// moment, so concurrent redemptions cannot exceed max_uses. It returns false
+// if the invite is revoked, expired or used up.
+func (db *DB) RedeemGroupInvite(ctx context.Context, inviteID, userID uuid.UUID) (bool, error) {
+	redeemed := false
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		var groupID uuid.UUID
+		err := tx.QueryRowContext(ctx, `
+			UPDATE group_invites
+			SET uses = uses + 1
+			WHERE id = $1
+			  AND revoked_at IS NULL
+			  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+			  AND (max_uses IS NULL OR uses < max_uses)
+			RETURNING group_id
+		`, inviteID).Scan(&groupID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to redeem group invite: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO group_members (group_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT (group_id, user_id) DO NOTHING
+		`, groupID, userID); err != nil {
+			return fmt.Errorf("failed to add group member: %w", err)
+		}
+
+		redeemed = true
+		return nil
+	})
+	return redeemed, err
+}
+
+// scanGroupInvite scans a row selected with groupInviteColumns
+func scanGroupInvite(row interface{ Scan(...any) error }) (*GroupInvite, error) {
+	invite := &GroupInvite{}
+	err := row.Scan(&invite.ID, &invite.GroupID, &invite.Code, &invite.CreatedBy, &invite.ExpiresAt, &invite.MaxUses, &invite.Uses, &invite.RevokedAt, &invite.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JoinRequestCooldown is how long a user must wait after a rejection before
+// asking to join the same group again
+const JoinRequestCooldown = 24 * time.Hour
+
+// ErrJoinRequestCooldown is returned when a user asks to join a group that
+// rejected them less than JoinRequestCooldown ago
+var ErrJoinRequestCooldown = errors.New("join request was rejected recently")
+
+// GroupJoinRequest queries
+
+const joinRequestColumns = `id, group_id, user_id, status, message, decided_by, decided_at, created_at`
+
+// CreateGroupJoinRequest creates a pending request to join a group, or
+// returns the user's existing pending request; the returned bool reports
+// whether a new request was created. The given notifications (for the
+// group's owner and admins) are only created for a new request.
+// ErrJoinRequestCooldown is returned if the group rejected the user within
+// JoinRequestCooldown, so a rejected user cannot notify the admins again
+// right away.
+func (db *DB) CreateGroupJoinRequest(ctx context.Context, groupID, userID uuid.UUID, message *string, notify []NewNotification) (*GroupJoinRequest, bool, error) {
+	var request *GroupJoinRequest
+	created := false
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		var rejected bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1
+				FROM group_join_requests
+				WHERE group_id = $1 AND user_id = $2 AND status = 'rejected'
+					AND decided_at > CURRENT_TIMESTAMP - $3 * INTERVAL '1 millisecond'
+			)
+		`, groupID, userID, JoinRequestCooldown.Milliseconds()).Scan(&rejected); err != nil {
+			return err
+		}
+		if rejected {
+			return ErrJoinRequestCooldown
+		}
+
+		var err error
+		request, err = scanJoinRequest(tx.QueryRowContext(ctx, `
+			INSERT INTO group_join_requests (group_id, user_id, message)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (group_id, user_id) WHERE status = 'pending' DO NOTHING
+			RETURNING `+joinRequestColumns,
+			groupID, userID, message))
+		if err == sql.ErrNoRows {
+			// Already pending
+			request, err = scanJoinRequest(tx.QueryRowContext(ctx, `
+				SELECT `+joinRequestColumns+`
+				FROM group_join_requests
+				WHERE group_id = $1 AND user_id = $2 AND status = 'pending'
+			`, groupID, userID))
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := createNotifications(ctx, tx, nil, notify); err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create group join request: %w", err)
+	}
+	return request, created, nil
+}
+
+// GetGroupJoinRequest gets a join request of the given group
+func (db *DB) GetGroupJoinRequest(ctx context.Context, groupID, requestID uuid.UUID) (*GroupJoinRequest, error) {
+	request, err := scanJoinRequest(db.QueryRowContext(ctx, `
+		SELECT `+joinRequestColumns+`
+		FROM group_join_requests
+		WHERE id = $1 AND group_id = $2
+	`, requestID, groupID))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get group join request: %w", err)
+	}
+	return request, nil
+}
+
+// ListPendingGroupJoinRequests lists a group's pending requests, oldest first
+func (db *DB) ListPendingGroupJoinRequests(ctx context.Context, groupID uuid.UUID) ([]*GroupJoinRequest, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.id, r.group_id, r.user_id, r.status, r.message, r.decided_by, r.decided_at, r.created_at, u.name
+		FROM group_join_requests r
+		INNER JOIN users u ON u.id = r.user_id
+		WHERE r.group_id = $1 AND r.status = 'pending'
+		ORDER BY r.created_at
+	`, groupID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group join requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []*GroupJoinRequest
+	for rows.Next() {
+		request := &GroupJoinRequest{}
+		if err := rows.Scan(&request.ID, &request.GroupID, &request.UserID, &request.Status, &request.Message, &request.DecidedBy, &request.DecidedAt, &request.CreatedAt, &request.UserName); err != nil {
+			return nil, fmt.Errorf("failed to scan group join request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
+
+// DecideGroupJoinRequest approves or rejects a pending request. Approving
+// adds the requester to the group. The given notification (for the
+// requester) is created in the same transaction. It returns nil if the
+// request is no longer pending.
+func (db *DB) DecideGroupJoinRequest(ctx context.Context, groupID, requestID, decidedBy uuid.UUID, approve bool, notify []NewNotification) (*GroupJoinRequest, error) {
+	status := JoinRequestRejected
+	if approve {
+		status = JoinRequestApproved
+	}
+
+	var request *GroupJoinRequest
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		r, err := scanJoinRequest(tx.QueryRowContext(ctx, `
+			UPDATE group_join_requests
+			SET status = $3, decided_by = $4, decided_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND group_id = $2 AND status = 'pending'
+			RETURNING `+joinRequestColumns,
+			requestID, groupID, status, decidedBy))
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if approve {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO group_members (group_id, user_id)
+				VALUES ($1, $2)
+				ON CONFLICT (group_id, user_id) DO NOTHING
+			`, groupID, r.UserID); err != nil {
+				return err
+			}
+		}
+
+		if _, err := createNotifications(ctx, tx, nil, notify); err != nil {
+			return err
+		}
+		request = r
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decide group join request: %w", err)
+	}
+	return request, nil
+}
+
+// scanJoinRequest scans a row selected with joinRequestColumns
+func scanJoinRequest(row interface{ Scan(...any) error }) (*GroupJoinRequest, error) {
+	request := &GroupJoinRequest{}
+	err := row.Scan(&request.ID, &request.GroupID, &request.UserID, &request.Status, &request.Message, &request.DecidedBy, &request.DecidedAt, &request.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
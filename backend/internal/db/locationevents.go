@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErrLocationEventConflict is returned when another location update of the
+// same user was fanned out while this one was being prepared. The caller
+// should retry, so the update is compared against the new last event.
+var ErrLocationEventConflict = errors.New("location event conflicts with a concurrent fan-out")
+
+// LocationEvent queries
+
+const locationEventColumns = `id, user_id, location_id, country_code, status, from_country_code, occurred_at, created_at`
+
+// CreateLocationEvent records that a location update is being fanned out and
+// creates its notifications, linked to the event, and webhook deliveries in
+// one transaction. It returns nil if the update was already fanned out, so a
+// redelivered outbox event never notifies anyone twice.
+//
+// previousID is the user's last location event the fan-out was based on, nil
+// if there was none. Fan-outs of the same user are serialized, and
+// ErrLocationEventConflict is returned if another event was created since.
+func (db *DB) CreateLocationEvent(ctx context.Context, update LocationUpdatedEvent, previousID *uuid.UUID, notify []NewNotification, webhooks []WebhookDeliveryEvent) (*LocationEvent, error) {
+	var fromCountryCode *string
+	if update.FromCountryCode != "" {
+		fromCountryCode = &update.FromCountryCode
+	}
+
+	var event *LocationEvent
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, update.UserID); err != nil {
+			return err
+		}
+
+		last, err := scanLocationEvent(tx.QueryRowContext(ctx, `
+			SELECT `+locationEventColumns+`
+			FROM location_events
+			WHERE user_id = $1
+			ORDER BY occurred_at DESC
+			LIMIT 1
+		`, update.UserID))
+		if err != nil {
+			return err
+		}
+		if last != nil && last.LocationID == update.LocationID {
+			// Already fanned out
+			return nil
+		}
+		if (last == nil) != (previousID == nil) || (last != nil && last.ID != *previousID) {
+			return ErrLocationEventConflict
+		}
+
+		e, err := scanLocationEvent(tx.QueryRowContext(ctx, `
+			INSERT INTO location_events (user_id, location_id, country_code, status, from_country_code, occurred_at)
+			SELECT $1, l.id, $3, $4, $5, l.updated_at
+			FROM user_locations l
+			WHERE l.id = $2
+			ON CONFLICT (location_id) DO NOTHING
+			RETURNING `+locationEventColumns,
+			update.UserID, update.LocationID, update.CountryCode, update.Status, fromCountryCode))
+		if err != nil || e == nil {
+			return err
+		}
+
+		if _, err := createNotifications(ctx, tx, &e.ID, notify); err != nil {
+			return err
+		}
+		for _, delivery := range webhooks {
+			if err := enqueueOutboxEvent(ctx, tx, EventWebhookDelivery, delivery); err != nil {
+				return err
+			}
+		}
+		event = e
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create location event: %w", err)
+	}
+	return event, nil
+}
+
+// GetLastLocationEvent gets the most recent location update that was fanned
+// out for a user, i.e. the last state their group members were told about
+func (db *DB) GetLastLocationEvent(ctx context.Context, userID uuid.UUID) (*LocationEvent, error) {
+	event, err := scanLocationEvent(db.QueryRowContext(ctx, `
+		SELECT `+locationEventColumns+`
+		FROM location_events
+		WHERE user_id = $1
+		ORDER BY occurred_at DESC
+		LIMIT 1
+	`, userID))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last location event: %w", err)
+	}
+	return event, nil
+}
+
+// scanLocationEvent scans a single location event row, returning nil if
+// there is none
+func scanLocationEvent(row *sql.Row) (*LocationEvent, error) {
+	e := &LocationEvent{}
+	err := row.Scan(&e.ID, &e.UserID, &e.LocationID, &e.CountryCode, &e.Status, &e.FromCountryCode, &e.OccurredAt, &e.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,23 +12,180 @@ type User struct {
 	ID        uuid.UUID  `json:"id" db:"id"`
 	Email     string     `json:"email" db:"email"`
 	Name      string     `json:"name" db:"name"`
-	PushToken *string    `json:"push_token,omitempty" db:"push_token"`
+	Locale    string     `json:"locale" db:"locale"`
 	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 }
 
+// Device represents a push token registered by one of a user's devices
+type Device struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	UserID     uuid.UUID  `json:"user_id" db:"user_id"`
+	PushToken  string     `json:"push_token" db:"push_token"`
+	TokenType  string     `json:"token_type" db:"token_type"` // 'expo', 'fcm' or 'apns'
+	Platform   string     `json:"platform" db:"platform"`
+	AppVersion *string    `json:"app_version,omitempty" db:"app_version"`
+	LastSeenAt time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty" db:"disabled_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Push token types, i.e. the service a device token belongs to
+const (
+	TokenTypeExpo = "expo"
+	TokenTypeFCM  = "fcm"
+	TokenTypeAPNs = "apns"
+)
+
 // Group represents a group that users can join
 type Group struct {
+	ID                uuid.UUID  `json:"id" db:"id"`
+	Name              string     `json:"name" db:"name"`
+	CreatedBy         uuid.UUID  `json:"created_by" db:"created_by"`
+	AllowIDJoin       bool       `json:"allow_id_join" db:"allow_id_join"`             // join by group ID without an invite
+	AllowJoinRequests bool       `json:"allow_join_requests" db:"allow_join_requests"` // request to join, pending approval
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Group member roles
+const (
+	// RoleOwner has full control of a group; every group has exactly one
+	RoleOwner = "owner"
+	// RoleAdmin can manage the group and its members, except the owner
+	RoleAdmin = "admin"
+	// RoleMember can see the group and its members
+	RoleMember = "member"
+)
+
+// GroupMember represents a user's membership in a group
+type GroupMember struct {
 	ID        uuid.UUID  `json:"id" db:"id"`
-	Name      string     `json:"name" db:"name"`
+	GroupID   uuid.UUID  `json:"group_id" db:"group_id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	Role      string     `json:"role" db:"role"` // 'owner', 'admin' or 'member'
+	NotificationPreferences
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Notification preference values
+const (
+	NotifyOnAll        = "all"
+	NotifyOnArrivals   = "arrivals"
+	NotifyOnDepartures = "departures"
+
+	DeliveryInstant = "instant"
+	DeliveryDigest  = "digest"
+)
+
+// NotificationPreferences controls which location updates of a group a
+// member is notified about, and how
+type NotificationPreferences struct {
+	MutedUntil *time.Time `json:"muted_until" db:"muted_until"`
+	NotifyOn   string     `json:"notify_on" db:"notify_on"`       // 'all', 'arrivals' or 'departures'
+	Delivery   string     `json:"delivery" db:"delivery"`         // 'instant' or 'digest'
+	Email      bool       `json:"email" db:"email_notifications"` // also send notifications by email, right away even with digest delivery
+}
+
+// Muted reports whether notifications are muted at the given time
+func (p NotificationPreferences) Muted(at time.Time) bool {
+	return p.MutedUntil != nil && p.MutedUntil.After(at)
+}
+
+// Wants reports whether a location update matches the NotifyOn preference.
+// An arrival that implies leaving another country counts as both.
+func (p NotificationPreferences) Wants(status string, leftCountry bool) bool {
+	return wantsUpdate(p.NotifyOn, status, leftCountry)
+}
+
+// wantsUpdate reports whether a location update matches a notify_on value
+func wantsUpdate(notifyOn, status string, leftCountry bool) bool {
+	switch notifyOn {
+	case NotifyOnArrivals:
+		return status == "arrived"
+	case NotifyOnDepartures:
+		return status == "left" || leftCountry
+	default:
+		return true
+	}
+}
+
+// Recipient is a group member to notify, with their preferences
+type Recipient struct {
+	UserID uuid.UUID
+	Locale string
+	// CountryCode is the country the recipient is currently in, if known
+	CountryCode string
+	// Watchlist is the recipient's watchlist for the group; nil means every
+	// country
+	Watchlist *CountryWatchlist
+	NotificationPreferences
+}
+
+// CountryWatchlist limits the location updates a user is notified about to
+// certain countries. A watchlist without a group applies to all of the
+// user's groups; a group watchlist replaces it for that group.
+type CountryWatchlist struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	UserID       uuid.UUID  `json:"user_id" db:"user_id"`
+	GroupID      *uuid.UUID `json:"group_id,omitempty" db:"group_id"`
+	CountryCodes []string   `json:"country_codes" db:"country_codes"`
+	SameCountry  bool       `json:"same_country" db:"same_country"` // also watch whichever country the user is in
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Matches reports whether a location update concerning any of the given
+// countries is on the watchlist. ownCountry is the watcher's current
+// country, or empty if unknown.
+func (w *CountryWatchlist) Matches(countryCodes []string, ownCountry string) bool {
+	for _, code := range countryCodes {
+		if w.SameCountry && ownCountry != "" && code == ownCountry {
+			return true
+		}
+		for _, watched := range w.CountryCodes {
+			if code == watched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Member is a user together with their membership in a group
+type Member struct {
+	User
+	Role     string    `json:"role" db:"role"`
+	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
+}
+
+// GroupInvite represents an invite code that lets users join a group
+type GroupInvite struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	GroupID   uuid.UUID  `json:"group_id" db:"group_id"`
+	Code      string     `json:"code" db:"code"`
 	CreatedBy uuid.UUID  `json:"created_by" db:"created_by"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	MaxUses   *int       `json:"max_uses,omitempty" db:"max_uses"`
+	Uses      int        `json:"uses" db:"uses"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
 	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 }
 
-// GroupMember represents a user's membership in a group
-type GroupMember struct {
+// Join request statuses
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
+// GroupJoinRequest represents a user's request to join a group
+type GroupJoinRequest struct {
 	ID        uuid.UUID  `json:"id" db:"id"`
 	GroupID   uuid.UUID  `json:"group_id" db:"group_id"`
 	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	UserName  string     `json:"user_name,omitempty" db:"user_name"` // only set when listing
+	Status    string     `json:"status" db:"status"`                 // 'pending', 'approved' or 'rejected'
+	Message   *string    `json:"message,omitempty" db:"message"`
+	DecidedBy *uuid.UUID `json:"decided_by,omitempty" db:"decided_by"`
+	DecidedAt *time.Time `json:"decided_at,omitempty" db:"decided_at"`
 	CreatedAt time.Time  `json:"created_at" db:"created_at"`
 }
 
@@ -40,11 +198,120 @@ type UserLocation struct {
 	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
 }
 
+// LocationEvent is a location update that was fanned out to group
+// members; each recipient gets at most one notification for it
+type LocationEvent struct {
+	ID              uuid.UUID `json:"id" db:"id"`
+	UserID          uuid.UUID `json:"user_id" db:"user_id"`
+	LocationID      uuid.UUID `json:"location_id" db:"location_id"`
+	CountryCode     string    `json:"country_code" db:"country_code"`
+	Status          string    `json:"status" db:"status"`
+	FromCountryCode *string   `json:"from_country_code,omitempty" db:"from_country_code"`
+	OccurredAt      time.Time `json:"occurred_at" db:"occurred_at"` // when the location update happened
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// Trip is a stay in a country: an arrival paired with the update that ended
+// it, normally the matching departure
+type Trip struct {
+	ID              uuid.UUID  `json:"id" db:"id"` // ID of the arrival
+	CountryCode     string     `json:"country_code" db:"country_code"`
+	StartedAt       time.Time  `json:"started_at" db:"started_at"`
+	EndedAt         *time.Time `json:"ended_at" db:"ended_at"`                 // nil while the trip is ongoing
+	DurationSeconds int64      `json:"duration_seconds" db:"duration_seconds"` // until now for ongoing trips
+}
+
+// Presence is where a user is right now, derived from their latest
+// location update
+type Presence struct {
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	CountryCode *string    `json:"country_code" db:"country_code"` // nil unless the latest update is an arrival
+	Since       *time.Time `json:"since" db:"since"`
+}
+
 // Notification represents a notification sent to users
 type Notification struct {
-	ID        uuid.UUID  `json:"id" db:"id"`
-	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
-	GroupID   uuid.UUID  `json:"group_id" db:"group_id"`
-	Message   string     `json:"message" db:"message"`
-	CreatedAt time.Time  `json:"created_at" db:"created_at"`
-}
\ No newline at end of file
+	ID              uuid.UUID   `json:"id" db:"id"`
+	UserID          uuid.UUID   `json:"user_id" db:"user_id"`
+	GroupID         *uuid.UUID  `json:"group_id" db:"group_id"`                   // nil once the group is deleted
+	GroupIDs        []uuid.UUID `json:"group_ids" db:"group_ids"`                 // every group the notification is about
+	LocationEventID *uuid.UUID  `json:"location_event_id" db:"location_event_id"` // set for location updates
+	Type            string      `json:"type" db:"type"`
+	Title           string      `json:"title" db:"title"`
+	Message         string      `json:"message" db:"message"`
+	Delivery        string      `json:"delivery" db:"delivery"`               // 'instant' or 'digest'
+	DeliveryStatus  string      `json:"delivery_status" db:"delivery_status"` // 'none', 'pending', 'delivered' or 'failed'
+	ReadAt          *time.Time  `json:"read_at" db:"read_at"`
+	CreatedAt       time.Time   `json:"created_at" db:"created_at"`
+}
+
+// Notification types
+const (
+	NotificationLocationUpdate = "location_update"
+	NotificationGroupRenamed   = "group_renamed"
+	NotificationGroupDeleted   = "group_deleted"
+	NotificationMemberLeft     = "member_left"
+	NotificationMemberRemoved  = "member_removed"
+	NotificationJoinRequested  = "join_requested"
+	NotificationJoinApproved   = "join_approved"
+	NotificationJoinRejected   = "join_rejected"
+)
+
+// PushTicket represents the result of handing a push message to the push provider
+type PushTicket struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	NotificationID   *uuid.UUID `json:"notification_id,omitempty" db:"notification_id"`
+	DeviceID         uuid.UUID  `json:"device_id" db:"device_id"`
+	TicketID         *string    `json:"ticket_id,omitempty" db:"ticket_id"`
+	Status           string     `json:"status" db:"status"` // 'ok' or 'error'
+	Error            *string    `json:"error,omitempty" db:"error"`
+	ReceiptStatus    *string    `json:"receipt_status,omitempty" db:"receipt_status"` // 'ok', 'error' or 'expired'
+	ReceiptError     *string    `json:"receipt_error,omitempty" db:"receipt_error"`
+	ReceiptCheckedAt *time.Time `json:"receipt_checked_at,omitempty" db:"receipt_checked_at"` // last receipt poll
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
+
+// GroupWebhook is an outbound HTTP endpoint a group's location updates are
+// posted to. Deliveries are signed with Secret, which is only shown when the
+// webhook is created.
+type GroupWebhook struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	GroupID   uuid.UUID `json:"group_id" db:"group_id"`
+	URL       string    `json:"url" db:"url"`
+	Secret    string    `json:"-" db:"secret"`
+	NotifyOn  string    `json:"notify_on" db:"notify_on"` // 'all', 'arrivals' or 'departures'
+	CreatedBy uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Wants reports whether a location update matches the webhook's NotifyOn
+// setting, with the same rules as member preferences
+func (w GroupWebhook) Wants(status string, leftCountry bool) bool {
+	return wantsUpdate(w.NotifyOn, status, leftCountry)
+}
+
+// NewPushTicket holds the fields needed to record a push ticket. Providers
+// that confirm delivery when the message is sent leave TicketID empty and set
+// ReceiptStatus right away.
+type NewPushTicket struct {
+	NotificationID *uuid.UUID
+	DeviceID       uuid.UUID
+	TicketID       *string
+	Status         string
+	Error          *string
+	ReceiptStatus  *string
+}
+
+// OutboxEvent represents a unit of asynchronous work queued in the outbox
+type OutboxEvent struct {
+	ID            uuid.UUID       `json:"id" db:"id"`
+	EventType     string          `json:"event_type" db:"event_type"`
+	Payload       json.RawMessage `json:"payload" db:"payload"`
+	Status        string          `json:"status" db:"status"` // 'pending', 'processing', 'done' or 'dead'
+	Attempts      int             `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     *string         `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	ProcessedAt   *time.Time      `json:"processed_at,omitempty" db:"processed_at"`
+}
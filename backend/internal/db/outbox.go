@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outbox event types
+const (
+	// EventLocationUpdated is enqueued with every accepted location update
+	EventLocationUpdated = "location.updated"
+	// EventNotificationCreated is enqueued for every notification to deliver
+	EventNotificationCreated = "notification.created"
+	// EventNotificationDigest is enqueued for each user with held back
+	// digest notifications
+	EventNotificationDigest = "notification.digest"
+	// EventNotificationEmail is enqueued for every notification the
+	// recipient also wants by email, when it is created, whether or not its
+	// push is held back for a digest
+	EventNotificationEmail = "notification.email"
+	// EventWebhookDelivery is enqueued for every group webhook a location
+	// update is posted to
+	EventWebhookDelivery = "webhook.delivery"
+)
+
+// LocationUpdatedEvent is the payload of EventLocationUpdated
+type LocationUpdatedEvent struct {
+	LocationID  uuid.UUID `json:"location_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	CountryCode string    `json:"country_code"`
+	Status      string    `json:"status"`
+	// FromCountryCode is set when an arrival implies leaving another country.
+	// The fan-out replaces it with the last country members were told the
+	// user arrived in.
+	FromCountryCode string `json:"from_country_code,omitempty"`
+}
+
+// NotificationCreatedEvent is the payload of EventNotificationCreated
+type NotificationCreatedEvent struct {
+	NotificationID uuid.UUID `json:"notification_id"`
+}
+
+// NotificationDigestEvent is the payload of EventNotificationDigest
+type NotificationDigestEvent struct {
+	UserID          uuid.UUID   `json:"user_id"`
+	NotificationIDs []uuid.UUID `json:"notification_ids"`
+}
+
+// NotificationEmailEvent is the payload of EventNotificationEmail
+type NotificationEmailEvent struct {
+	NotificationID uuid.UUID `json:"notification_id"`
+}
+
+// WebhookDeliveryEvent is the payload of EventWebhookDelivery. Payload is
+// the request body, rendered when the delivery is enqueued so every retry
+// posts the same content.
+type WebhookDeliveryEvent struct {
+	WebhookID uuid.UUID       `json:"webhook_id"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// ErrOutboxLeaseLost is returned when a worker touches an event whose lease
+// expired and was claimed by another worker. The other worker now owns the
+// event, so the result of this attempt must be discarded.
+var ErrOutboxLeaseLost = errors.New("outbox event lease lost")
+
+// Outbox queries
+
+// enqueueOutboxEvent inserts an outbox event as part of the given transaction
+func enqueueOutboxEvent(ctx context.Context, tx *sql.Tx, eventType string, payload any) error {
+	return enqueueOutboxEventAt(ctx, tx, eventType, payload, time.Now())
+}
+
+// enqueueOutboxEventAt inserts an outbox event that becomes ready at runAt
+func enqueueOutboxEventAt(ctx context.Context, tx *sql.Tx, eventType string, payload any, runAt time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox payload: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO outbox_events (event_type, payload, next_attempt_at)
+		VALUES ($1, $2, $3)
+	`, eventType, data, runAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to enqueue outbox event: %w", err)
+	}
+	return nil
+}
+
+// ClaimOutboxEvents locks up to limit ready events for processing. Events
+// are leased for the given duration; if the worker dies before finishing,
+// they become claimable again once the lease expires. SKIP LOCKED lets
+// several workers (and instances) claim disjoint batches concurrently.
+func (db *DB) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) ([]*OutboxEvent, error) {
+	rows, err := db.QueryContext(ctx, `
+		UPDATE outbox_events
+		SET status = 'processing',
+			attempts = attempts + 1,
+			locked_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 millisecond'
+		WHERE id IN (
+			SELECT id
+			FROM outbox_events
+			WHERE (status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP)
+			   OR (status = 'processing' AND locked_until < CURRENT_TIMESTAMP)
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at, processed_at
+	`, limit, lease.Milliseconds())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*OutboxEvent
+	for rows.Next() {
+		event := &OutboxEvent{}
+		if err := rows.Scan(&event.ID, &event.EventType, &event.Payload, &event.Status, &event.Attempts, &event.NextAttemptAt, &event.LastError, &event.CreatedAt, &event.ProcessedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ExtendOutboxLease renews the lease on a claimed event. The attempt number
+// identifies the claim: a re-claim by another worker increments it, in which
+// case ErrOutboxLeaseLost is returned.
+func (db *DB) ExtendOutboxLease(ctx context.Context, eventID uuid.UUID, attempt int, lease time.Duration) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET locked_until = CURRENT_TIMESTAMP + $3 * INTERVAL '1 millisecond'
+		WHERE id = $1 AND attempts = $2 AND status = 'processing'
+	`, eventID, attempt, lease.Milliseconds())
+
+	if err != nil {
+		return fmt.Errorf("failed to extend outbox lease: %w", err)
+	}
+	return checkOutboxClaim(result)
+}
+
+// CompleteOutboxEvent marks an event as successfully processed
+func (db *DB) CompleteOutboxEvent(ctx context.Context, eventID uuid.UUID, attempt int) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET status = 'done', locked_until = NULL, last_error = NULL, processed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND attempts = $2 AND status = 'processing'
+	`, eventID, attempt)
+
+	if err != nil {
+		return fmt.Errorf("failed to complete outbox event: %w", err)
+	}
+	return checkOutboxClaim(result)
+}
+
+// RetryOutboxEvent records a failed attempt and schedules the next one
+func (db *DB) RetryOutboxEvent(ctx context.Context, eventID uuid.UUID, attempt int, lastError string, nextAttemptAt time.Time) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET status = 'pending', locked_until = NULL, last_error = $3, next_attempt_at = $4
+		WHERE id = $1 AND attempts = $2 AND status = 'processing'
+	`, eventID, attempt, lastError, nextAttemptAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to reschedule outbox event: %w", err)
+	}
+	return checkOutboxClaim(result)
+}
+
+// DeadLetterOutboxEvent gives up on an event after its final failed attempt
+func (db *DB) DeadLetterOutboxEvent(ctx context.Context, eventID uuid.UUID, attempt int, lastError string) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET status = 'dead', locked_until = NULL, last_error = $3, processed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND attempts = $2 AND status = 'processing'
+	`, eventID, attempt, lastError)
+
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter outbox event: %w", err)
+	}
+	return checkOutboxClaim(result)
+}
+
+// PurgeOutboxEvents deletes up to limit events that were processed
+// successfully before the given time and returns how many were deleted.
+// Dead-lettered events are kept for inspection.
+func (db *DB) PurgeOutboxEvents(ctx context.Context, processedBefore time.Time, limit int) (int64, error) {
+	result, err := db.ExecContext(ctx, `
+		DELETE FROM outbox_events
+		WHERE id IN (
+			SELECT id
+			FROM outbox_events
+			WHERE status = 'done' AND processed_at < $1
+			LIMIT $2
+		)
+	`, processedBefore, limit)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox events: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox events: %w", err)
+	}
+	return n, nil
+}
+
+// checkOutboxClaim returns ErrOutboxLeaseLost if an update matched no event
+func checkOutboxClaim(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check outbox update: %w", err)
+	}
+	if n == 0 {
+		return ErrOutboxLeaseLost
+	}
+	return nil
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 )
 
@@ -17,8 +19,8 @@ func (db *DB) CreateUser(ctx context.Context, email, name string) (*User, error)
 	err := db.QueryRowContext(ctx, `
 		INSERT INTO users (email, name) 
 		VALUES ($1, $2) 
-		RETURNING id, email, name, push_token, created_at
-	`, email, name).Scan(&user.ID, &user.Email, &user.Name, &user.PushToken, &user.CreatedAt)
+		RETURNING id, COALESCE(email, ''), name, locale, created_at
+	`, email, name).Scan(&user.ID, &user.Email, &user.Name, &user.Locale, &user.CreatedAt)
 	
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
@@ -30,10 +32,10 @@ func (db *DB) CreateUser(ctx context.Context, email, name string) (*User, error)
 func (db *DB) GetUserByID(ctx context.Context, userID uuid.UUID) (*User, error) {
 	user := &User{}
 	err := db.QueryRowContext(ctx, `
-		SELECT id, email, name, push_token, created_at 
+		SELECT id, COALESCE(email, ''), name, locale, created_at 
 		FROM users 
 		WHERE id = $1
-	`, userID).Scan(&user.ID, &user.Email, &user.Name, &user.PushToken, &user.CreatedAt)
+	`, userID).Scan(&user.ID, &user.Email, &user.Name, &user.Locale, &user.CreatedAt)
 	
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -44,31 +46,80 @@ func (db *DB) GetUserByID(ctx context.Context, userID uuid.UUID) (*User, error)
 	return user, nil
 }
 
-// UpdateUserPushToken updates a user's push token
-func (db *DB) UpdateUserPushToken(ctx context.Context, userID uuid.UUID, pushToken string) error {
-	_, err := db.ExecContext(ctx, `
-		UPDATE users 
-		SET push_token = $1 
-		WHERE id = $2
-	`, pushToken, userID)
-	
+// UpsertUser creates a user with the given ID or updates their email and name.
+// An empty email is stored as NULL and keeps the email already on file, since
+// anonymous and phone sign-ins carry no email claim. If the email belongs to
+// another account the user is saved without it rather than failing.
+func (db *DB) UpsertUser(ctx context.Context, userID uuid.UUID, email, name string) (*User, error) {
+	user, err := db.upsertUser(ctx, userID, email, name)
+	if err != nil && email != "" && IsUniqueViolation(err) {
+		log.Warn().Str("user_id", userID.String()).Msg("Email is already used by another user, keeping the current email")
+		user, err = db.upsertUser(ctx, userID, "", name)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update push token: %w", err)
+		return nil, fmt.Errorf("failed to upsert user: %w", err)
 	}
-	return nil
+	return user, nil
+}
+
+// upsertUser runs the users upsert for UpsertUser
+func (db *DB) upsertUser(ctx context.Context, userID uuid.UUID, email, name string) (*User, error) {
+	user := &User{}
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO users (id, email, name)
+		VALUES ($1, NULLIF($2, ''), $3)
+		ON CONFLICT (id) DO UPDATE
+		SET email = COALESCE(EXCLUDED.email, users.email), name = EXCLUDED.name
+		RETURNING id, COALESCE(email, ''), name, locale, created_at
+	`, userID, email, name).Scan(&user.ID, &user.Email, &user.Name, &user.Locale, &user.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdateUserLocale sets the locale used for a user's notifications
+func (db *DB) UpdateUserLocale(ctx context.Context, userID uuid.UUID, locale string) (*User, error) {
+	user := &User{}
+	err := db.QueryRowContext(ctx, `
+		UPDATE users
+		SET locale = $2
+		WHERE id = $1
+		RETURNING id, COALESCE(email, ''), name, locale, created_at
+	`, userID, locale).Scan(&user.ID, &user.Email, &user.Name, &user.Locale, &user.CreatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to update user locale: %w", err)
+	}
+	return user, nil
 }
 
 // Group queries
 
-// CreateGroup creates a new group
-func (db *DB) CreateGroup(ctx context.Context, name string, createdBy uuid.UUID) (*Group, error) {
+// CreateGroup creates a new group with its creator as the owner
+func (db *DB) CreateGroup(ctx context.Context, name string, createdBy uuid.UUID, allowIDJoin, allowJoinRequests bool) (*Group, error) {
 	group := &Group{}
-	err := db.QueryRowContext(ctx, `
-		INSERT INTO groups (name, created_by) 
-		VALUES ($1, $2) 
-		RETURNING id, name, created_by, created_at
-	`, name, createdBy).Scan(&group.ID, &group.Name, &group.CreatedBy, &group.CreatedAt)
-	
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO groups (name, created_by, allow_id_join, allow_join_requests)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, name, created_by, allow_id_join, allow_join_requests, created_at
+		`, name, createdBy, allowIDJoin, allowJoinRequests).Scan(&group.ID, &group.Name, &group.CreatedBy, &group.AllowIDJoin, &group.AllowJoinRequests, &group.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO group_members (group_id, user_id, role)
+			VALUES ($1, $2, 'owner')
+		`, group.ID, createdBy)
+		return err
+	})
+
 	if err != nil {
 		return nil, fmt.Errorf("failed to create group: %w", err)
 	}
@@ -79,10 +130,10 @@ func (db *DB) CreateGroup(ctx context.Context, name string, createdBy uuid.UUID)
 func (db *DB) GetGroupByID(ctx context.Context, groupID uuid.UUID) (*Group, error) {
 	group := &Group{}
 	err := db.QueryRowContext(ctx, `
-		SELECT id, name, created_by, created_at 
+		SELECT id, name, created_by, allow_id_join, allow_join_requests, created_at 
 		FROM groups 
 		WHERE id = $1
-	`, groupID).Scan(&group.ID, &group.Name, &group.CreatedBy, &group.CreatedAt)
+	`, groupID).Scan(&group.ID, &group.Name, &group.CreatedBy, &group.AllowIDJoin, &group.AllowJoinRequests, &group.CreatedAt)
 	
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -96,7 +147,7 @@ func (db *DB) GetGroupByID(ctx context.Context, groupID uuid.UUID) (*Group, erro
 // ListUserGroups gets all groups a user is a member of
 func (db *DB) ListUserGroups(ctx context.Context, userID uuid.UUID) ([]*Group, error) {
 	rows, err := db.QueryContext(ctx, `
-		SELECT g.id, g.name, g.created_by, g.created_at 
+		SELECT g.id, g.name, g.created_by, g.allow_id_join, g.allow_join_requests, g.created_at 
 		FROM groups g 
 		INNER JOIN group_members gm ON g.id = gm.group_id 
 		WHERE gm.user_id = $1 
@@ -111,7 +162,7 @@ func (db *DB) ListUserGroups(ctx context.Context, userID uuid.UUID) ([]*Group, e
 	var groups []*Group
 	for rows.Next() {
 		group := &Group{}
-		if err := rows.Scan(&group.ID, &group.Name, &group.CreatedBy, &group.CreatedAt); err != nil {
+		if err := rows.Scan(&group.ID, &group.Name, &group.CreatedBy, &group.AllowIDJoin, &group.AllowJoinRequests, &group.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan group: %w", err)
 		}
 		groups = append(groups, group)
@@ -120,6 +171,82 @@ func (db *DB) ListUserGroups(ctx context.Context, userID uuid.UUID) ([]*Group, e
 	return groups, nil
 }
 
+// GroupUpdate describes changes to a group; nil fields are left as they are
+type GroupUpdate struct {
+	Name              *string
+	AllowIDJoin       *bool
+	AllowJoinRequests *bool
+}
+
+// UpdateGroup changes a group's name and join settings. The given
+// notifications are created in the same transaction. It returns nil if the
+// group does not exist.
+func (db *DB) UpdateGroup(ctx context.Context, groupID uuid.UUID, update GroupUpdate, notify []NewNotification) (*Group, error) {
+	var group *Group
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		g := &Group{}
+		err := tx.QueryRowContext(ctx, `
+			UPDATE groups
+			SET name = COALESCE($2, name),
+				allow_id_join = COALESCE($3, allow_id_join),
+				allow_join_requests = COALESCE($4, allow_join_requests)
+			WHERE id = $1
+			RETURNING id, name, created_by, allow_id_join, allow_join_requests, created_at
+		`, groupID, update.Name, update.AllowIDJoin, update.AllowJoinRequests).Scan(&g.ID, &g.Name, &g.CreatedBy, &g.AllowIDJoin, &g.AllowJoinRequests, &g.CreatedAt)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := createNotifications(ctx, tx, nil, notify); err != nil {
+			return err
+		}
+		group = g
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update group: %w", err)
+	}
+	return group, nil
+}
+
+// DeleteGroup deletes a group with its memberships and invites. The given
+// notifications are created in the same transaction and keep their title
+// after the group is gone. It returns false if the group does not exist.
+func (db *DB) DeleteGroup(ctx context.Context, groupID uuid.UUID, notify []NewNotification) (bool, error) {
+	deleted := false
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		// Lock the group so members can't join while it is being deleted
+		var id uuid.UUID
+		err := tx.QueryRowContext(ctx, `SELECT id FROM groups WHERE id = $1 FOR UPDATE`, groupID).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Notifications must exist before the delete, which detaches them
+		if _, err := createNotifications(ctx, tx, nil, notify); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM groups WHERE id = $1`, groupID); err != nil {
+			return err
+		}
+
+		deleted = true
+		return nil
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("failed to delete group: %w", err)
+	}
+	return deleted, nil
+}
+
 // GroupMember queries
 
 // AddGroupMember adds a user to a group
@@ -136,13 +263,47 @@ func (db *DB) AddGroupMember(ctx context.Context, groupID, userID uuid.UUID) err
 	return nil
 }
 
-// GetGroupMembers gets all members of a group
-func (db *DB) GetGroupMembers(ctx context.Context, groupID uuid.UUID) ([]*User, error) {
+// IsGroupMember reports whether a user belongs to a group
+func (db *DB) IsGroupMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM group_members WHERE group_id = $1 AND user_id = $2
+		)
+	`, groupID, userID).Scan(&exists)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to check group membership: %w", err)
+	}
+	return exists, nil
+}
+
+// GetGroupMember gets a user's membership in a group
+func (db *DB) GetGroupMember(ctx context.Context, groupID, userID uuid.UUID) (*GroupMember, error) {
+	member := &GroupMember{}
+	err := db.QueryRowContext(ctx, `
+		SELECT id, group_id, user_id, role, muted_until, notify_on, delivery, email_notifications, created_at
+		FROM group_members
+		WHERE group_id = $1 AND user_id = $2
+	`, groupID, userID).Scan(&member.ID, &member.GroupID, &member.UserID, &member.Role, &member.MutedUntil, &member.NotifyOn, &member.Delivery, &member.Email, &member.CreatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get group member: %w", err)
+	}
+	return member, nil
+}
+
+// GetGroupMembers gets all members of a group, owner and admins first
+func (db *DB) GetGroupMembers(ctx context.Context, groupID uuid.UUID) ([]*Member, error) {
 	rows, err := db.QueryContext(ctx, `
-		SELECT u.id, u.email, u.name, u.push_token, u.created_at 
+		SELECT u.id, COALESCE(u.email, ''), u.name, u.locale, u.created_at, gm.role, gm.created_at 
 		FROM users u 
 		INNER JOIN group_members gm ON u.id = gm.user_id 
 		WHERE gm.group_id = $1
+		ORDER BY CASE gm.role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, gm.created_at
 	`, groupID)
 	
 	if err != nil {
@@ -150,44 +311,601 @@ func (db *DB) GetGroupMembers(ctx context.Context, groupID uuid.UUID) ([]*User,
 	}
 	defer rows.Close()
 	
-	var users []*User
+	var members []*Member
 	for rows.Next() {
-		user := &User{}
-		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.PushToken, &user.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan user: %w", err)
+		member := &Member{}
+		if err := rows.Scan(&member.ID, &member.Email, &member.Name, &member.Locale, &member.CreatedAt, &member.Role, &member.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan group member: %w", err)
 		}
-		users = append(users, user)
+		members = append(members, member)
 	}
 	
-	return users, nil
+	return members, nil
+}
+
+// ListGroupRecipients lists the members of a group with their notification
+// preferences, locale, country watchlist and current country, for fanning
+// out notifications
+func (db *DB) ListGroupRecipients(ctx context.Context, groupID uuid.UUID) ([]*Recipient, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT gm.user_id, u.locale, gm.muted_until, gm.notify_on, gm.delivery, gm.email_notifications,
+			w.id, w.group_id, w.country_codes, w.same_country, w.updated_at, loc.country_code
+		FROM group_members gm
+		INNER JOIN users u ON u.id = gm.user_id
+		LEFT JOIN LATERAL (
+			-- The group's watchlist replaces the global one
+			SELECT id, group_id, country_codes, same_country, updated_at
+			FROM country_watchlists
+			WHERE user_id = gm.user_id AND (group_id = gm.group_id OR group_id IS NULL)
+			ORDER BY group_id NULLS LAST
+			LIMIT 1
+		) w ON true
+		LEFT JOIN user_current_location loc ON loc.user_id = gm.user_id AND loc.status = 'arrived'
+		WHERE gm.group_id = $1
+	`, groupID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var recipients []*Recipient
+	for rows.Next() {
+		r := &Recipient{}
+		var (
+			watchlistID  *uuid.UUID
+			watchGroupID *uuid.UUID
+			countryCodes []string
+			sameCountry  sql.NullBool
+			updatedAt    sql.NullTime
+			countryCode  sql.NullString
+		)
+		if err := rows.Scan(&r.UserID, &r.Locale, &r.MutedUntil, &r.NotifyOn, &r.Delivery, &r.Email,
+			&watchlistID, &watchGroupID, pq.Array(&countryCodes), &sameCountry, &updatedAt, &countryCode); err != nil {
+			return nil, fmt.Errorf("failed to scan group recipient: %w", err)
+		}
+		r.CountryCode = countryCode.String
+		if watchlistID != nil {
+			r.Watchlist = &CountryWatchlist{
+				ID:           *watchlistID,
+				UserID:       r.UserID,
+				GroupID:      watchGroupID,
+				CountryCodes: countryCodes,
+				SameCountry:  sameCountry.Bool,
+				UpdatedAt:    updatedAt.Time,
+			}
+		}
+		recipients = append(recipients, r)
+	}
+
+	return recipients, nil
+}
+
+// UpdateGroupMemberPreferences replaces a member's notification preferences.
+// It returns nil if the user is not a member of the group.
+func (db *DB) UpdateGroupMemberPreferences(ctx context.Context, groupID, userID uuid.UUID, prefs NotificationPreferences) (*GroupMember, error) {
+	member := &GroupMember{}
+	err := db.QueryRowContext(ctx, `
+		UPDATE group_members
+		SET muted_until = $3, notify_on = $4, delivery = $5, email_notifications = $6
+		WHERE group_id = $1 AND user_id = $2
+		RETURNING id, group_id, user_id, role, muted_until, notify_on, delivery, email_notifications, created_at
+	`, groupID, userID, prefs.MutedUntil, prefs.NotifyOn, prefs.Delivery, prefs.Email).Scan(&member.ID, &member.GroupID, &member.UserID, &member.Role, &member.MutedUntil, &member.NotifyOn, &member.Delivery, &member.Email, &member.CreatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to update notification preferences: %w", err)
+	}
+	return member, nil
+}
+
+// RemoveGroupMember removes a user from a group. The owner cannot be
+// removed, so a group always keeps its owner. The given notifications are
+// created in the same transaction. It returns false if the user is not a
+// non-owner member of the group.
+func (db *DB) RemoveGroupMember(ctx context.Context, groupID, userID uuid.UUID, notify []NewNotification) (bool, error) {
+	removed := false
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			DELETE FROM group_members
+			WHERE group_id = $1 AND user_id = $2 AND role <> 'owner'
+		`, groupID, userID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil || affected == 0 {
+			return err
+		}
+
+		if _, err := createNotifications(ctx, tx, nil, notify); err != nil {
+			return err
+		}
+		removed = true
+		return nil
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("failed to remove group member: %w", err)
+	}
+	return removed, nil
+}
+
+// UpdateGroupMemberRole changes a member's role. The owner's role cannot be
+// changed this way; use TransferGroupOwnership. It returns false if the
+// user is not a non-owner member of the group.
+func (db *DB) UpdateGroupMemberRole(ctx context.Context, groupID, userID uuid.UUID, role string) (bool, error) {
+	result, err := db.ExecContext(ctx, `
+		UPDATE group_members
+		SET role = $3
+		WHERE group_id = $1 AND user_id = $2 AND role <> 'owner'
+	`, groupID, userID, role)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to update group member role: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update group member role: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// TransferGroupOwnership makes another member the owner and demotes the
+// current owner to admin, in one transaction so the group is never without
+// an owner. Both member rows are locked first, so the new owner cannot leave
+// or be removed halfway. It returns false if fromUserID is not the owner or
+// toUserID is not a member.
+func (db *DB) TransferGroupOwnership(ctx context.Context, groupID, fromUserID, toUserID uuid.UUID) (bool, error) {
+	transferred := false
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			SELECT user_id, role
+			FROM group_members
+			WHERE group_id = $1 AND user_id IN ($2, $3)
+			ORDER BY user_id
+			FOR UPDATE
+		`, groupID, fromUserID, toUserID)
+		if err != nil {
+			return err
+		}
+		roles := make(map[uuid.UUID]string, 2)
+		for rows.Next() {
+			var userID uuid.UUID
+			var role string
+			if err := rows.Scan(&userID, &role); err != nil {
+				rows.Close()
+				return err
+			}
+			roles[userID] = role
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if _, ok := roles[toUserID]; !ok || roles[fromUserID] != RoleOwner {
+			return nil
+		}
+
+		if err := setGroupMemberRole(ctx, tx, groupID, fromUserID, RoleAdmin); err != nil {
+			return err
+		}
+		if err := setGroupMemberRole(ctx, tx, groupID, toUserID, RoleOwner); err != nil {
+			return err
+		}
+
+		transferred = true
+		return nil
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("failed to transfer group ownership: %w", err)
+	}
+	return transferred, nil
+}
+
+// setGroupMemberRole updates a locked member row as part of the given
+// transaction, failing unless exactly that row was changed
+func setGroupMemberRole(ctx context.Context, tx *sql.Tx, groupID, userID uuid.UUID, role string) error {
+	result, err := tx.ExecContext(ctx, `
+		UPDATE group_members
+		SET role = $3
+		WHERE group_id = $1 AND user_id = $2
+	`, groupID, userID, role)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		return fmt.Errorf("expected to update 1 group member, updated %d", affected)
+	}
+	return nil
+}
+
+// Device queries
+
+// UpsertDevice registers a push token for a user. A token that was
+// previously registered (possibly by another user) is moved to this user
+// and re-enabled.
+func (db *DB) UpsertDevice(ctx context.Context, userID uuid.UUID, pushToken, tokenType, platform string, appVersion *string) (*Device, error) {
+	device := &Device{}
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO devices (user_id, push_token, token_type, platform, app_version)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (push_token) DO UPDATE
+		SET user_id = EXCLUDED.user_id,
+			token_type = EXCLUDED.token_type,
+			platform = EXCLUDED.platform,
+			app_version = EXCLUDED.app_version,
+			last_seen_at = CURRENT_TIMESTAMP,
+			disabled_at = NULL
+		RETURNING id, user_id, push_token, token_type, platform, app_version, last_seen_at, disabled_at, created_at
+	`, userID, pushToken, tokenType, platform, appVersion).Scan(&device.ID, &device.UserID, &device.PushToken, &device.TokenType, &device.Platform, &device.AppVersion, &device.LastSeenAt, &device.DisabledAt, &device.CreatedAt)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert device: %w", err)
+	}
+	return device, nil
+}
+
+// DeleteDevice removes a user's push token, returning false if it was not found
+func (db *DB) DeleteDevice(ctx context.Context, userID uuid.UUID, pushToken string) (bool, error) {
+	result, err := db.ExecContext(ctx, `
+		DELETE FROM devices
+		WHERE user_id = $1 AND push_token = $2
+	`, userID, pushToken)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to delete device: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete device: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ListUserDevices gets all devices registered by a user
+func (db *DB) ListUserDevices(ctx context.Context, userID uuid.UUID) ([]*Device, error) {
+	return db.queryDevices(ctx, `
+		SELECT id, user_id, push_token, token_type, platform, app_version, last_seen_at, disabled_at, created_at
+		FROM devices
+		WHERE user_id = $1
+		ORDER BY last_seen_at DESC
+	`, userID)
+}
+
+// ListActiveUserDevices gets the devices of a user that can receive pushes
+func (db *DB) ListActiveUserDevices(ctx context.Context, userID uuid.UUID) ([]*Device, error) {
+	return db.queryDevices(ctx, `
+		SELECT id, user_id, push_token, token_type, platform, app_version, last_seen_at, disabled_at, created_at
+		FROM devices
+		WHERE user_id = $1 AND disabled_at IS NULL
+		ORDER BY last_seen_at DESC
+	`, userID)
+}
+
+// DisableDevice stops pushes to a device whose token is no longer valid
+func (db *DB) DisableDevice(ctx context.Context, deviceID uuid.UUID) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE devices
+		SET disabled_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND disabled_at IS NULL
+	`, deviceID)
+
+	if err != nil {
+		return fmt.Errorf("failed to disable device: %w", err)
+	}
+	return nil
+}
+
+// queryDevices runs a devices query and scans the result
+func (db *DB) queryDevices(ctx context.Context, query string, args ...any) ([]*Device, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []*Device
+	for rows.Next() {
+		device := &Device{}
+		if err := rows.Scan(&device.ID, &device.UserID, &device.PushToken, &device.TokenType, &device.Platform, &device.AppVersion, &device.LastSeenAt, &device.DisabledAt, &device.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// PushTicket queries
+
+// CreatePushTicket records the result of sending a push message to a device.
+// It returns nil if the device already has a ticket for the notification.
+func (db *DB) CreatePushTicket(ctx context.Context, t NewPushTicket) (*PushTicket, error) {
+	ticket := &PushTicket{}
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO push_tickets (notification_id, device_id, ticket_id, status, error, receipt_status, receipt_checked_at)
+		VALUES ($1, $2, $3, $4, $5, $6::varchar, CASE WHEN $6::varchar IS NOT NULL THEN CURRENT_TIMESTAMP END)
+		ON CONFLICT (notification_id, device_id) WHERE notification_id IS NOT NULL DO NOTHING
+		RETURNING id, notification_id, device_id, ticket_id, status, error, receipt_status, receipt_error, receipt_checked_at, created_at
+	`, t.NotificationID, t.DeviceID, t.TicketID, t.Status, t.Error, t.ReceiptStatus).Scan(&ticket.ID, &ticket.NotificationID, &ticket.DeviceID, &ticket.TicketID, &ticket.Status, &ticket.Error, &ticket.ReceiptStatus, &ticket.ReceiptError, &ticket.ReceiptCheckedAt, &ticket.CreatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to create push ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// ListTicketedDeviceIDs lists the devices that already have a push ticket for
+// any of the given notifications, i.e. were pushed to by an earlier attempt
+func (db *DB) ListTicketedDeviceIDs(ctx context.Context, notificationIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(notificationIDs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(notificationIDs))
+	for i, id := range notificationIDs {
+		ids[i] = id.String()
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT DISTINCT device_id
+		FROM push_tickets
+		WHERE notification_id = ANY($1::uuid[])
+	`, pq.Array(ids))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ticketed devices: %w", err)
+	}
+	defer rows.Close()
+
+	var deviceIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan ticketed device: %w", err)
+		}
+		deviceIDs = append(deviceIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list ticketed devices: %w", err)
+	}
+	return deviceIDs, nil
+}
+
+// ClaimPendingPushTickets gets successfully sent tickets created before the
+// given time whose receipt has not been fetched yet, least recently checked
+// first. Returned tickets are marked as checked, so tickets whose receipt is
+// not ready yet move to the back of the queue instead of starving newer ones.
+func (db *DB) ClaimPendingPushTickets(ctx context.Context, createdBefore time.Time, limit int) ([]*PushTicket, error) {
+	rows, err := db.QueryContext(ctx, `
+		UPDATE push_tickets
+		SET receipt_checked_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id
+			FROM push_tickets
+			WHERE status = 'ok' AND receipt_status IS NULL AND created_at < $1
+			ORDER BY receipt_checked_at NULLS FIRST, created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, notification_id, device_id, ticket_id, status, error, receipt_status, receipt_error, receipt_checked_at, created_at
+	`, createdBefore, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending push tickets: %w", err)
+	}
+	defer rows.Close()
+
+	var tickets []*PushTicket
+	for rows.Next() {
+		ticket := &PushTicket{}
+		if err := rows.Scan(&ticket.ID, &ticket.NotificationID, &ticket.DeviceID, &ticket.TicketID, &ticket.Status, &ticket.Error, &ticket.ReceiptStatus, &ticket.ReceiptError, &ticket.ReceiptCheckedAt, &ticket.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan push ticket: %w", err)
+		}
+		tickets = append(tickets, ticket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim pending push tickets: %w", err)
+	}
+
+	return tickets, nil
+}
+
+// ExpirePushTickets marks pending tickets created before the given time as
+// expired and returns the notifications they belong to
+func (db *DB) ExpirePushTickets(ctx context.Context, createdBefore time.Time) ([]uuid.UUID, error) {
+	rows, err := db.QueryContext(ctx, `
+		UPDATE push_tickets
+		SET receipt_status = 'expired', receipt_checked_at = CURRENT_TIMESTAMP
+		WHERE status = 'ok' AND receipt_status IS NULL AND created_at < $1
+		RETURNING notification_id
+	`, createdBefore)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire push tickets: %w", err)
+	}
+	defer rows.Close()
+
+	seen := make(map[uuid.UUID]struct{})
+	var notificationIDs []uuid.UUID
+	for rows.Next() {
+		var notificationID *uuid.UUID
+		if err := rows.Scan(&notificationID); err != nil {
+			return nil, fmt.Errorf("failed to scan push ticket: %w", err)
+		}
+		if notificationID == nil {
+			continue
+		}
+		if _, ok := seen[*notificationID]; !ok {
+			seen[*notificationID] = struct{}{}
+			notificationIDs = append(notificationIDs, *notificationID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to expire push tickets: %w", err)
+	}
+
+	return notificationIDs, nil
+}
+
+// UpdatePushTicketReceipt records the receipt for a ticket
+func (db *DB) UpdatePushTicketReceipt(ctx context.Context, ticketID uuid.UUID, receiptStatus string, receiptError *string) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE push_tickets
+		SET receipt_status = $1, receipt_error = $2, receipt_checked_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, receiptStatus, receiptError, ticketID)
+
+	if err != nil {
+		return fmt.Errorf("failed to update push ticket receipt: %w", err)
+	}
+	return nil
+}
+
+// RefreshNotificationDeliveryStatus recomputes the delivery status of the
+// given notifications from their push tickets
+func (db *DB) RefreshNotificationDeliveryStatus(ctx context.Context, notificationIDs []uuid.UUID) error {
+	if len(notificationIDs) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(notificationIDs))
+	for i, id := range notificationIDs {
+		ids[i] = id.String()
+	}
+
+	_, err := db.ExecContext(ctx, `
+		UPDATE notifications n
+		SET delivery_status = CASE
+			WHEN EXISTS (SELECT 1 FROM push_tickets t WHERE t.notification_id = n.id AND t.receipt_status = 'ok') THEN 'delivered'
+			WHEN EXISTS (SELECT 1 FROM push_tickets t WHERE t.notification_id = n.id AND t.status = 'ok' AND t.receipt_status IS NULL) THEN 'pending'
+			WHEN EXISTS (SELECT 1 FROM push_tickets t WHERE t.notification_id = n.id) THEN 'failed'
+			ELSE 'none'
+		END
+		WHERE n.id = ANY($1::uuid[])
+	`, pq.Array(ids))
+
+	if err != nil {
+		return fmt.Errorf("failed to refresh notification delivery status: %w", err)
+	}
+	return nil
 }
 
 // UserLocation queries
 
-// CreateUserLocation creates a new location update
-func (db *DB) CreateUserLocation(ctx context.Context, userID uuid.UUID, countryCode, status string) (*UserLocation, error) {
+// CreateUserLocation creates a new location update and enqueues a
+// location.updated outbox event in the same transaction. The event is held
+// back until notifyAt, which lets a later update supersede it.
+func (db *DB) CreateUserLocation(ctx context.Context, userID uuid.UUID, countryCode, status string, notifyAt time.Time) (*UserLocation, error) {
+	var location *UserLocation
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		location, err = insertUserLocation(ctx, tx, userID, countryCode, status)
+		if err != nil {
+			return err
+		}
+
+		return enqueueOutboxEventAt(ctx, tx, EventLocationUpdated, LocationUpdatedEvent{
+			LocationID:  location.ID,
+			UserID:      location.UserID,
+			CountryCode: location.CountryCode,
+			Status:      location.Status,
+		}, notifyAt)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user location: %w", err)
+	}
+	return location, nil
+}
+
+// CreateUserLocationChange records a move from one country to another as a
+// "left" row followed by an "arrived" row, in one transaction. A single
+// location.updated event is enqueued for the arrival, carrying the country
+// that was left; the fan-out announces the last country members heard about
+// instead if they differ. An empty fromCountryCode records only the arrival.
+func (db *DB) CreateUserLocationChange(ctx context.Context, userID uuid.UUID, fromCountryCode, toCountryCode string, notifyAt time.Time) ([]*UserLocation, error) {
+	var locations []*UserLocation
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		if fromCountryCode != "" {
+			left, err := insertUserLocation(ctx, tx, userID, fromCountryCode, "left")
+			if err != nil {
+				return err
+			}
+			locations = append(locations, left)
+		}
+
+		arrived, err := insertUserLocation(ctx, tx, userID, toCountryCode, "arrived")
+		if err != nil {
+			return err
+		}
+		locations = append(locations, arrived)
+
+		return enqueueOutboxEventAt(ctx, tx, EventLocationUpdated, LocationUpdatedEvent{
+			LocationID:      arrived.ID,
+			UserID:          arrived.UserID,
+			CountryCode:     arrived.CountryCode,
+			Status:          arrived.Status,
+			FromCountryCode: fromCountryCode,
+		}, notifyAt)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user location change: %w", err)
+	}
+	return locations, nil
+}
+
+// insertUserLocation inserts a location row as part of the given transaction
+// and makes it the user's current location. clock_timestamp() keeps rows
+// written in the same transaction ordered.
+func insertUserLocation(ctx context.Context, tx *sql.Tx, userID uuid.UUID, countryCode, status string) (*UserLocation, error) {
 	location := &UserLocation{}
-	err := db.QueryRowContext(ctx, `
-		INSERT INTO user_locations (user_id, country_code, status) 
-		VALUES ($1, $2, $3) 
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO user_locations (user_id, country_code, status, updated_at)
+		VALUES ($1, $2, $3, clock_timestamp())
 		RETURNING id, user_id, country_code, status, updated_at
 	`, userID, countryCode, status).Scan(&location.ID, &location.UserID, &location.CountryCode, &location.Status, &location.UpdatedAt)
-	
+
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user location: %w", err)
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO user_current_location (user_id, location_id, country_code, status, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET location_id = EXCLUDED.location_id, country_code = EXCLUDED.country_code,
+			status = EXCLUDED.status, updated_at = EXCLUDED.updated_at
+		WHERE user_current_location.updated_at <= EXCLUDED.updated_at
+	`, location.UserID, location.ID, location.CountryCode, location.Status, location.UpdatedAt); err != nil {
+		return nil, err
 	}
 	return location, nil
 }
 
-// GetLatestUserLocation gets the latest location for a user
+// GetLatestUserLocation gets the latest location for a user, as kept in
+// user_current_location
 func (db *DB) GetLatestUserLocation(ctx context.Context, userID uuid.UUID) (*UserLocation, error) {
 	location := &UserLocation{}
 	err := db.QueryRowContext(ctx, `
-		SELECT id, user_id, country_code, status, updated_at 
-		FROM user_locations 
-		WHERE user_id = $1 
-		ORDER BY updated_at DESC 
-		LIMIT 1
+		SELECT location_id, user_id, country_code, status, updated_at
+		FROM user_current_location
+		WHERE user_id = $1
 	`, userID).Scan(&location.ID, &location.UserID, &location.CountryCode, &location.Status, &location.UpdatedAt)
 	
 	if err != nil {
@@ -199,59 +917,485 @@ func (db *DB) GetLatestUserLocation(ctx context.Context, userID uuid.UUID) (*Use
 	return location, nil
 }
 
-// Notification queries
+// GetUserLocation gets a single location update by ID
+func (db *DB) GetUserLocation(ctx context.Context, locationID uuid.UUID) (*UserLocation, error) {
+	location := &UserLocation{}
+	err := db.QueryRowContext(ctx, `
+		SELECT id, user_id, country_code, status, updated_at
+		FROM user_locations
+		WHERE id = $1
+	`, locationID).Scan(&location.ID, &location.UserID, &location.CountryCode, &location.Status, &location.UpdatedAt)
 
-// CreateNotification creates a new notification
-func (db *DB) CreateNotification(ctx context.Context, userID, groupID uuid.UUID, message string) (*Notification, error) {
-	notification := &Notification{}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user location: %w", err)
+	}
+	return location, nil
+}
+
+// GetNextUserLocation gets the location update the user made right after the
+// given one, or nil if it is still their latest
+func (db *DB) GetNextUserLocation(ctx context.Context, location *UserLocation) (*UserLocation, error) {
+	next := &UserLocation{}
 	err := db.QueryRowContext(ctx, `
-		INSERT INTO notifications (user_id, group_id, message) 
-		VALUES ($1, $2, $3) 
-		RETURNING id, user_id, group_id, message, created_at
-	`, userID, groupID, message).Scan(&notification.ID, &notification.UserID, &notification.GroupID, &notification.Message, &notification.CreatedAt)
-	
+		SELECT id, user_id, country_code, status, updated_at
+		FROM user_locations
+		WHERE user_id = $1 AND (updated_at, id) > ($2, $3::uuid)
+		ORDER BY updated_at, id
+		LIMIT 1
+	`, location.UserID, location.UpdatedAt, location.ID).Scan(&next.ID, &next.UserID, &next.CountryCode, &next.Status, &next.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get next user location: %w", err)
+	}
+	return next, nil
+}
+
+// ListUserLocations lists a user's location history newest first, starting
+// after the given cursor. The returned cursor is nil on the last page.
+func (db *DB) ListUserLocations(ctx context.Context, userID uuid.UUID, after *Cursor, limit int) ([]*UserLocation, *Cursor, error) {
+	afterTime, afterID := cursorArgs(after)
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, user_id, country_code, status, updated_at
+		FROM user_locations
+		WHERE user_id = $1 AND ($2::timestamptz IS NULL OR (updated_at, id) < ($2, $3::uuid))
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $4
+	`, userID, afterTime, afterID, limit+1)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list user locations: %w", err)
+	}
+	defer rows.Close()
+
+	var locations []*UserLocation
+	for rows.Next() {
+		location := &UserLocation{}
+		if err := rows.Scan(&location.ID, &location.UserID, &location.CountryCode, &location.Status, &location.UpdatedAt); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan user location: %w", err)
+		}
+		locations = append(locations, location)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to list user locations: %w", err)
+	}
+
+	// The extra row only tells whether there is another page
+	if len(locations) <= limit {
+		return locations, nil, nil
+	}
+	locations = locations[:limit]
+	last := locations[limit-1]
+	return locations, &Cursor{Time: last.UpdatedAt, ID: last.ID}, nil
+}
+
+// ListGroupPresence lists where every member of a group currently is,
+// ordered by name
+func (db *DB) ListGroupPresence(ctx context.Context, groupID uuid.UUID) ([]*Presence, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT u.id, u.name, loc.country_code, loc.updated_at
+		FROM group_members gm
+		INNER JOIN users u ON u.id = gm.user_id
+		LEFT JOIN user_current_location loc ON loc.user_id = gm.user_id AND loc.status = 'arrived'
+		WHERE gm.group_id = $1
+		ORDER BY u.name
+	`, groupID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group presence: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPresence(rows)
+}
+
+// ListCountryPresence lists the users who share a group with userID and are
+// currently in the given country, most recent arrivals first
+func (db *DB) ListCountryPresence(ctx context.Context, userID uuid.UUID, countryCode string) ([]*Presence, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT u.id, u.name, loc.country_code, loc.updated_at
+		FROM user_current_location loc
+		INNER JOIN users u ON u.id = loc.user_id
+		WHERE loc.country_code = $2 AND loc.status = 'arrived' AND u.id <> $1 AND EXISTS (
+			SELECT 1
+			FROM group_members mine
+			INNER JOIN group_members theirs ON theirs.group_id = mine.group_id
+			WHERE mine.user_id = $1 AND theirs.user_id = u.id
+		)
+		ORDER BY loc.updated_at DESC
+	`, userID, countryCode)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list country presence: %w", err)
+	}
+	defer rows.Close()
+
+	return scanPresence(rows)
+}
+
+// ListGroupMateIDs lists the users who share at least one group with userID
+func (db *DB) ListGroupMateIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT DISTINCT theirs.user_id
+		FROM group_members mine
+		INNER JOIN group_members theirs ON theirs.group_id = mine.group_id
+		WHERE mine.user_id = $1 AND theirs.user_id <> $1
+	`, userID)
+
 	if err != nil {
-		return nil, fmt.Errorf("failed to create notification: %w", err)
+		return nil, fmt.Errorf("failed to list group mates: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan group mate: %w", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, nil
+}
+
+// scanPresence scans rows of user ID, name, country code and since
+func scanPresence(rows *sql.Rows) ([]*Presence, error) {
+	var presence []*Presence
+	for rows.Next() {
+		p := &Presence{}
+		if err := rows.Scan(&p.UserID, &p.Name, &p.CountryCode, &p.Since); err != nil {
+			return nil, fmt.Errorf("failed to scan presence: %w", err)
+		}
+		presence = append(presence, p)
+	}
+	return presence, nil
+}
+
+// Notification queries
+
+// notificationColumns selects a notification together with all its groups
+const notificationColumns = `id, user_id, group_id,
+	ARRAY(SELECT ng.group_id FROM notification_groups ng WHERE ng.notification_id = notifications.id),
+	location_event_id, type, title, message, delivery, delivery_status, read_at, created_at`
+
+// NewNotification describes a notification to create
+type NewNotification struct {
+	UserID  uuid.UUID
+	GroupID uuid.UUID
+	// OtherGroupIDs are further groups the notification is about, e.g. every
+	// group the recipient shares with a traveler
+	OtherGroupIDs []uuid.UUID
+	Type          string
+	Title         string
+	Message       string
+	// Digest holds the notification for the next digest instead of pushing it
+	Digest bool
+	// Email also sends the notification to the recipient by email. Emails
+	// go out as soon as the notification is created, even with Digest set:
+	// the digest only bundles pushes.
+	Email bool
+}
+
+// CreateNotifications creates notifications and enqueues a
+// notification.created outbox event for each, all in one transaction
+func (db *DB) CreateNotifications(ctx context.Context, newNotifications []NewNotification) ([]*Notification, error) {
+	var notifications []*Notification
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		notifications, err = createNotifications(ctx, tx, nil, newNotifications)
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// createNotifications creates notifications and their outbox events as part
+// of the given transaction, so they are only sent if the change they
+// describe is committed. locationEventID links them to the location update
+// they announce, if any.
+func createNotifications(ctx context.Context, tx *sql.Tx, locationEventID *uuid.UUID, newNotifications []NewNotification) ([]*Notification, error) {
+	notifications := make([]*Notification, 0, len(newNotifications))
+	for _, n := range newNotifications {
+		delivery := DeliveryInstant
+		if n.Digest {
+			delivery = DeliveryDigest
+		}
+
+		notification := &Notification{}
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO notifications (user_id, group_id, location_event_id, type, title, message, delivery)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, user_id, group_id, location_event_id, type, title, message, delivery, delivery_status, read_at, created_at
+		`, n.UserID, n.GroupID, locationEventID, n.Type, n.Title, n.Message, delivery).Scan(&notification.ID, &notification.UserID, &notification.GroupID, &notification.LocationEventID, &notification.Type, &notification.Title, &notification.Message, &notification.Delivery, &notification.DeliveryStatus, &notification.ReadAt, &notification.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		notification.GroupIDs = append([]uuid.UUID{n.GroupID}, n.OtherGroupIDs...)
+		for _, groupID := range notification.GroupIDs {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO notification_groups (notification_id, group_id)
+				VALUES ($1, $2)
+				ON CONFLICT DO NOTHING
+			`, notification.ID, groupID); err != nil {
+				return nil, err
+			}
+		}
+
+		if !n.Digest {
+			if err := enqueueOutboxEvent(ctx, tx, EventNotificationCreated, NotificationCreatedEvent{NotificationID: notification.ID}); err != nil {
+				return nil, err
+			}
+		}
+		// Email ignores the digest setting, see NewNotification.Email
+		if n.Email {
+			if err := enqueueOutboxEvent(ctx, tx, EventNotificationEmail, NotificationEmailEvent{NotificationID: notification.ID}); err != nil {
+				return nil, err
+			}
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
+}
+
+// GetNotificationByID gets a notification by ID
+func (db *DB) GetNotificationByID(ctx context.Context, notificationID uuid.UUID) (*Notification, error) {
+	notification, err := scanNotification(db.QueryRowContext(ctx, `
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE id = $1
+	`, notificationID))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get notification: %w", err)
 	}
 	return notification, nil
 }
 
-// ListUserNotifications gets notifications for a user
-func (db *DB) ListUserNotifications(ctx context.Context, userID uuid.UUID, limit int) ([]*Notification, error) {
+// NotificationFilter narrows down a user's notifications. Zero values
+// match everything.
+type NotificationFilter struct {
+	GroupID *uuid.UUID
+	Since   *time.Time // created at or after
+}
+
+// ListUserNotifications gets notifications for a user newest first,
+// starting after the given cursor. The returned cursor is nil on the last
+// page.
+func (db *DB) ListUserNotifications(ctx context.Context, userID uuid.UUID, filter NotificationFilter, after *Cursor, limit int) ([]*Notification, *Cursor, error) {
+	afterTime, afterID := cursorArgs(after)
 	rows, err := db.QueryContext(ctx, `
-		SELECT n.id, n.user_id, n.group_id, n.message, n.created_at, g.name as group_name
-		FROM notifications n
-		INNER JOIN groups g ON n.group_id = g.id
-		WHERE n.user_id = $1 
-		ORDER BY n.created_at DESC 
-		LIMIT $2
-	`, userID, limit)
-	
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE user_id = $1
+			AND ($2::uuid IS NULL OR EXISTS (
+				SELECT 1 FROM notification_groups ng WHERE ng.notification_id = notifications.id AND ng.group_id = $2
+			))
+			AND ($3::timestamptz IS NULL OR created_at >= $3)
+			AND ($4::timestamptz IS NULL OR (created_at, id) < ($4, $5::uuid))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $6
+	`, userID, filter.GroupID, filter.Since, afterTime, afterID, limit+1)
+
 	if err != nil {
-		return nil, fmt.Errorf("failed to list user notifications: %w", err)
+		return nil, nil, fmt.Errorf("failed to list user notifications: %w", err)
 	}
 	defer rows.Close()
-	
-	type NotificationWithGroup struct {
-		Notification
-		GroupName string `json:"group_name"`
+
+	var notifications []*Notification
+	for rows.Next() {
+		notif, err := scanNotification(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, notif)
 	}
-	
-	var notifications []*NotificationWithGroup
+
+	// The extra row only tells whether there is another page
+	if len(notifications) <= limit {
+		return notifications, nil, nil
+	}
+	notifications = notifications[:limit]
+	last := notifications[limit-1]
+	return notifications, &Cursor{Time: last.CreatedAt, ID: last.ID}, nil
+}
+
+// CountUnreadNotifications counts a user's unread notifications
+func (db *DB) CountUnreadNotifications(ctx context.Context, userID uuid.UUID, filter NotificationFilter) (int, error) {
+	var count int
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL
+			AND ($2::uuid IS NULL OR EXISTS (
+				SELECT 1 FROM notification_groups ng WHERE ng.notification_id = notifications.id AND ng.group_id = $2
+			))
+			AND ($3::timestamptz IS NULL OR created_at >= $3)
+	`, userID, filter.GroupID, filter.Since).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkNotificationsRead marks the given notifications of a user as read and
+// returns how many were unread
+func (db *DB) MarkNotificationsRead(ctx context.Context, userID uuid.UUID, notificationIDs []uuid.UUID) (int64, error) {
+	ids := make([]string, len(notificationIDs))
+	for i, id := range notificationIDs {
+		ids[i] = id.String()
+	}
+
+	result, err := db.ExecContext(ctx, `
+		UPDATE notifications
+		SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND id = ANY($2::uuid[]) AND read_at IS NULL
+	`, userID, pq.Array(ids))
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	return affected, nil
+}
+
+// MarkNotificationsReadUpTo marks a notification and every older one of the
+// user as read, in list order. It returns how many were unread, and false
+// if the notification doesn't exist or belongs to someone else.
+func (db *DB) MarkNotificationsReadUpTo(ctx context.Context, userID, notificationID uuid.UUID) (int64, bool, error) {
+	var affected int64
+	found := false
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		var createdAt time.Time
+		err := tx.QueryRowContext(ctx, `
+			SELECT created_at FROM notifications WHERE id = $1 AND user_id = $2
+		`, notificationID, userID).Scan(&createdAt)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+
+		result, err := tx.ExecContext(ctx, `
+			UPDATE notifications
+			SET read_at = CURRENT_TIMESTAMP
+			WHERE user_id = $1 AND read_at IS NULL AND (created_at, id) <= ($2, $3)
+		`, userID, createdAt, notificationID)
+		if err != nil {
+			return err
+		}
+		affected, err = result.RowsAffected()
+		return err
+	})
+
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	return affected, found, nil
+}
+
+// ListNotificationsByIDs gets the given notifications, oldest first
+func (db *DB) ListNotificationsByIDs(ctx context.Context, notificationIDs []uuid.UUID) ([]*Notification, error) {
+	ids := make([]string, len(notificationIDs))
+	for i, id := range notificationIDs {
+		ids[i] = id.String()
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE id = ANY($1::uuid[])
+		ORDER BY created_at
+	`, pq.Array(ids))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []*Notification
 	for rows.Next() {
-		notif := &NotificationWithGroup{}
-		if err := rows.Scan(&notif.ID, &notif.UserID, &notif.GroupID, &notif.Message, &notif.CreatedAt, &notif.GroupName); err != nil {
+		notif, err := scanNotification(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan notification: %w", err)
 		}
 		notifications = append(notifications, notif)
 	}
-	
-	// Convert to regular notifications for now (can extend later)
-	result := make([]*Notification, len(notifications))
-	for i, n := range notifications {
-		result[i] = &n.Notification
-		log.Debug().Str("group_name", n.GroupName).Msg("Notification with group info")
+
+	return notifications, nil
+}
+
+// scanNotification scans a row selected with notificationColumns
+func scanNotification(row interface{ Scan(...any) error }) (*Notification, error) {
+	notification := &Notification{}
+	err := row.Scan(&notification.ID, &notification.UserID, &notification.GroupID, pq.Array(&notification.GroupIDs), &notification.LocationEventID, &notification.Type, &notification.Title, &notification.Message, &notification.Delivery, &notification.DeliveryStatus, &notification.ReadAt, &notification.CreatedAt)
+	if err != nil {
+		return nil, err
 	}
-	
-	return result, nil
-}
\ No newline at end of file
+	return notification, nil
+}
+
+// ScheduleNotificationDigests collects every held back digest notification
+// and enqueues one notification.digest event per recipient. Collected
+// notifications are marked in the same transaction, so each is included in
+// exactly one digest even with several instances running. It returns the
+// number of digests enqueued.
+func (db *DB) ScheduleNotificationDigests(ctx context.Context) (int, error) {
+	digests := 0
+	err := db.WithTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE notifications
+			SET digested_at = CURRENT_TIMESTAMP
+			WHERE delivery = 'digest' AND digested_at IS NULL
+			RETURNING id, user_id
+		`)
+		if err != nil {
+			return err
+		}
+
+		byUser := make(map[uuid.UUID][]uuid.UUID)
+		for rows.Next() {
+			var id, userID uuid.UUID
+			if err := rows.Scan(&id, &userID); err != nil {
+				rows.Close()
+				return err
+			}
+			byUser[userID] = append(byUser[userID], id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for userID, ids := range byUser {
+			if err := enqueueOutboxEvent(ctx, tx, EventNotificationDigest, NotificationDigestEvent{UserID: userID, NotificationIDs: ids}); err != nil {
+				return err
+			}
+		}
+		digests = len(byUser)
+		return nil
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to schedule notification digests: %w", err)
+	}
+	return digests, nil
+}
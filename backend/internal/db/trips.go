@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Trip queries
+
+// tripsQuery pairs each of a user's arrivals with the update that follows
+// it. A trip ends with the next update, which is normally the departure
+// from the same country; the latest arrival is still ongoing.
+const tripsQuery = `
+	SELECT id, country_code, updated_at, ended_at,
+		EXTRACT(EPOCH FROM COALESCE(ended_at, CURRENT_TIMESTAMP) - updated_at)::bigint
+	FROM (
+		SELECT id, country_code, status, updated_at,
+			LEAD(updated_at) OVER (ORDER BY updated_at, id) AS ended_at
+		FROM user_locations
+		WHERE user_id = $1
+	) history
+	WHERE status = 'arrived'`
+
+// ListUserTrips lists a user's trips newest first, starting after the given
+// cursor. The returned cursor is nil on the last page.
+func (db *DB) ListUserTrips(ctx context.Context, userID uuid.UUID, after *Cursor, limit int) ([]*Trip, *Cursor, error) {
+	afterTime, afterID := cursorArgs(after)
+	rows, err := db.QueryContext(ctx, tripsQuery+`
+		AND ($2::timestamptz IS NULL OR (updated_at, id) < ($2, $3::uuid))
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $4
+	`, userID, afterTime, afterID, limit+1)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list user trips: %w", err)
+	}
+	defer rows.Close()
+
+	trips, err := scanTrips(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The extra row only tells whether there is another page
+	if len(trips) <= limit {
+		return trips, nil, nil
+	}
+	trips = trips[:limit]
+	last := trips[limit-1]
+	return trips, &Cursor{Time: last.StartedAt, ID: last.ID}, nil
+}
+
+// ListAllUserTrips lists all of a user's trips, oldest first
+func (db *DB) ListAllUserTrips(ctx context.Context, userID uuid.UUID) ([]*Trip, error) {
+	rows, err := db.QueryContext(ctx, tripsQuery+`
+		ORDER BY updated_at, id
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user trips: %w", err)
+	}
+	defer rows.Close()
+
+	return scanTrips(rows)
+}
+
+// scanTrips scans rows selected with tripsQuery
+func scanTrips(rows *sql.Rows) ([]*Trip, error) {
+	var trips []*Trip
+	for rows.Next() {
+		trip := &Trip{}
+		if err := rows.Scan(&trip.ID, &trip.CountryCode, &trip.StartedAt, &trip.EndedAt, &trip.DurationSeconds); err != nil {
+			return nil, fmt.Errorf("failed to scan trip: %w", err)
+		}
+		trips = append(trips, trip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan trips: %w", err)
+	}
+	return trips, nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// CountryWatchlist queries
+
+const watchlistColumns = `id, user_id, group_id, country_codes, same_country, updated_at`
+
+// GetCountryWatchlist gets a user's watchlist for a group, or their global
+// watchlist if groupID is nil. It returns nil if there is none; a group
+// without its own watchlist does not fall back to the global one here.
+func (db *DB) GetCountryWatchlist(ctx context.Context, userID uuid.UUID, groupID *uuid.UUID) (*CountryWatchlist, error) {
+	watchlist, err := scanCountryWatchlist(db.QueryRowContext(ctx, `
+		SELECT `+watchlistColumns+`
+		FROM country_watchlists
+		WHERE user_id = $1 AND group_id IS NOT DISTINCT FROM $2
+	`, userID, groupID))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get country watchlist: %w", err)
+	}
+	return watchlist, nil
+}
+
+// SetCountryWatchlist creates or replaces a user's watchlist for a group, or
+// their global watchlist if groupID is nil
+func (db *DB) SetCountryWatchlist(ctx context.Context, userID uuid.UUID, groupID *uuid.UUID, countryCodes []string, sameCountry bool) (*CountryWatchlist, error) {
+	// Each partial unique index has to be named by its own conflict target
+	conflict := `(user_id) WHERE group_id IS NULL`
+	if groupID != nil {
+		conflict = `(user_id, group_id) WHERE group_id IS NOT NULL`
+	}
+
+	watchlist, err := scanCountryWatchlist(db.QueryRowContext(ctx, `
+		INSERT INTO country_watchlists (user_id, group_id, country_codes, same_country)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT `+conflict+` DO UPDATE
+		SET country_codes = EXCLUDED.country_codes, same_country = EXCLUDED.same_country, updated_at = CURRENT_TIMESTAMP
+		RETURNING `+watchlistColumns,
+		userID, groupID, pq.Array(countryCodes), sameCountry))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to set country watchlist: %w", err)
+	}
+	return watchlist, nil
+}
+
+// DeleteCountryWatchlist deletes a user's watchlist for a group, or their
+// global watchlist if groupID is nil. It returns false if there was none.
+func (db *DB) DeleteCountryWatchlist(ctx context.Context, userID uuid.UUID, groupID *uuid.UUID) (bool, error) {
+	result, err := db.ExecContext(ctx, `
+		DELETE FROM country_watchlists
+		WHERE user_id = $1 AND group_id IS NOT DISTINCT FROM $2
+	`, userID, groupID)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to delete country watchlist: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete country watchlist: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// scanCountryWatchlist scans a row selected with watchlistColumns
+func scanCountryWatchlist(row interface{ Scan(...any) error }) (*CountryWatchlist, error) {
+	watchlist := &CountryWatchlist{}
+	err := row.Scan(&watchlist.ID, &watchlist.UserID, &watchlist.GroupID, pq.Array(&watchlist.CountryCodes), &watchlist.SameCountry, &watchlist.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return watchlist, nil
+}
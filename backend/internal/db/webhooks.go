@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// GroupWebhook queries
+
+const groupWebhookColumns = `id, group_id, url, secret, notify_on, created_by, created_at`
+
+// CreateGroupWebhook adds a webhook to a group
+func (db *DB) CreateGroupWebhook(ctx context.Context, groupID, createdBy uuid.UUID, url, secret, notifyOn string) (*GroupWebhook, error) {
+	webhook, err := scanGroupWebhook(db.QueryRowContext(ctx, `
+		INSERT INTO group_webhooks (group_id, url, secret, notify_on, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+groupWebhookColumns,
+		groupID, url, secret, notifyOn, createdBy))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// GetGroupWebhook gets a webhook by ID
+func (db *DB) GetGroupWebhook(ctx context.Context, webhookID uuid.UUID) (*GroupWebhook, error) {
+	webhook, err := scanGroupWebhook(db.QueryRowContext(ctx, `
+		SELECT `+groupWebhookColumns+`
+		FROM group_webhooks
+		WHERE id = $1
+	`, webhookID))
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get group webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// ListGroupWebhooks lists a group's webhooks, oldest first
+func (db *DB) ListGroupWebhooks(ctx context.Context, groupID uuid.UUID) ([]*GroupWebhook, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+groupWebhookColumns+`
+		FROM group_webhooks
+		WHERE group_id = $1
+		ORDER BY created_at
+	`, groupID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []*GroupWebhook{}
+	for rows.Next() {
+		webhook, err := scanGroupWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list group webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteGroupWebhook removes a webhook of the given group. Deliveries still
+// queued for it are dropped. It returns false if no such webhook exists.
+func (db *DB) DeleteGroupWebhook(ctx context.Context, groupID, webhookID uuid.UUID) (bool, error) {
+	result, err := db.ExecContext(ctx, `
+		DELETE FROM group_webhooks
+		WHERE id = $1 AND group_id = $2
+	`, webhookID, groupID)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to delete group webhook: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete group webhook: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// scanGroupWebhook scans a row selected with groupWebhookColumns
+func scanGroupWebhook(row interface{ Scan(...any) error }) (*GroupWebhook, error) {
+	webhook := &GroupWebhook{}
+	err := row.Scan(&webhook.ID, &webhook.GroupID, &webhook.URL, &webhook.Secret, &webhook.NotifyOn, &webhook.CreatedBy, &webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
@@ -0,0 +1,149 @@
+package devices
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/db"
+)
+
+// Handler handles device-related HTTP requests
+type Handler struct {
+	db *db.DB
+}
+
+// NewHandler creates a new devices handler
+func NewHandler(database *db.DB) *Handler {
+	return &Handler{db: database}
+}
+
+// RegisterRoutes registers all device-related routes
+func (h *Handler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
+	devices := router.Group("/devices")
+	devices.Use(authMiddleware)
+	{
+		devices.POST("", h.RegisterDevice)
+		devices.GET("", h.ListDevices)
+		devices.DELETE("", h.UnregisterDevice)
+	}
+}
+
+// RegisterDeviceRequest represents the request body for registering a
+// device. TokenType is inferred from the token when omitted.
+type RegisterDeviceRequest struct {
+	Token      string  `json:"token" binding:"required,max=512"`
+	TokenType  string  `json:"tokenType" binding:"omitempty,oneof=expo fcm apns"`
+	Platform   string  `json:"platform" binding:"required,oneof=ios android web"`
+	AppVersion *string `json:"appVersion" binding:"omitempty,max=32"`
+}
+
+// RegisterDeviceResponse represents the response for registering a device
+type RegisterDeviceResponse struct {
+	Device *db.Device `json:"device"`
+}
+
+// RegisterDevice registers (or refreshes) a push token for the user
+func (h *Handler) RegisterDevice(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var req RegisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokenType := req.TokenType
+	if tokenType == "" {
+		tokenType = inferTokenType(req.Token)
+	}
+
+	device, err := h.db.UpsertDevice(c.Request.Context(), user.ID, req.Token, tokenType, req.Platform, req.AppVersion)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to register device")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RegisterDeviceResponse{Device: device})
+}
+
+// ListDevicesResponse represents the response for listing devices
+type ListDevicesResponse struct {
+	Devices []*db.Device `json:"devices"`
+}
+
+// ListDevices lists all devices registered by the user
+func (h *Handler) ListDevices(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	devices, err := h.db.ListUserDevices(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list devices")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListDevicesResponse{Devices: devices})
+}
+
+// UnregisterDeviceRequest represents the request body for unregistering a device
+type UnregisterDeviceRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// UnregisterDevice removes a push token, e.g. on sign-out
+func (h *Handler) UnregisterDevice(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var req UnregisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deleted, err := h.db.DeleteDevice(c.Request.Context(), user.ID, req.Token)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to unregister device")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unregister device"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device unregistered"})
+}
+
+// inferTokenType guesses which push service issued a token. Expo tokens are
+// wrapped in "ExponentPushToken[...]", APNs device tokens are 32 bytes of
+// hex and anything else is taken to be an FCM registration token.
+func inferTokenType(token string) string {
+	if strings.HasPrefix(token, "ExponentPushToken[") || strings.HasPrefix(token, "ExpoPushToken[") {
+		return db.TokenTypeExpo
+	}
+	if decoded, err := hex.DecodeString(token); err == nil && len(decoded) == 32 {
+		return db.TokenTypeAPNs
+	}
+	return db.TokenTypeFCM
+}
@@ -0,0 +1,71 @@
+// Package eventbus delivers messages to subscribers on every instance of
+// the server. It carries the real-time stream events and invalidations of
+// in-memory caches such as the JWKS keys.
+package eventbus
+
+import (
+	"context"
+	"sync"
+)
+
+// Handler receives the payload of a message. Handlers run on the bus's
+// delivery goroutine and must not block.
+type Handler func(payload []byte)
+
+// Bus publishes messages to the subscribers of a topic on all instances,
+// including the publishing one. Delivery is best effort: messages published
+// while an instance is disconnected are lost. Topics must be valid
+// Postgres identifiers, e.g. "stream_events".
+type Bus interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	Subscribe(topic string, handler Handler)
+}
+
+// registry keeps the handlers of each topic
+type registry struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// add registers a handler and reports whether it is the topic's first
+func (r *registry) add(topic string, handler Handler) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.handlers == nil {
+		r.handlers = make(map[string][]Handler)
+	}
+	r.handlers[topic] = append(r.handlers[topic], handler)
+	return len(r.handlers[topic]) == 1
+}
+
+// dispatch calls every handler of a topic
+func (r *registry) dispatch(topic string, payload []byte) {
+	r.mu.RLock()
+	handlers := r.handlers[topic]
+	r.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+}
+
+// Local is an in-process bus for single-instance deployments
+type Local struct {
+	registry
+}
+
+// NewLocal creates a new in-process bus
+func NewLocal() *Local {
+	return &Local{}
+}
+
+// Publish delivers a message to this instance's subscribers
+func (b *Local) Publish(ctx context.Context, topic string, payload []byte) error {
+	b.dispatch(topic, payload)
+	return nil
+}
+
+// Subscribe registers a handler for a topic
+func (b *Local) Subscribe(topic string, handler Handler) {
+	b.add(topic, handler)
+}
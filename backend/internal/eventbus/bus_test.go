@@ -0,0 +1,71 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	bus := NewLocal()
+	ctx := context.Background()
+
+	var got []string
+	record := func(prefix string) Handler {
+		return func(payload []byte) {
+			got = append(got, prefix+":"+string(payload))
+		}
+	}
+	bus.Subscribe("stream_events", record("a"))
+	bus.Subscribe("stream_events", record("b"))
+	bus.Subscribe("other_topic", record("c"))
+
+	tests := []struct {
+		name    string
+		topic   string
+		payload string
+		want    []string
+	}{
+		{name: "every handler of the topic", topic: "stream_events", payload: "hello", want: []string{"a:hello", "b:hello"}},
+		{name: "other topics are isolated", topic: "other_topic", payload: "x", want: []string{"c:x"}},
+		{name: "topic without subscribers", topic: "nobody_listens", payload: "lost", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			if err := bus.Publish(ctx, tt.topic, []byte(tt.payload)); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("delivered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryAddReportsFirstHandler(t *testing.T) {
+	var r registry
+	noop := func([]byte) {}
+
+	if !r.add("topic", noop) {
+		t.Error("add() = false for the first handler of a topic")
+	}
+	if r.add("topic", noop) {
+		t.Error("add() = true for the second handler of a topic")
+	}
+	if !r.add("another", noop) {
+		t.Error("add() = false for the first handler of another topic")
+	}
+}
+
+func TestPostgresPublishRejectsLargePayload(t *testing.T) {
+	// Oversized payloads are rejected before the database is touched
+	bus := &Postgres{}
+
+	err := bus.Publish(context.Background(), "stream_events", make([]byte, MaxPayload+1))
+	if !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("Publish() error = %v, want %v", err, ErrPayloadTooLarge)
+	}
+}
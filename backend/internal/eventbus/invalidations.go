@@ -0,0 +1,86 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// invalidationTopic is the topic cache invalidations travel on
+const invalidationTopic = "cache_invalidations"
+
+// invalidation is a cache invalidation as sent over the bus
+type invalidation struct {
+	// Instance identifies the sender, which ignores its own invalidations
+	Instance uuid.UUID `json:"instance"`
+	Cache    string    `json:"cache"`
+	Key      string    `json:"key,omitempty"`
+}
+
+// Invalidations tells the other instances to drop entries of their
+// in-memory caches. The sending instance is expected to have updated its
+// own cache already, so it does not receive its own invalidations.
+type Invalidations struct {
+	bus      Bus
+	instance uuid.UUID
+
+	mu       sync.RWMutex
+	handlers map[string][]func(key string)
+}
+
+// NewInvalidations creates a new invalidation channel and subscribes it to
+// the bus
+func NewInvalidations(bus Bus) *Invalidations {
+	i := &Invalidations{
+		bus:      bus,
+		instance: uuid.New(),
+		handlers: make(map[string][]func(key string)),
+	}
+	bus.Subscribe(invalidationTopic, i.receive)
+	return i
+}
+
+// Register sets handler to be called when another instance invalidates an
+// entry of the named cache. Like bus handlers, it must not block.
+func (i *Invalidations) Register(cache string, handler func(key string)) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.handlers[cache] = append(i.handlers[cache], handler)
+}
+
+// Invalidate tells the other instances to drop key from the named cache. An
+// empty key stands for the whole cache. Invalidations are best effort:
+// failures are logged, and caches still expire on their own.
+func (i *Invalidations) Invalidate(ctx context.Context, cache, key string) {
+	payload, err := json.Marshal(invalidation{Instance: i.instance, Cache: cache, Key: key})
+	if err != nil {
+		log.Error().Err(err).Str("cache", cache).Msg("Failed to encode cache invalidation")
+		return
+	}
+	if err := i.bus.Publish(ctx, invalidationTopic, payload); err != nil {
+		log.Error().Err(err).Str("cache", cache).Msg("Failed to publish cache invalidation")
+	}
+}
+
+// receive handles an invalidation from the bus
+func (i *Invalidations) receive(payload []byte) {
+	var msg invalidation
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Error().Err(err).Msg("Failed to decode cache invalidation")
+		return
+	}
+	if msg.Instance == i.instance {
+		return
+	}
+
+	i.mu.RLock()
+	handlers := i.handlers[msg.Cache]
+	i.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(msg.Key)
+	}
+}
@@ -0,0 +1,60 @@
+package eventbus
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestInvalidations(t *testing.T) {
+	// Two instances sharing a bus
+	bus := NewLocal()
+	a, b := NewInvalidations(bus), NewInvalidations(bus)
+
+	var got []string
+	record := func(instance, cache string) func(key string) {
+		return func(key string) {
+			got = append(got, instance+":"+cache+":"+key)
+		}
+	}
+	a.Register("users", record("a", "users"))
+	b.Register("users", record("b", "users"))
+	b.Register("keys", record("b", "keys"))
+
+	tests := []struct {
+		name  string
+		from  *Invalidations
+		cache string
+		key   string
+		want  []string
+	}{
+		{name: "other instance only", from: a, cache: "users", key: "42", want: []string{"b:users:42"}},
+		{name: "whole cache", from: b, cache: "users", want: []string{"a:users:"}},
+		{name: "other caches are isolated", from: a, cache: "keys", want: []string{"b:keys:"}},
+		{name: "cache without handlers", from: a, cache: "nobody", key: "x", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			tt.from.Invalidate(context.Background(), tt.cache, tt.key)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("invalidated %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidationsIgnoreMalformedMessages(t *testing.T) {
+	bus := NewLocal()
+	inv := NewInvalidations(bus)
+	called := false
+	inv.Register("users", func(string) { called = true })
+
+	if err := bus.Publish(context.Background(), invalidationTopic, []byte("not json")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if called {
+		t.Error("handler called for a malformed invalidation")
+	}
+}
@@ -0,0 +1,102 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/db"
+)
+
+// MaxPayload is the largest payload Postgres accepts in a notification
+const MaxPayload = 7999
+
+// ErrPayloadTooLarge is returned for payloads over MaxPayload
+var ErrPayloadTooLarge = errors.New("event bus payload too large")
+
+// pingInterval is how often the listener connection is checked, so a
+// silently dropped connection is noticed and re-established
+const pingInterval = 90 * time.Second
+
+// Postgres is a bus built on LISTEN/NOTIFY, so replicas sharing a database
+// need no extra infrastructure. Each instance holds one dedicated listener
+// connection.
+type Postgres struct {
+	registry
+	db       *db.DB
+	listener *pq.Listener
+}
+
+// NewPostgres creates a new Postgres bus. databaseURL is used for the
+// listener connection, which reconnects on its own. Run must be called to
+// deliver messages.
+func NewPostgres(database *db.DB, databaseURL string) *Postgres {
+	listener := pq.NewListener(databaseURL, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Warn().Err(err).Msg("Event bus listener disconnected")
+		case pq.ListenerEventReconnected:
+			// Anything published in between was missed
+			log.Warn().Msg("Event bus listener reconnected")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Error().Err(err).Msg("Event bus listener failed to connect")
+		}
+	})
+
+	return &Postgres{
+		db:       database,
+		listener: listener,
+	}
+}
+
+// Publish sends a message to the topic's subscribers on all instances. It
+// takes effect immediately, not when a surrounding transaction commits.
+func (b *Postgres) Publish(ctx context.Context, topic string, payload []byte) error {
+	if len(payload) > MaxPayload {
+		return ErrPayloadTooLarge
+	}
+	return b.db.Notify(ctx, topic, string(payload))
+}
+
+// Subscribe registers a handler for a topic
+func (b *Postgres) Subscribe(topic string, handler Handler) {
+	if !b.add(topic, handler) {
+		return
+	}
+	// On failure the channel is still listened on once the connection is back
+	if err := b.listener.Listen(topic); err != nil && err != pq.ErrChannelAlreadyOpen {
+		log.Warn().Err(err).Str("topic", topic).Msg("Event bus listen deferred until reconnect")
+	}
+}
+
+// Run delivers messages until the context is cancelled
+func (b *Postgres) Run(ctx context.Context) {
+	log.Info().Msg("Starting Postgres event bus")
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := b.listener.Close(); err != nil {
+				log.Error().Err(err).Msg("Failed to close event bus listener")
+			}
+			log.Info().Msg("Postgres event bus stopped")
+			return
+		case n := <-b.listener.Notify:
+			if n == nil {
+				// Sent after a reconnect
+				continue
+			}
+			b.dispatch(n.Channel, []byte(n.Extra))
+		case <-ticker.C:
+			if err := b.listener.Ping(); err != nil {
+				log.Warn().Err(err).Msg("Event bus listener ping failed")
+			}
+		}
+	}
+}
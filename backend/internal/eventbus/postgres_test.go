@@ -0,0 +1,214 @@
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marko/backend/internal/db"
+)
+
+// deliveryTimeout bounds how long a test waits for a notification
+const deliveryTimeout = 10 * time.Second
+
+// inbox collects the payloads a handler receives
+type inbox struct {
+	mu       sync.Mutex
+	payloads []string
+	arrived  chan struct{}
+}
+
+func newInbox() *inbox {
+	return &inbox{arrived: make(chan struct{}, 100)}
+}
+
+func (in *inbox) handle(payload []byte) {
+	in.mu.Lock()
+	in.payloads = append(in.payloads, string(payload))
+	in.mu.Unlock()
+	in.arrived <- struct{}{}
+}
+
+// has reports whether payload was received
+func (in *inbox) has(payload string) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, p := range in.payloads {
+		if p == payload {
+			return true
+		}
+	}
+	return false
+}
+
+// waitFor waits until payload is received
+func (in *inbox) waitFor(t *testing.T, payload string) {
+	t.Helper()
+	deadline := time.After(deliveryTimeout)
+	for !in.has(payload) {
+		select {
+		case <-in.arrived:
+		case <-deadline:
+			t.Fatalf("payload %q not delivered within %v", payload, deliveryTimeout)
+		}
+	}
+}
+
+// testPostgres connects to DATABASE_URL, skipping the test without it
+func testPostgres(t *testing.T) (*db.DB, string) {
+	t.Helper()
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		t.Skip("DATABASE_URL not set")
+	}
+	database, err := db.New(url)
+	if err != nil {
+		t.Fatalf("db.New() error = %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database, url
+}
+
+// startBus creates a Postgres bus, as one instance would, and runs it until
+// the test ends
+func startBus(t *testing.T, database *db.DB, url string) *Postgres {
+	t.Helper()
+	bus := NewPostgres(database, url)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bus.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return bus
+}
+
+// testTopic returns a topic no other test run listens on
+func testTopic(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return "eventbus_test_" + hex.EncodeToString(b)
+}
+
+func TestPostgresFanOut(t *testing.T) {
+	database, url := testPostgres(t)
+	a, b := startBus(t, database, url), startBus(t, database, url)
+	topic := testTopic(t)
+
+	inA, inB, inB2 := newInbox(), newInbox(), newInbox()
+	a.Subscribe(topic, inA.handle)
+	b.Subscribe(topic, inB.handle)
+	b.Subscribe(topic, inB2.handle)
+
+	ctx := context.Background()
+	if err := a.Publish(ctx, topic, []byte("from a")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	// Every subscriber on every instance gets it, the publisher included,
+	// since the stream hub delivers to its own clients through the bus
+	inB.waitFor(t, "from a")
+	inB2.waitFor(t, "from a")
+	inA.waitFor(t, "from a")
+}
+
+func TestPostgresReconnect(t *testing.T) {
+	database, url := testPostgres(t)
+	a, b := startBus(t, database, url), startBus(t, database, url)
+	topic := testTopic(t)
+
+	in := newInbox()
+	b.Subscribe(topic, in.handle)
+
+	ctx := context.Background()
+	if err := a.Publish(ctx, topic, []byte("before")); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	in.waitFor(t, "before")
+
+	// Kill the listener connection, whose last query was the LISTEN
+	var killed int
+	err := database.QueryRowContext(ctx, `
+		SELECT count(pg_terminate_backend(pid))
+		FROM pg_stat_activity
+		WHERE datname = current_database() AND pid <> pg_backend_pid() AND query LIKE '%' || $1 || '%'
+	`, topic).Scan(&killed)
+	if err != nil {
+		t.Fatalf("failed to terminate listener: %v", err)
+	}
+	if killed == 0 {
+		t.Fatal("no listener connection found")
+	}
+
+	// Messages published while the listener is down are lost, so keep
+	// publishing until one arrives on the new connection
+	deadline := time.Now().Add(deliveryTimeout)
+	for !in.has("after") {
+		if time.Now().After(deadline) {
+			t.Fatalf("no delivery within %v of losing the listener", deliveryTimeout)
+		}
+		if err := a.Publish(ctx, topic, []byte("after")); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		select {
+		case <-in.arrived:
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func TestPostgresInvalidationsSkipSelfEcho(t *testing.T) {
+	database, url := testPostgres(t)
+	busA := startBus(t, database, url)
+	a := NewInvalidations(busA)
+	b := NewInvalidations(startBus(t, database, url))
+
+	var mu sync.Mutex
+	var gotA []string
+	a.Register("users", func(key string) {
+		mu.Lock()
+		gotA = append(gotA, key)
+		mu.Unlock()
+	})
+	inB := make(chan string, 10)
+	b.Register("users", func(key string) { inB <- key })
+
+	// Handlers of a topic run in order, so once this one has seen the echo,
+	// a's invalidation handler has had it too
+	echoes := newInbox()
+	busA.Subscribe(invalidationTopic, echoes.handle)
+
+	ctx := context.Background()
+	a.Invalidate(ctx, "users", "42")
+
+	select {
+	case key := <-inB:
+		if key != "42" {
+			t.Fatalf("other instance got %q, want %q", key, "42")
+		}
+	case <-time.After(deliveryTimeout):
+		t.Fatalf("other instance got no invalidation within %v", deliveryTimeout)
+	}
+
+	select {
+	case <-echoes.arrived:
+	case <-time.After(deliveryTimeout):
+		t.Fatalf("sending instance got no echo within %v", deliveryTimeout)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(gotA) != 0 {
+		t.Errorf("sending instance handled its own invalidation %v", gotA)
+	}
+}
@@ -0,0 +1,254 @@
+// Command gen builds the embedded country boundary dataset from Natural
+// Earth's admin-0 countries GeoJSON (public domain). Geometry is simplified
+// and only the ISO 3166-1 alpha-2 code is kept, which keeps the dataset
+// small enough to embed in the binary.
+//
+// Usage:
+//
+//	go run ./gen -in ne_10m_admin_0_countries.geojson -out countries.json.gz
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// territoryCodes assigns an ISO code to Natural Earth features that have
+// none, following common reverse geocoding practice
+var territoryCodes = map[string]string{
+	"Somaliland":                   "SO",
+	"Northern Cyprus":              "CY",
+	"Cyprus No Mans Area":          "CY",
+	"Dhekelia Sovereign Base Area": "CY",
+	"Akrotiri Sovereign Base Area": "CY",
+	"US Naval Base Guantanamo Bay": "CU",
+}
+
+type feature struct {
+	Properties map[string]any `json:"properties"`
+	Geometry   struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+type featureCollection struct {
+	Features []feature `json:"features"`
+}
+
+// country mirrors geo.countryShape
+type country struct {
+	Code     string           `json:"code"`
+	Polygons [][][][2]float64 `json:"polygons"`
+}
+
+func main() {
+	in := flag.String("in", "", "path or URL of the Natural Earth admin-0 countries GeoJSON")
+	out := flag.String("out", "countries.json.gz", "output file")
+	tolerance := flag.Float64("tolerance", 0.01, "simplification tolerance in degrees")
+	flag.Parse()
+
+	if *in == "" {
+		fmt.Fprintln(os.Stderr, "-in is required")
+		os.Exit(2)
+	}
+
+	if err := run(*in, *out, *tolerance); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out string, tolerance float64) error {
+	r, err := open(in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var fc featureCollection
+	if err := json.NewDecoder(r).Decode(&fc); err != nil {
+		return fmt.Errorf("failed to decode GeoJSON: %w", err)
+	}
+
+	byCode := make(map[string]*country)
+	for _, f := range fc.Features {
+		code := isoCode(f.Properties)
+		if code == "" {
+			continue
+		}
+
+		var polygons [][][][2]float64
+		switch f.Geometry.Type {
+		case "Polygon":
+			var p [][][2]float64
+			if err := json.Unmarshal(f.Geometry.Coordinates, &p); err != nil {
+				return fmt.Errorf("failed to decode polygon for %s: %w", code, err)
+			}
+			polygons = [][][][2]float64{p}
+		case "MultiPolygon":
+			if err := json.Unmarshal(f.Geometry.Coordinates, &polygons); err != nil {
+				return fmt.Errorf("failed to decode multipolygon for %s: %w", code, err)
+			}
+		default:
+			continue
+		}
+
+		c, ok := byCode[code]
+		if !ok {
+			c = &country{Code: code}
+			byCode[code] = c
+		}
+		for _, polygon := range polygons {
+			if simplified := simplifyPolygon(polygon, tolerance); simplified != nil {
+				c.Polygons = append(c.Polygons, simplified)
+			}
+		}
+	}
+
+	countries := make([]*country, 0, len(byCode))
+	for _, c := range byCode {
+		if len(c.Polygons) > 0 {
+			countries = append(countries, c)
+		}
+	}
+	sort.Slice(countries, func(i, j int) bool { return countries[i].Code < countries[j].Code })
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(gz).Encode(countries); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %d countries to %s\n", len(countries), out)
+	return nil
+}
+
+// open opens a local file or downloads a URL
+func open(in string) (io.ReadCloser, error) {
+	if strings.HasPrefix(in, "http://") || strings.HasPrefix(in, "https://") {
+		resp, err := http.Get(in)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("download failed with status %d", resp.StatusCode)
+		}
+		return resp.Body, nil
+	}
+	return os.Open(in)
+}
+
+// isoCode returns the ISO 3166-1 alpha-2 code of a feature
+func isoCode(props map[string]any) string {
+	for _, key := range []string{"ISO_A2_EH", "ISO_A2"} {
+		if code, ok := props[key].(string); ok && len(code) == 2 {
+			return code
+		}
+	}
+	if name, ok := props["ADMIN"].(string); ok {
+		return territoryCodes[name]
+	}
+	return ""
+}
+
+// simplifyPolygon simplifies every ring and rounds coordinates. Rings that
+// collapse are dropped; if the outer ring collapses the polygon is dropped.
+func simplifyPolygon(polygon [][][2]float64, tolerance float64) [][][2]float64 {
+	var result [][][2]float64
+	for i, ring := range polygon {
+		simplified := simplifyRing(ring, tolerance)
+		if len(simplified) < 4 {
+			if i == 0 {
+				return nil
+			}
+			continue
+		}
+		result = append(result, simplified)
+	}
+	return result
+}
+
+// simplifyRing applies Douglas-Peucker to a closed ring
+func simplifyRing(ring [][2]float64, tolerance float64) [][2]float64 {
+	if len(ring) < 4 {
+		return nil
+	}
+
+	keep := make([]bool, len(ring))
+	keep[0], keep[len(ring)-1] = true, true
+
+	// The ring is closed, so split it at the point farthest from the start
+	far, farDist := 0, -1.0
+	for i := 1; i < len(ring)-1; i++ {
+		if d := math.Hypot(ring[i][0]-ring[0][0], ring[i][1]-ring[0][1]); d > farDist {
+			far, farDist = i, d
+		}
+	}
+	keep[far] = true
+	douglasPeucker(ring, 0, far, tolerance, keep)
+	douglasPeucker(ring, far, len(ring)-1, tolerance, keep)
+
+	var out [][2]float64
+	for i, p := range ring {
+		if keep[i] {
+			out = append(out, [2]float64{round(p[0]), round(p[1])})
+		}
+	}
+	return out
+}
+
+func douglasPeucker(points [][2]float64, start, end int, tolerance float64, keep []bool) {
+	if end-start < 2 {
+		return
+	}
+
+	maxDist, index := 0.0, start
+	for i := start + 1; i < end; i++ {
+		if d := segmentDistance(points[i], points[start], points[end]); d > maxDist {
+			maxDist, index = d, i
+		}
+	}
+
+	if maxDist > tolerance {
+		keep[index] = true
+		douglasPeucker(points, start, index, tolerance, keep)
+		douglasPeucker(points, index, end, tolerance, keep)
+	}
+}
+
+// segmentDistance returns the distance from p to the segment a-b
+func segmentDistance(p, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	if dx == 0 && dy == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / (dx*dx + dy*dy)
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
+
+// round keeps three decimals (about 100 m), well below the simplification tolerance
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
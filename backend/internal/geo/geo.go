@@ -0,0 +1,163 @@
+// Package geo resolves coordinates to ISO 3166-1 alpha-2 country codes
+// offline, using an embedded country boundary dataset derived from Natural
+// Earth.
+//
+// Boundaries are simplified to about 1 km, so points within that distance of
+// a border may resolve to the neighbouring country. Countries whose outline
+// collapses under simplification are missing: Vatican City resolves to IT.
+// Other microstates (MC, SM, LI, AD) and enclaves such as Llívia or Lesotho
+// are kept.
+package geo
+
+//go:generate go run ./gen -in https://raw.githubusercontent.com/nvkelso/natural-earth-vector/master/geojson/ne_10m_admin_0_countries.geojson -out countries.json.gz
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+//go:embed countries.json.gz
+var countriesData []byte
+
+// cellSize is the size in degrees of a grid cell in the spatial index
+const cellSize = 1.0
+
+// countryShape is a country's boundary as stored in the embedded dataset.
+// Each polygon is a list of rings: the outer ring followed by any holes,
+// with points as [longitude, latitude].
+type countryShape struct {
+	Code     string           `json:"code"`
+	Polygons [][][][2]float64 `json:"polygons"`
+}
+
+// polygon is a single indexed polygon with its bounding box
+type polygon struct {
+	code   string
+	rings  [][][2]float64
+	minLng float64
+	minLat float64
+	maxLng float64
+	maxLat float64
+}
+
+// Index answers point-in-polygon queries against country boundaries. A
+// coarse grid maps each cell to the polygons whose bounding box overlaps
+// it, so a lookup only tests a handful of candidates.
+type Index struct {
+	polygons []*polygon
+	cells    map[[2]int][]*polygon
+}
+
+// Load parses the embedded dataset and builds the spatial index
+func Load() (*Index, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(countriesData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open country data: %w", err)
+	}
+	defer gz.Close()
+
+	var shapes []countryShape
+	if err := json.NewDecoder(gz).Decode(&shapes); err != nil {
+		return nil, fmt.Errorf("failed to decode country data: %w", err)
+	}
+
+	idx := &Index{cells: make(map[[2]int][]*polygon)}
+	for _, shape := range shapes {
+		for _, rings := range shape.Polygons {
+			idx.add(newPolygon(shape.Code, rings))
+		}
+	}
+	return idx, nil
+}
+
+// CountryAt returns the ISO 3166-1 alpha-2 code of the country containing
+// the point, or false if the point is not inside any country (e.g. at sea)
+func (idx *Index) CountryAt(lat, lng float64) (string, bool) {
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return "", false
+	}
+	// Polygons crossing the antimeridian are split at it, and a point on a
+	// polygon's east edge counts as outside, so look it up from the west side
+	if lng == 180 {
+		lng = -180
+	}
+
+	for _, p := range idx.cells[cellOf(lat, lng)] {
+		if p.contains(lat, lng) {
+			return p.code, true
+		}
+	}
+	return "", false
+}
+
+// add registers a polygon in every grid cell its bounding box touches
+func (idx *Index) add(p *polygon) {
+	idx.polygons = append(idx.polygons, p)
+
+	minCell := cellOf(p.minLat, p.minLng)
+	maxCell := cellOf(p.maxLat, p.maxLng)
+	for x := minCell[0]; x <= maxCell[0]; x++ {
+		for y := minCell[1]; y <= maxCell[1]; y++ {
+			key := [2]int{x, y}
+			idx.cells[key] = append(idx.cells[key], p)
+		}
+	}
+}
+
+// newPolygon builds a polygon and computes its bounding box
+func newPolygon(code string, rings [][][2]float64) *polygon {
+	p := &polygon{
+		code:   code,
+		rings:  rings,
+		minLng: math.Inf(1),
+		minLat: math.Inf(1),
+		maxLng: math.Inf(-1),
+		maxLat: math.Inf(-1),
+	}
+	for _, pt := range rings[0] {
+		p.minLng = math.Min(p.minLng, pt[0])
+		p.maxLng = math.Max(p.maxLng, pt[0])
+		p.minLat = math.Min(p.minLat, pt[1])
+		p.maxLat = math.Max(p.maxLat, pt[1])
+	}
+	return p
+}
+
+// contains reports whether the point is inside the outer ring and outside
+// every hole
+func (p *polygon) contains(lat, lng float64) bool {
+	if lng < p.minLng || lng > p.maxLng || lat < p.minLat || lat > p.maxLat {
+		return false
+	}
+	if !ringContains(p.rings[0], lat, lng) {
+		return false
+	}
+	for _, hole := range p.rings[1:] {
+		if ringContains(hole, lat, lng) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains is the even-odd ray casting test
+func ringContains(ring [][2]float64, lat, lng float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lng < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// cellOf returns the grid cell containing the point
+func cellOf(lat, lng float64) [2]int {
+	return [2]int{int(math.Floor(lng / cellSize)), int(math.Floor(lat / cellSize))}
+}
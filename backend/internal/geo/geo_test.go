@@ -0,0 +1,122 @@
+package geo
+
+import (
+	"sync"
+	"testing"
+)
+
+var (
+	testIndex     *Index
+	testIndexErr  error
+	testIndexOnce sync.Once
+)
+
+// loadIndex loads the embedded index once for all tests
+func loadIndex(t *testing.T) *Index {
+	t.Helper()
+	testIndexOnce.Do(func() {
+		testIndex, testIndexErr = Load()
+	})
+	if testIndexErr != nil {
+		t.Fatalf("Load() error = %v", testIndexErr)
+	}
+	return testIndex
+}
+
+func TestCountryAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+		want     string
+	}{
+		// Both sides of land borders
+		{name: "Strasbourg", lat: 48.5734, lng: 7.7521, want: "FR"},
+		{name: "Kehl", lat: 48.5728, lng: 7.8152, want: "DE"},
+		{name: "Geneva", lat: 46.2044, lng: 6.1432, want: "CH"},
+		{name: "Annemasse", lat: 46.1934, lng: 6.2344, want: "FR"},
+		{name: "Tel Aviv", lat: 32.0, lng: 34.8, want: "IL"},
+		{name: "West Bank", lat: 31.9, lng: 35.2, want: "PS"},
+
+		// Natural Earth has no ISO_A2 for these; the code comes from ISO_A2_EH
+		{name: "Pristina", lat: 42.6629, lng: 21.1655, want: "XK"},
+		{name: "Paris", lat: 48.8566, lng: 2.3522, want: "FR"},
+		{name: "French Guiana", lat: 4.93, lng: -52.33, want: "FR"},
+		{name: "Oslo", lat: 59.9139, lng: 10.7522, want: "NO"},
+		{name: "Svalbard", lat: 78.22, lng: 15.65, want: "NO"},
+
+		// Enclaves, exclaves and microstates inside a larger country's outline
+		{name: "Lesotho", lat: -29.5, lng: 28.0, want: "LS"},
+		{name: "Llívia", lat: 42.46, lng: 1.98, want: "ES"},
+		{name: "San Marino", lat: 43.9424, lng: 12.4578, want: "SM"},
+		{name: "Monaco", lat: 43.7384, lng: 7.4246, want: "MC"},
+		{name: "Liechtenstein", lat: 47.141, lng: 9.521, want: "LI"},
+		{name: "Andorra", lat: 42.5063, lng: 1.5218, want: "AD"},
+		{name: "Kaliningrad", lat: 54.71, lng: 20.51, want: "RU"},
+		{name: "Nakhchivan", lat: 39.21, lng: 45.41, want: "AZ"},
+		// Known limitation, see the package documentation
+		{name: "Vatican City", lat: 41.9029, lng: 12.4534, want: "IT"},
+
+		// Countries split at the antimeridian
+		{name: "Wrangel Island west", lat: 71.2, lng: 179.5, want: "RU"},
+		{name: "Wrangel Island east", lat: 71.2, lng: -179.5, want: "RU"},
+		{name: "Wrangel Island on 180", lat: 71.2, lng: 180, want: "RU"},
+		{name: "Wrangel Island on -180", lat: 71.2, lng: -180, want: "RU"},
+		{name: "Chukotka", lat: 67, lng: -175, want: "RU"},
+		{name: "Vanua Levu", lat: -16.5, lng: 179.5, want: "FJ"},
+		{name: "Taveuni", lat: -16.8, lng: -179.97, want: "FJ"},
+		{name: "Samoa", lat: -13.95, lng: -171.75, want: "WS"},
+	}
+
+	idx := loadIndex(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := idx.CountryAt(tt.lat, tt.lng)
+			if !ok || got != tt.want {
+				t.Errorf("CountryAt(%v, %v) = %q, %v, want %q", tt.lat, tt.lng, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountryAtNoCountry(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng float64
+	}{
+		{name: "mid Atlantic", lat: 45, lng: -30},
+		{name: "Pacific on the antimeridian", lat: 0, lng: 180},
+		{name: "latitude out of range", lat: 91, lng: 0},
+		{name: "longitude out of range", lat: 0, lng: -180.5},
+	}
+
+	idx := loadIndex(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := idx.CountryAt(tt.lat, tt.lng); ok {
+				t.Errorf("CountryAt(%v, %v) = %q, want no country", tt.lat, tt.lng, got)
+			}
+		})
+	}
+}
+
+func TestPolygonHoles(t *testing.T) {
+	// A 4x4 square with a 2x2 hole in the middle
+	p := newPolygon("XX", [][][2]float64{
+		{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}},
+		{{1, 1}, {3, 1}, {3, 3}, {1, 3}, {1, 1}},
+	})
+	tests := []struct {
+		lat, lng float64
+		want     bool
+	}{
+		{lat: 0.5, lng: 0.5, want: true},
+		{lat: 2, lng: 2, want: false},
+		{lat: 3.5, lng: 2, want: true},
+		{lat: 5, lng: 2, want: false},
+	}
+	for _, tt := range tests {
+		if got := p.contains(tt.lat, tt.lng); got != tt.want {
+			t.Errorf("contains(%v, %v) = %v, want %v", tt.lat, tt.lng, got, tt.want)
+		}
+	}
+}
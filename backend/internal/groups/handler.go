@@ -13,12 +13,17 @@ import (
 
 // Handler handles group-related HTTP requests
 type Handler struct {
-	db *db.DB
+	db            *db.DB
+	inviteURLBase string
 }
 
-// NewHandler creates a new groups handler
-func NewHandler(database *db.DB) *Handler {
-	return &Handler{db: database}
+// NewHandler creates a new groups handler. Invite links are built by
+// appending the invite code to inviteURLBase.
+func NewHandler(database *db.DB, inviteURLBase string) *Handler {
+	return &Handler{
+		db:            database,
+		inviteURLBase: inviteURLBase,
+	}
 }
 
 // RegisterRoutes registers all group-related routes
@@ -28,14 +33,43 @@ func (h *Handler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.Han
 	{
 		groups.POST("", h.CreateGroup)
 		groups.GET("", h.ListUserGroups)
+		groups.PATCH("/:id", h.UpdateGroup)
+		groups.DELETE("/:id", h.DeleteGroup)
 		groups.POST("/:id/join", h.JoinGroup)
+		groups.POST("/:id/leave", h.LeaveGroup)
+		groups.GET("/:id/preferences", h.GetPreferences)
+		groups.PUT("/:id/preferences", h.UpdatePreferences)
 		groups.GET("/:id/members", h.GetGroupMembers)
+		groups.PATCH("/:id/members/:userId", h.UpdateMemberRole)
+		groups.DELETE("/:id/members/:userId", h.RemoveMember)
+		groups.POST("/:id/requests", h.RequestToJoin)
+		groups.GET("/:id/requests", h.ListJoinRequests)
+		groups.POST("/:id/requests/:requestId/approve", h.ApproveJoinRequest)
+		groups.POST("/:id/requests/:requestId/reject", h.RejectJoinRequest)
+		groups.POST("/:id/transfer", h.TransferOwnership)
+		groups.POST("/:id/invites", h.CreateInvite)
+		groups.GET("/:id/invites", h.ListInvites)
+		groups.DELETE("/:id/invites/:inviteId", h.RevokeInvite)
+		groups.POST("/:id/webhooks", h.CreateWebhook)
+		groups.GET("/:id/webhooks", h.ListWebhooks)
+		groups.DELETE("/:id/webhooks/:webhookId", h.DeleteWebhook)
+	}
+
+	invites := router.Group("/invites")
+	invites.Use(authMiddleware)
+	{
+		invites.GET("/:code", h.GetInvite)
+		invites.POST("/:code/accept", h.AcceptInvite)
 	}
 }
 
 // CreateGroupRequest represents the request body for creating a group
 type CreateGroupRequest struct {
 	Name string `json:"name" binding:"required,min=1,max=100"`
+	// AllowIDJoin lets anyone who knows the group ID join without an invite
+	AllowIDJoin bool `json:"allowIdJoin"`
+	// AllowJoinRequests lets anyone who knows the group ID ask to join
+	AllowJoinRequests bool `json:"allowJoinRequests"`
 }
 
 // CreateGroupResponse represents the response for creating a group
@@ -58,19 +92,13 @@ func (h *Handler) CreateGroup(c *gin.Context) {
 		return
 	}
 
-	group, err := h.db.CreateGroup(c.Request.Context(), req.Name, user.ID)
+	group, err := h.db.CreateGroup(c.Request.Context(), req.Name, user.ID, req.AllowIDJoin, req.AllowJoinRequests)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create group")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
 		return
 	}
 
-	// Add the creator as a member
-	if err := h.db.AddGroupMember(c.Request.Context(), group.ID, user.ID); err != nil {
-		log.Error().Err(err).Msg("Failed to add creator as group member")
-		// Don't fail the request, just log the error
-	}
-
 	c.JSON(http.StatusCreated, CreateGroupResponse{Group: group})
 }
 
@@ -103,7 +131,8 @@ type JoinGroupRequest struct {
 	GroupID string `json:"group_id" binding:"required"`
 }
 
-// JoinGroup adds the user to a group
+// JoinGroup adds the user to a group by its ID. This is only allowed for
+// groups that opted in with allow_id_join; others require an invite code.
 func (h *Handler) JoinGroup(c *gin.Context) {
 	user, err := auth.GetUserFromGin(c)
 	if err != nil {
@@ -129,6 +158,10 @@ func (h *Handler) JoinGroup(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
 		return
 	}
+	if !group.AllowIDJoin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This group can only be joined with an invite"})
+		return
+	}
 
 	// Add user to group
 	if err := h.db.AddGroupMember(c.Request.Context(), groupID, user.ID); err != nil {
@@ -142,7 +175,7 @@ func (h *Handler) JoinGroup(c *gin.Context) {
 
 // GetGroupMembersResponse represents the response for getting group members
 type GetGroupMembersResponse struct {
-	Members []*db.User `json:"members"`
+	Members []*db.Member `json:"members"`
 }
 
 // GetGroupMembers gets all members of a group
@@ -161,33 +194,124 @@ func (h *Handler) GetGroupMembers(c *gin.Context) {
 		return
 	}
 
-	// Verify user is a member of the group
-	userGroups, err := h.db.ListUserGroups(c.Request.Context(), user.ID)
+	if _, ok := h.requireMember(c, groupID, user.ID); !ok {
+		return
+	}
+
+	members, err := h.db.GetGroupMembers(c.Request.Context(), groupID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to list user groups")
+		log.Error().Err(err).Msg("Failed to get group members")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get group members"})
 		return
 	}
 
-	isMember := false
-	for _, ug := range userGroups {
-		if ug.ID == groupID {
-			isMember = true
-			break
-		}
+	c.JSON(http.StatusOK, GetGroupMembersResponse{Members: members})
+}
+
+// UpdateMemberRoleRequest represents the request body for changing a member's role
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin member"`
+}
+
+// UpdateMemberRole promotes a member to admin or demotes an admin. Only the
+// owner can change roles; ownership moves with TransferOwnership.
+func (h *Handler) UpdateMemberRole(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+	targetID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
 	}
 
-	if !isMember {
-		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+	var req UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	members, err := h.db.GetGroupMembers(c.Request.Context(), groupID)
+	if _, ok := h.authorize(c, groupID, user.ID, permManageRoles); !ok {
+		return
+	}
+	if targetID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Transfer ownership to change your own role"})
+		return
+	}
+
+	updated, err := h.db.UpdateGroupMemberRole(c.Request.Context(), groupID, targetID, req.Role)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get group members")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get group members"})
+		log.Error().Err(err).Msg("Failed to update group member role")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member role"})
+		return
+	}
+	if !updated {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, GetGroupMembersResponse{Members: members})
-}
\ No newline at end of file
+	c.JSON(http.StatusOK, gin.H{"message": "Member role updated"})
+}
+
+// TransferOwnershipRequest represents the request body for transferring group ownership
+type TransferOwnershipRequest struct {
+	UserID string `json:"userId" binding:"required,uuid"`
+}
+
+// TransferOwnership makes another member the owner of the group. The
+// previous owner stays on as an admin.
+func (h *Handler) TransferOwnership(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	newOwnerID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if _, ok := h.authorize(c, groupID, user.ID, permTransferOwnership); !ok {
+		return
+	}
+	if newOwnerID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already own this group"})
+		return
+	}
+
+	transferred, err := h.db.TransferGroupOwnership(c.Request.Context(), groupID, user.ID, newOwnerID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to transfer group ownership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return
+	}
+	if !transferred {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ownership transferred"})
+}
@@ -0,0 +1,303 @@
+package groups
+
+import (
+	"crypto/rand"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/db"
+)
+
+const (
+	// inviteCodeAlphabet leaves out characters that are easily confused
+	// when read aloud or typed (0/O, 1/I/L)
+	inviteCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	// inviteCodeLength gives about 40 bits of entropy
+	inviteCodeLength = 8
+	// inviteCodeAttempts bounds retries on the (unlikely) code collision
+	inviteCodeAttempts = 3
+)
+
+// InviteResponse represents an invite together with its shareable link
+type InviteResponse struct {
+	*db.GroupInvite
+	URL string `json:"url"`
+}
+
+// CreateInviteRequest represents the request body for creating an invite
+type CreateInviteRequest struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+	MaxUses   *int       `json:"maxUses" binding:"omitempty,min=1,max=10000"`
+}
+
+// CreateInvite creates an invite code for a group. Only owners and admins
+// can invite.
+func (h *Handler) CreateInvite(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	// The body is optional
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresAt must be in the future"})
+		return
+	}
+
+	if _, ok := h.authorize(c, groupID, user.ID, permInvite); !ok {
+		return
+	}
+
+	var invite *db.GroupInvite
+	for attempt := 0; invite == nil && attempt < inviteCodeAttempts; attempt++ {
+		code, err := newInviteCode()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to generate invite code")
+			break
+		}
+		invite, err = h.db.CreateGroupInvite(c.Request.Context(), groupID, user.ID, code, req.ExpiresAt, req.MaxUses)
+		if err != nil && !db.IsUniqueViolation(err) {
+			log.Error().Err(err).Msg("Failed to create group invite")
+			break
+		}
+	}
+	if invite == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, h.inviteResponse(invite))
+}
+
+// ListInvitesResponse represents the response for listing invites
+type ListInvitesResponse struct {
+	Invites []InviteResponse `json:"invites"`
+}
+
+// ListInvites lists a group's invites that can still be used. Only owners
+// and admins can see invites.
+func (h *Handler) ListInvites(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	if _, ok := h.authorize(c, groupID, user.ID, permInvite); !ok {
+		return
+	}
+
+	invites, err := h.db.ListGroupInvites(c.Request.Context(), groupID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list group invites")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list invites"})
+		return
+	}
+
+	resp := ListInvitesResponse{Invites: make([]InviteResponse, len(invites))}
+	for i, invite := range invites {
+		resp.Invites[i] = h.inviteResponse(invite)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeInvite revokes an invite so it can no longer be accepted
+func (h *Handler) RevokeInvite(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+	inviteID, err := uuid.Parse(c.Param("inviteId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+		return
+	}
+
+	if _, ok := h.authorize(c, groupID, user.ID, permInvite); !ok {
+		return
+	}
+
+	revoked, err := h.db.RevokeGroupInvite(c.Request.Context(), groupID, inviteID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to revoke group invite")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked"})
+}
+
+// InvitePreviewResponse represents the response for looking up an invite
+// code, letting the app show what the user is about to join
+type InvitePreviewResponse struct {
+	Group     *db.Group  `json:"group"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// GetInvite looks up the group an invite code leads to
+func (h *Handler) GetInvite(c *gin.Context) {
+	invite, group, ok := h.lookupInvite(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, InvitePreviewResponse{Group: group, ExpiresAt: invite.ExpiresAt})
+}
+
+// AcceptInviteResponse represents the response for accepting an invite
+type AcceptInviteResponse struct {
+	Group   *db.Group `json:"group"`
+	Message string    `json:"message"`
+}
+
+// AcceptInvite adds the user to the group of a valid invite code
+func (h *Handler) AcceptInvite(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	invite, group, ok := h.lookupInvite(c)
+	if !ok {
+		return
+	}
+
+	// Existing members don't use up the invite
+	isMember, err := h.db.IsGroupMember(c.Request.Context(), group.ID, user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check group membership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invite"})
+		return
+	}
+	if isMember {
+		c.JSON(http.StatusOK, AcceptInviteResponse{Group: group, Message: "Already a member of this group"})
+		return
+	}
+
+	redeemed, err := h.db.RedeemGroupInvite(c.Request.Context(), invite.ID, user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to redeem group invite")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invite"})
+		return
+	}
+	if !redeemed {
+		// Used up or revoked since it was looked up
+		c.JSON(http.StatusGone, gin.H{"error": "Invite is no longer valid"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AcceptInviteResponse{Group: group, Message: "Successfully joined group"})
+}
+
+// lookupInvite resolves the invite code in the URL to a usable invite and
+// its group. It writes an error response and returns false if the code is
+// unknown, revoked, expired or used up.
+func (h *Handler) lookupInvite(c *gin.Context) (*db.GroupInvite, *db.Group, bool) {
+	invite, err := h.db.GetGroupInviteByCode(c.Request.Context(), normalizeInviteCode(c.Param("code")))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group invite")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get invite"})
+		return nil, nil, false
+	}
+	if invite == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return nil, nil, false
+	}
+
+	switch {
+	case invite.RevokedAt != nil:
+		c.JSON(http.StatusGone, gin.H{"error": "Invite has been revoked"})
+		return nil, nil, false
+	case invite.ExpiresAt != nil && !invite.ExpiresAt.After(time.Now()):
+		c.JSON(http.StatusGone, gin.H{"error": "Invite has expired"})
+		return nil, nil, false
+	case invite.MaxUses != nil && invite.Uses >= *invite.MaxUses:
+		c.JSON(http.StatusGone, gin.H{"error": "Invite has been used up"})
+		return nil, nil, false
+	}
+
+	group, err := h.db.GetGroupByID(c.Request.Context(), invite.GroupID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get invite"})
+		return nil, nil, false
+	}
+	if group == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return nil, nil, false
+	}
+
+	return invite, group, true
+}
+
+// inviteResponse attaches the shareable link to an invite
+func (h *Handler) inviteResponse(invite *db.GroupInvite) InviteResponse {
+	return InviteResponse{GroupInvite: invite, URL: h.inviteURLBase + invite.Code}
+}
+
+// newInviteCode generates a random invite code
+func newInviteCode() (string, error) {
+	max := big.NewInt(int64(len(inviteCodeAlphabet)))
+	code := make([]byte, inviteCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = inviteCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalizeInviteCode accepts codes typed in lower case or with separators,
+// e.g. "abcd-efgh"
+func normalizeInviteCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
@@ -0,0 +1,328 @@
+package groups
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/db"
+)
+
+// UpdateGroupRequest represents the request body for updating a group
+type UpdateGroupRequest struct {
+	Name              *string `json:"name" binding:"omitempty,min=1,max=100"`
+	AllowIDJoin       *bool   `json:"allowIdJoin"`
+	AllowJoinRequests *bool   `json:"allowJoinRequests"`
+}
+
+// UpdateGroupResponse represents the response for updating a group
+type UpdateGroupResponse struct {
+	Group *db.Group `json:"group"`
+}
+
+// UpdateGroup renames a group or changes how it can be joined. Renaming
+// requires owner or admin; the join settings control who can get in, so
+// they take the invite permission.
+func (h *Handler) UpdateGroup(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == nil && req.AllowIDJoin == nil && req.AllowJoinRequests == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	member, ok := h.authorize(c, groupID, user.ID, permRename)
+	if !ok {
+		return
+	}
+	if (req.AllowIDJoin != nil || req.AllowJoinRequests != nil) && !can(member.Role, permInvite) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to do this in this group"})
+		return
+	}
+
+	group, err := h.db.GetGroupByID(c.Request.Context(), groupID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+	if group == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	var notify []db.NewNotification
+	if req.Name != nil && *req.Name != group.Name {
+		notify, err = h.notifyMembers(c.Request.Context(), group, user.ID, db.NotificationGroupRenamed, *req.Name,
+			func(locale string) string { return renamedMessage(locale, user.Name, group.Name, *req.Name) })
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get group members")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+			return
+		}
+	}
+
+	updated, err := h.db.UpdateGroup(c.Request.Context(), groupID, db.GroupUpdate{
+		Name:              req.Name,
+		AllowIDJoin:       req.AllowIDJoin,
+		AllowJoinRequests: req.AllowJoinRequests,
+	}, notify)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+	if updated == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, UpdateGroupResponse{Group: updated})
+}
+
+// DeleteGroup deletes a group. Only the owner can delete it; the other
+// members are notified.
+func (h *Handler) DeleteGroup(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	if _, ok := h.authorize(c, groupID, user.ID, permDelete); !ok {
+		return
+	}
+
+	h.deleteGroup(c, groupID, user)
+}
+
+// LeaveGroup removes the user from a group and notifies the remaining
+// members. The owner has to transfer ownership first, unless they are the
+// last member, in which case the group is deleted.
+func (h *Handler) LeaveGroup(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	member, ok := h.requireMember(c, groupID, user.ID)
+	if !ok {
+		return
+	}
+
+	group, err := h.db.GetGroupByID(c.Request.Context(), groupID)
+	if err != nil || group == nil {
+		log.Error().Err(err).Msg("Failed to get group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave group"})
+		return
+	}
+
+	notify, err := h.notifyMembers(c.Request.Context(), group, user.ID, db.NotificationMemberLeft, group.Name,
+		func(locale string) string { return leftMessage(locale, user.Name, group.Name) })
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group members")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave group"})
+		return
+	}
+
+	if member.Role == db.RoleOwner {
+		if len(notify) > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Transfer ownership before leaving the group"})
+			return
+		}
+		h.deleteGroup(c, groupID, user)
+		return
+	}
+
+	removed, err := h.db.RemoveGroupMember(c.Request.Context(), groupID, user.ID, notify)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to remove group member")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave group"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You are not a member of this group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully left group"})
+}
+
+// RemoveMember removes another member from a group and notifies them.
+// Owners and admins can only remove members with a lower role.
+func (h *Handler) RemoveMember(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+	targetID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if targetID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use leave to remove yourself from a group"})
+		return
+	}
+
+	actor, ok := h.authorize(c, groupID, user.ID, permRemoveMembers)
+	if !ok {
+		return
+	}
+
+	target, err := h.db.GetGroupMember(c.Request.Context(), groupID, targetID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group member")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	if target == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	if !outranks(actor.Role, target.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only remove members with a lower role"})
+		return
+	}
+
+	group, err := h.db.GetGroupByID(c.Request.Context(), groupID)
+	if err != nil || group == nil {
+		log.Error().Err(err).Msg("Failed to get group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	targetUser, err := h.db.GetUserByID(c.Request.Context(), targetID)
+	if err != nil || targetUser == nil {
+		log.Error().Err(err).Msg("Failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	notify := []db.NewNotification{{
+		UserID:  targetID,
+		GroupID: groupID,
+		Type:    db.NotificationMemberRemoved,
+		Title:   group.Name,
+		Message: removedMessage(targetUser.Locale, group.Name),
+	}}
+
+	removed, err := h.db.RemoveGroupMember(c.Request.Context(), groupID, targetID, notify)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to remove group member")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// deleteGroup deletes a group on behalf of user, notifying everyone else
+func (h *Handler) deleteGroup(c *gin.Context, groupID uuid.UUID, user *auth.User) {
+	group, err := h.db.GetGroupByID(c.Request.Context(), groupID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+	if group == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	notify, err := h.notifyMembers(c.Request.Context(), group, user.ID, db.NotificationGroupDeleted, group.Name,
+		func(locale string) string { return deletedMessage(locale, user.Name, group.Name) })
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group members")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+
+	deleted, err := h.db.DeleteGroup(c.Request.Context(), groupID, notify)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted"})
+}
+
+// notifyMembers builds one notification for every member of a group except
+// the user who caused it. message renders the text in a member's locale.
+func (h *Handler) notifyMembers(ctx context.Context, group *db.Group, actorID uuid.UUID, notificationType, title string, message func(locale string) string) ([]db.NewNotification, error) {
+	return h.notifyMembersWhere(ctx, group, actorID, func(*db.Member) bool { return true }, notificationType, title, message)
+}
+
+// notifyMembersWhere is notifyMembers restricted to members matching include
+func (h *Handler) notifyMembersWhere(ctx context.Context, group *db.Group, actorID uuid.UUID, include func(*db.Member) bool, notificationType, title string, message func(locale string) string) ([]db.NewNotification, error) {
+	members, err := h.db.GetGroupMembers(ctx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var notify []db.NewNotification
+	for _, member := range members {
+		if member.ID == actorID || !include(member) {
+			continue
+		}
+		notify = append(notify, db.NewNotification{
+			UserID:  member.ID,
+			GroupID: group.ID,
+			Type:    notificationType,
+			Title:   title,
+			Message: message(member.Locale),
+		})
+	}
+	return notify, nil
+}
@@ -0,0 +1,116 @@
+package groups
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+
+	"github.com/marko/backend/internal/i18n"
+)
+
+// messageTemplates holds the text of group notifications for each supported
+// language. Notification titles are the group name and are not translated.
+type messageTemplates struct {
+	// renamed takes the actor's name, the old and the new group name
+	renamed string
+	// left takes the member's name and the group name
+	left string
+	// removed takes the group name
+	removed string
+	// deleted takes the actor's name and the group name
+	deleted string
+	// joinRequested takes the requester's name and the group name
+	joinRequested string
+	// joinApproved and joinDeclined take the group name
+	joinApproved string
+	joinDeclined string
+}
+
+// templates has an entry for every language in i18n.Supported
+var templates = map[language.Tag]messageTemplates{
+	language.English: {
+		renamed:       "%s renamed %s to %s",
+		left:          "%s left %s",
+		removed:       "You were removed from %s",
+		deleted:       "%s deleted %s",
+		joinRequested: "%s asked to join %s",
+		joinApproved:  "Your request to join %s was approved",
+		joinDeclined:  "Your request to join %s was declined",
+	},
+	language.Spanish: {
+		renamed:       "%s cambió el nombre de %s a %s",
+		left:          "%s salió de %s",
+		removed:       "Te han eliminado de %s",
+		deleted:       "%s eliminó %s",
+		joinRequested: "%s ha pedido unirse a %s",
+		joinApproved:  "Tu solicitud para unirte a %s fue aprobada",
+		joinDeclined:  "Tu solicitud para unirte a %s fue rechazada",
+	},
+	language.French: {
+		renamed:       "%s a renommé %s en %s",
+		left:          "%s a quitté %s",
+		removed:       "Vous avez été retiré(e) de %s",
+		deleted:       "%s a supprimé %s",
+		joinRequested: "%s a demandé à rejoindre %s",
+		joinApproved:  "Votre demande pour rejoindre %s a été acceptée",
+		joinDeclined:  "Votre demande pour rejoindre %s a été refusée",
+	},
+	language.German: {
+		renamed:       "%s hat %s in %s umbenannt",
+		left:          "%s hat %s verlassen",
+		removed:       "Du wurdest aus %s entfernt",
+		deleted:       "%s hat %s gelöscht",
+		joinRequested: "%s möchte %s beitreten",
+		joinApproved:  "Deine Anfrage, %s beizutreten, wurde angenommen",
+		joinDeclined:  "Deine Anfrage, %s beizutreten, wurde abgelehnt",
+	},
+	language.Portuguese: {
+		renamed:       "%s mudou o nome de %s para %s",
+		left:          "%s saiu de %s",
+		removed:       "Você foi removido(a) de %s",
+		deleted:       "%s excluiu %s",
+		joinRequested: "%s pediu para entrar em %s",
+		joinApproved:  "Seu pedido para entrar em %s foi aprovado",
+		joinDeclined:  "Seu pedido para entrar em %s foi recusado",
+	},
+}
+
+// renamedMessage renders the notification for a renamed group
+func renamedMessage(locale, actor, oldName, newName string) string {
+	t, _ := i18n.Lookup(templates, locale)
+	return fmt.Sprintf(t.renamed, actor, oldName, newName)
+}
+
+// leftMessage renders the notification for a member leaving a group
+func leftMessage(locale, member, group string) string {
+	t, _ := i18n.Lookup(templates, locale)
+	return fmt.Sprintf(t.left, member, group)
+}
+
+// removedMessage renders the notification for the member removed from a group
+func removedMessage(locale, group string) string {
+	t, _ := i18n.Lookup(templates, locale)
+	return fmt.Sprintf(t.removed, group)
+}
+
+// deletedMessage renders the notification for a deleted group
+func deletedMessage(locale, actor, group string) string {
+	t, _ := i18n.Lookup(templates, locale)
+	return fmt.Sprintf(t.deleted, actor, group)
+}
+
+// joinRequestedMessage renders the notification for admins about a join request
+func joinRequestedMessage(locale, requester, group string) string {
+	t, _ := i18n.Lookup(templates, locale)
+	return fmt.Sprintf(t.joinRequested, requester, group)
+}
+
+// joinDecidedMessage renders the notification telling a requester whether
+// their join request was approved
+func joinDecidedMessage(locale, group string, approved bool) string {
+	t, _ := i18n.Lookup(templates, locale)
+	if approved {
+		return fmt.Sprintf(t.joinApproved, group)
+	}
+	return fmt.Sprintf(t.joinDeclined, group)
+}
@@ -0,0 +1,55 @@
+package groups
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/marko/backend/internal/i18n"
+)
+
+func TestTemplatesCoverSupportedLanguages(t *testing.T) {
+	english := templates[i18n.Supported[0]]
+	for _, tag := range i18n.Supported {
+		tmpl, ok := templates[tag]
+		if !ok {
+			t.Errorf("no group messages for %s", tag)
+			continue
+		}
+		pairs := [][2]string{
+			{tmpl.renamed, english.renamed},
+			{tmpl.left, english.left},
+			{tmpl.removed, english.removed},
+			{tmpl.deleted, english.deleted},
+			{tmpl.joinRequested, english.joinRequested},
+			{tmpl.joinApproved, english.joinApproved},
+			{tmpl.joinDeclined, english.joinDeclined},
+		}
+		for _, pair := range pairs {
+			if strings.Count(pair[0], "%s") != strings.Count(pair[1], "%s") {
+				t.Errorf("%s message %q takes different arguments than %q", tag, pair[0], pair[1])
+			}
+		}
+	}
+}
+
+func TestGroupMessages(t *testing.T) {
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{got: renamedMessage("en", "Ana", "Trip", "Summer trip"), want: "Ana renamed Trip to Summer trip"},
+		{got: renamedMessage("de", "Ana", "Trip", "Sommer"), want: "Ana hat Trip in Sommer umbenannt"},
+		{got: leftMessage("es-MX", "Ana", "Familia"), want: "Ana salió de Familia"},
+		{got: removedMessage("fr", "Famille"), want: "Vous avez été retiré(e) de Famille"},
+		{got: deletedMessage("pt-BR", "Ana", "Família"), want: "Ana excluiu Família"},
+		{got: deletedMessage("ja", "Ana", "Family"), want: "Ana deleted Family"},
+		{got: joinRequestedMessage("de", "Ana", "Familie"), want: "Ana möchte Familie beitreten"},
+		{got: joinDecidedMessage("en", "Family", true), want: "Your request to join Family was approved"},
+		{got: joinDecidedMessage("es", "Familia", false), want: "Tu solicitud para unirte a Familia fue rechazada"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package groups
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/db"
+)
+
+// permission is an action on a group that requires a minimum role
+type permission int
+
+const (
+	permRename permission = iota
+	permDelete
+	permInvite
+	permRemoveMembers
+	permManageRoles
+	permTransferOwnership
+	permManageWebhooks
+)
+
+// rolePermissions lists what each role may do beyond viewing the group
+var rolePermissions = map[string]map[permission]bool{
+	db.RoleOwner: {
+		permRename:            true,
+		permDelete:            true,
+		permInvite:            true,
+		permRemoveMembers:     true,
+		permManageRoles:       true,
+		permTransferOwnership: true,
+		permManageWebhooks:    true,
+	},
+	db.RoleAdmin: {
+		permRename:         true,
+		permInvite:         true,
+		permRemoveMembers:  true,
+		permManageWebhooks: true,
+	},
+	db.RoleMember: {},
+}
+
+// roleRank orders roles so that members can only act on those below them
+var roleRank = map[string]int{
+	db.RoleOwner:  2,
+	db.RoleAdmin:  1,
+	db.RoleMember: 0,
+}
+
+// can reports whether a role grants a permission
+func can(role string, p permission) bool {
+	return rolePermissions[role][p]
+}
+
+// outranks reports whether a member with role may act on one with target,
+// e.g. an admin may remove a member but not another admin or the owner
+func outranks(role, target string) bool {
+	return roleRank[role] > roleRank[target]
+}
+
+// requireMember loads the user's membership in a group. It writes a 403
+// response and returns false if the user is not a member.
+func (h *Handler) requireMember(c *gin.Context, groupID, userID uuid.UUID) (*db.GroupMember, bool) {
+	member, err := h.db.GetGroupMember(c.Request.Context(), groupID, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group member")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	if member == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+		return nil, false
+	}
+	return member, true
+}
+
+// authorize is requireMember plus a check that the user's role grants the
+// permission
+func (h *Handler) authorize(c *gin.Context, groupID, userID uuid.UUID, p permission) (*db.GroupMember, bool) {
+	member, ok := h.requireMember(c, groupID, userID)
+	if !ok {
+		return nil, false
+	}
+	if !can(member.Role, p) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to do this in this group"})
+		return nil, false
+	}
+	return member, true
+}
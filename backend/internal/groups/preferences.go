@@ -0,0 +1,91 @@
+package groups
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/db"
+)
+
+// PreferencesResponse represents the user's notification preferences for a group
+type PreferencesResponse struct {
+	Preferences db.NotificationPreferences `json:"preferences"`
+}
+
+// GetPreferences returns the user's notification preferences for a group
+func (h *Handler) GetPreferences(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	member, ok := h.requireMember(c, groupID, user.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, PreferencesResponse{Preferences: member.NotificationPreferences})
+}
+
+// UpdatePreferencesRequest represents the request body for updating
+// notification preferences. It replaces all preferences; a null or missing
+// mutedUntil unmutes the group and a missing email turns emails off.
+type UpdatePreferencesRequest struct {
+	MutedUntil *time.Time `json:"mutedUntil"`
+	NotifyOn   string     `json:"notifyOn" binding:"required,oneof=all arrivals departures"`
+	Delivery   string     `json:"delivery" binding:"required,oneof=instant digest"`
+	Email      bool       `json:"email"`
+}
+
+// UpdatePreferences sets the user's notification preferences for a group
+func (h *Handler) UpdatePreferences(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req UpdatePreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := h.db.UpdateGroupMemberPreferences(c.Request.Context(), groupID, user.ID, db.NotificationPreferences{
+		MutedUntil: req.MutedUntil,
+		NotifyOn:   req.NotifyOn,
+		Delivery:   req.Delivery,
+		Email:      req.Email,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update notification preferences")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preferences"})
+		return
+	}
+	if member == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PreferencesResponse{Preferences: member.NotificationPreferences})
+}
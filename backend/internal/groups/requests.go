@@ -0,0 +1,223 @@
+package groups
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/db"
+)
+
+// JoinRequestRequest represents the request body for asking to join a group
+type JoinRequestRequest struct {
+	Message *string `json:"message" binding:"omitempty,max=500"`
+}
+
+// JoinRequestResponse represents a single join request
+type JoinRequestResponse struct {
+	Request *db.GroupJoinRequest `json:"request"`
+}
+
+// RequestToJoin asks to join a group that accepts join requests. The
+// group's owner and admins are notified; asking again while a request is
+// pending returns the existing request, and asking again within a day of a
+// rejection is refused.
+func (h *Handler) RequestToJoin(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	// The body is optional
+	var req JoinRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, err := h.db.GetGroupByID(c.Request.Context(), groupID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request to join group"})
+		return
+	}
+	if group == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+	if !group.AllowJoinRequests {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This group does not accept join requests"})
+		return
+	}
+
+	isMember, err := h.db.IsGroupMember(c.Request.Context(), groupID, user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check group membership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request to join group"})
+		return
+	}
+	if isMember {
+		c.JSON(http.StatusConflict, gin.H{"error": "You are already a member of this group"})
+		return
+	}
+
+	notify, err := h.notifyMembersWhere(c.Request.Context(), group, user.ID,
+		func(m *db.Member) bool { return can(m.Role, permInvite) },
+		db.NotificationJoinRequested, group.Name,
+		func(locale string) string { return joinRequestedMessage(locale, user.Name, group.Name) })
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group members")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request to join group"})
+		return
+	}
+
+	request, created, err := h.db.CreateGroupJoinRequest(c.Request.Context(), groupID, user.ID, req.Message, notify)
+	if errors.Is(err, db.ErrJoinRequestCooldown) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Your last request to join this group was declined; try again later"})
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create group join request")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request to join group"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, JoinRequestResponse{Request: request})
+}
+
+// ListJoinRequestsResponse represents the response for listing join requests
+type ListJoinRequestsResponse struct {
+	Requests []*db.GroupJoinRequest `json:"requests"`
+}
+
+// ListJoinRequests lists a group's pending join requests. Only owners and
+// admins can see them.
+func (h *Handler) ListJoinRequests(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	if _, ok := h.authorize(c, groupID, user.ID, permInvite); !ok {
+		return
+	}
+
+	requests, err := h.db.ListPendingGroupJoinRequests(c.Request.Context(), groupID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list group join requests")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list join requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListJoinRequestsResponse{Requests: requests})
+}
+
+// ApproveJoinRequest adds the requester to the group
+func (h *Handler) ApproveJoinRequest(c *gin.Context) {
+	h.decideJoinRequest(c, true)
+}
+
+// RejectJoinRequest declines a join request
+func (h *Handler) RejectJoinRequest(c *gin.Context) {
+	h.decideJoinRequest(c, false)
+}
+
+// decideJoinRequest approves or rejects a pending request and notifies the
+// requester. Deciding requires the same permission as inviting.
+func (h *Handler) decideJoinRequest(c *gin.Context, approve bool) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+	requestID, err := uuid.Parse(c.Param("requestId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	if _, ok := h.authorize(c, groupID, user.ID, permInvite); !ok {
+		return
+	}
+
+	group, err := h.db.GetGroupByID(c.Request.Context(), groupID)
+	if err != nil || group == nil {
+		log.Error().Err(err).Msg("Failed to get group")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decide join request"})
+		return
+	}
+
+	request, err := h.db.GetGroupJoinRequest(c.Request.Context(), groupID, requestID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get group join request")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decide join request"})
+		return
+	}
+	if request == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Join request not found"})
+		return
+	}
+
+	requester, err := h.db.GetUserByID(c.Request.Context(), request.UserID)
+	if err != nil || requester == nil {
+		log.Error().Err(err).Msg("Failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decide join request"})
+		return
+	}
+
+	notification := db.NewNotification{
+		UserID:  request.UserID,
+		GroupID: groupID,
+		Type:    db.NotificationJoinRejected,
+		Title:   group.Name,
+		Message: joinDecidedMessage(requester.Locale, group.Name, approve),
+	}
+	if approve {
+		notification.Type = db.NotificationJoinApproved
+	}
+
+	decided, err := h.db.DecideGroupJoinRequest(c.Request.Context(), groupID, requestID, user.ID, approve, []db.NewNotification{notification})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to decide group join request")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decide join request"})
+		return
+	}
+	if decided == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Join request has already been decided"})
+		return
+	}
+
+	c.JSON(http.StatusOK, JoinRequestResponse{Request: decided})
+}
@@ -0,0 +1,162 @@
+package groups
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/db"
+)
+
+// webhookSecretBytes is the amount of randomness in a webhook signing secret
+const webhookSecretBytes = 32
+
+// CreateWebhookRequest represents the request body for adding a webhook
+type CreateWebhookRequest struct {
+	URL      string `json:"url" binding:"required,url,max=2048"`
+	NotifyOn string `json:"notifyOn" binding:"omitempty,oneof=all arrivals departures"`
+}
+
+// CreateWebhookResponse represents the response for adding a webhook. The
+// signing secret is only ever returned here.
+type CreateWebhookResponse struct {
+	*db.GroupWebhook
+	Secret string `json:"secret"`
+}
+
+// CreateWebhook adds a webhook that the group's location updates are posted
+// to. Only owners and admins can manage webhooks.
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if parsed, err := url.Parse(req.URL); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an http or https URL"})
+		return
+	}
+	if req.NotifyOn == "" {
+		req.NotifyOn = db.NotifyOnAll
+	}
+
+	if _, ok := h.authorize(c, groupID, user.ID, permManageWebhooks); !ok {
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate webhook secret")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	webhook, err := h.db.CreateGroupWebhook(c.Request.Context(), groupID, user.ID, req.URL, secret, req.NotifyOn)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create group webhook")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateWebhookResponse{GroupWebhook: webhook, Secret: webhook.Secret})
+}
+
+// ListWebhooksResponse represents the response for listing webhooks
+type ListWebhooksResponse struct {
+	Webhooks []*db.GroupWebhook `json:"webhooks"`
+}
+
+// ListWebhooks lists a group's webhooks, without their secrets
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	if _, ok := h.authorize(c, groupID, user.ID, permManageWebhooks); !ok {
+		return
+	}
+
+	webhooks, err := h.db.ListGroupWebhooks(c.Request.Context(), groupID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list group webhooks")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListWebhooksResponse{Webhooks: webhooks})
+}
+
+// DeleteWebhook removes a webhook; deliveries still queued for it are dropped
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+	webhookID, err := uuid.Parse(c.Param("webhookId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	if _, ok := h.authorize(c, groupID, user.ID, permManageWebhooks); !ok {
+		return
+	}
+
+	deleted, err := h.db.DeleteGroupWebhook(c.Request.Context(), groupID, webhookID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete group webhook")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// newWebhookSecret generates a random signing secret
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,38 @@
+// Package i18n picks the language notification text is rendered in. Each
+// package keeps its own message table keyed by language; this package maps
+// a recipient's locale onto one of the supported languages.
+package i18n
+
+import "golang.org/x/text/language"
+
+// Supported lists the languages notifications are translated into; the
+// first entry is the fallback
+var Supported = []language.Tag{
+	language.English,
+	language.Spanish,
+	language.French,
+	language.German,
+	language.Portuguese,
+}
+
+var matcher = language.NewMatcher(Supported)
+
+// Match returns the supported language closest to a BCP 47 locale such as
+// "pt-BR", falling back to English for unknown or invalid locales
+func Match(locale string) language.Tag {
+	tag, _ := language.MatchStrings(matcher, locale)
+	base, _ := tag.Base()
+	return language.Make(base.String())
+}
+
+// Lookup returns the entry of a message table for a locale along with the
+// matched language, e.g. "pt" for "pt-BR". Country names should be rendered
+// in the returned language, so an unsupported locale gets an all-English
+// message rather than a mix of languages.
+func Lookup[T any](table map[language.Tag]T, locale string) (T, string) {
+	tag := Match(locale)
+	if t, ok := table[tag]; ok {
+		return t, tag.String()
+	}
+	return table[language.English], language.English.String()
+}
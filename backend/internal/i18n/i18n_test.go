@@ -0,0 +1,45 @@
+package i18n
+
+import (
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestLookup(t *testing.T) {
+	table := map[language.Tag]string{
+		language.English:    "hello",
+		language.Spanish:    "hola",
+		language.French:     "bonjour",
+		language.German:     "hallo",
+		language.Portuguese: "olá",
+	}
+	tests := []struct {
+		locale   string
+		want     string
+		wantLang string
+	}{
+		{locale: "en", want: "hello", wantLang: "en"},
+		{locale: "en-GB", want: "hello", wantLang: "en"},
+		{locale: "es-MX", want: "hola", wantLang: "es"},
+		{locale: "fr", want: "bonjour", wantLang: "fr"},
+		{locale: "de-AT", want: "hallo", wantLang: "de"},
+		{locale: "pt-BR", want: "olá", wantLang: "pt"},
+		{locale: "ja", want: "hello", wantLang: "en"},
+		{locale: "", want: "hello", wantLang: "en"},
+		{locale: "not a locale", want: "hello", wantLang: "en"},
+	}
+	for _, tt := range tests {
+		got, lang := Lookup(table, tt.locale)
+		if got != tt.want || lang != tt.wantLang {
+			t.Errorf("Lookup(%q) = %q, %q, want %q, %q", tt.locale, got, lang, tt.want, tt.wantLang)
+		}
+	}
+}
+
+func TestLookupMissingTranslation(t *testing.T) {
+	table := map[language.Tag]string{language.English: "hello"}
+	if got, lang := Lookup(table, "de"); got != "hello" || lang != "en" {
+		t.Errorf("Lookup(de) = %q, %q, want the English fallback", got, lang)
+	}
+}
@@ -0,0 +1,244 @@
+package locations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/db"
+)
+
+// FanOut turns location.updated outbox events into one notification per
+// recipient, however many groups they share with the traveler, and one
+// delivery per matching group webhook. Each delivery is queued separately.
+type FanOut struct {
+	db             *db.DB
+	debounceWindow time.Duration
+}
+
+// NewFanOut creates a new location fan-out handler. debounceWindow must match
+// the locations handler's, so updates followed within the window are
+// recognized as superseded.
+func NewFanOut(database *db.DB, debounceWindow time.Duration) *FanOut {
+	return &FanOut{db: database, debounceWindow: debounceWindow}
+}
+
+// webhookPayload is the body posted to group webhooks. Text is a ready-made
+// message, so chat services that accept {"text": ...} can be used directly.
+type webhookPayload struct {
+	Event           string       `json:"event"`
+	Text            string       `json:"text"`
+	Group           webhookGroup `json:"group"`
+	User            webhookUser  `json:"user"`
+	Status          string       `json:"status"`
+	CountryCode     string       `json:"country_code"`
+	FromCountryCode string       `json:"from_country_code,omitempty"`
+	LocationID      uuid.UUID    `json:"location_id"`
+	OccurredAt      time.Time    `json:"occurred_at"`
+}
+
+// webhookGroup identifies the group a webhook belongs to
+type webhookGroup struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// webhookUser identifies the traveler
+type webhookUser struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+// HandleLocationUpdated notifies the members of every group the traveler
+// belongs to, according to each member's notification preferences and
+// country watchlist, and posts the update to the groups' webhooks. The
+// location event, its notifications and webhook deliveries are created in a
+// single transaction, so a retry never produces duplicates.
+func (f *FanOut) HandleLocationUpdated(ctx context.Context, event *db.OutboxEvent) error {
+	var payload db.LocationUpdatedEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to decode location event: %w", err)
+	}
+
+	location, err := f.db.GetUserLocation(ctx, payload.LocationID)
+	if err != nil {
+		return err
+	}
+	if location == nil {
+		// Deleted along with the user before we got to it
+		return nil
+	}
+
+	// Skip updates that were followed within the debounce window, so
+	// flapping at a border collapses into the final state; the newer update
+	// carries its own event. Updates followed later were settled states and
+	// are still announced, even when the worker is behind.
+	next, err := f.db.GetNextUserLocation(ctx, location)
+	if err != nil {
+		return err
+	}
+	if next != nil && next.UpdatedAt.Sub(location.UpdatedAt) < f.debounceWindow {
+		log.Debug().Str("location_id", payload.LocationID.String()).Msg("Skipping superseded location update")
+		return nil
+	}
+
+	// Compare against the last state members were told about rather than
+	// the raw history, which may hold updates that were never announced
+	previous, err := f.db.GetLastLocationEvent(ctx, payload.UserID)
+	if err != nil {
+		return err
+	}
+	var previousID *uuid.UUID
+	if previous != nil {
+		if !previous.OccurredAt.Before(location.UpdatedAt) {
+			log.Debug().Str("location_id", payload.LocationID.String()).Msg("Skipping location update older than the last announced one")
+			return nil
+		}
+		if previous.Status == payload.Status && previous.CountryCode == payload.CountryCode {
+			log.Debug().Str("location_id", payload.LocationID.String()).Msg("Skipping location update unchanged since the last announced one")
+			return nil
+		}
+		previousID = &previous.ID
+	}
+
+	// An arrival reported as a country change names the country left. Use
+	// the one members last heard the traveler arrive in, since the raw
+	// previous row may be an update that was never announced.
+	if payload.FromCountryCode != "" {
+		payload.FromCountryCode = ""
+		if previous != nil && previous.Status == "arrived" && previous.CountryCode != payload.CountryCode {
+			payload.FromCountryCode = previous.CountryCode
+		}
+	}
+
+	user, err := f.db.GetUserByID(ctx, payload.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		log.Warn().Str("user_id", payload.UserID.String()).Msg("Skipping location event for unknown user")
+		return nil
+	}
+
+	// Get user's groups to notify members
+	userGroups, err := f.db.ListUserGroups(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	// Messages are rendered in each recipient's locale
+	messages := make(map[string]string)
+	messageFor := func(locale string) string {
+		message, ok := messages[locale]
+		if !ok {
+			message = locationMessage(user.Name, payload.Status, payload.CountryCode, payload.FromCountryCode, locale)
+			messages[locale] = message
+		}
+		return message
+	}
+
+	now := time.Now()
+	leftCountry := payload.FromCountryCode != ""
+
+	// An update concerns the country arrived in or left, and the previous
+	// country when arriving somewhere new
+	concerned := []string{payload.CountryCode}
+	if leftCountry {
+		concerned = append(concerned, payload.FromCountryCode)
+	}
+
+	// A recipient sharing several groups with the traveler gets a single
+	// notification about all of them
+	byRecipient := make(map[uuid.UUID]*db.NewNotification)
+	var order []uuid.UUID
+	var deliveries []db.WebhookDeliveryEvent
+	for _, group := range userGroups {
+		webhooks, err := f.db.ListGroupWebhooks(ctx, group.ID)
+		if err != nil {
+			return err
+		}
+		// Groups have no locale, so webhook text falls back to English
+		for _, webhook := range webhooks {
+			if !webhook.Wants(payload.Status, leftCountry) {
+				continue
+			}
+			body, err := json.Marshal(webhookPayload{
+				Event:           db.EventLocationUpdated,
+				Text:            locationMessage(user.Name, payload.Status, payload.CountryCode, payload.FromCountryCode, ""),
+				Group:           webhookGroup{ID: group.ID, Name: group.Name},
+				User:            webhookUser{ID: user.ID, Name: user.Name},
+				Status:          payload.Status,
+				CountryCode:     payload.CountryCode,
+				FromCountryCode: payload.FromCountryCode,
+				LocationID:      payload.LocationID,
+				OccurredAt:      location.UpdatedAt,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to encode webhook payload: %w", err)
+			}
+			deliveries = append(deliveries, db.WebhookDeliveryEvent{WebhookID: webhook.ID, Payload: body})
+		}
+
+		recipients, err := f.db.ListGroupRecipients(ctx, group.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range recipients {
+			if r.UserID == user.ID {
+				continue // Don't notify the user who triggered the update
+			}
+			// Honor the recipient's preferences for this group
+			if r.Muted(now) || !r.Wants(payload.Status, leftCountry) {
+				continue
+			}
+			if r.Watchlist != nil && !r.Watchlist.Matches(concerned, r.CountryCode) {
+				continue
+			}
+
+			if n, ok := byRecipient[r.UserID]; ok {
+				n.OtherGroupIDs = append(n.OtherGroupIDs, group.ID)
+				n.Title += ", " + group.Name
+				// Any group asking for instant delivery wins
+				n.Digest = n.Digest && r.Delivery == db.DeliveryDigest
+				n.Email = n.Email || r.Email
+				continue
+			}
+			byRecipient[r.UserID] = &db.NewNotification{
+				UserID:  r.UserID,
+				GroupID: group.ID,
+				Type:    db.NotificationLocationUpdate,
+				Title:   group.Name,
+				Message: messageFor(r.Locale),
+				Digest:  r.Delivery == db.DeliveryDigest,
+				Email:   r.Email,
+			}
+			order = append(order, r.UserID)
+		}
+	}
+
+	newNotifications := make([]db.NewNotification, 0, len(order))
+	for _, userID := range order {
+		newNotifications = append(newNotifications, *byRecipient[userID])
+	}
+
+	locationEvent, err := f.db.CreateLocationEvent(ctx, payload, previousID, newNotifications, deliveries)
+	if err != nil {
+		return err
+	}
+	if locationEvent == nil {
+		log.Debug().Str("location_id", payload.LocationID.String()).Msg("Location update already fanned out")
+		return nil
+	}
+
+	log.Debug().
+		Str("location_id", payload.LocationID.String()).
+		Int("notifications", len(newNotifications)).
+		Int("webhooks", len(deliveries)).
+		Msg("Location update fanned out")
+	return nil
+}
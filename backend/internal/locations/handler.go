@@ -1,49 +1,87 @@
 package locations
 
 import (
-	"fmt"
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 
 	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/countries"
 	"github.com/marko/backend/internal/db"
-	"github.com/marko/backend/internal/notifications"
+	"github.com/marko/backend/internal/geo"
+	"github.com/marko/backend/internal/stream"
 )
 
 // Handler handles location-related HTTP requests
 type Handler struct {
-	db                    *db.DB
-	notificationService   *notifications.Service
+	db             *db.DB
+	geocoder       *geo.Index
+	debounceWindow time.Duration
+	hub            *stream.Hub
 }
 
-// NewHandler creates a new locations handler
-func NewHandler(database *db.DB, notificationService *notifications.Service) *Handler {
+// NewHandler creates a new locations handler. Updates arriving within
+// debounceWindow of the previous one have their notifications held back
+// until the window has passed. Presence changes are published on hub right
+// away.
+func NewHandler(database *db.DB, geocoder *geo.Index, debounceWindow time.Duration, hub *stream.Hub) *Handler {
 	return &Handler{
-		db:                    database,
-		notificationService:   notificationService,
+		db:             database,
+		geocoder:       geocoder,
+		debounceWindow: debounceWindow,
+		hub:            hub,
 	}
 }
 
+// Results of a location update
+const (
+	// ResultAccepted means the update was stored and notifications queued
+	ResultAccepted = "accepted"
+	// ResultDeduplicated means the update matched the current state and was dropped
+	ResultDeduplicated = "deduplicated"
+	// ResultDebounced means the update was stored but notifications are delayed
+	ResultDebounced = "debounced"
+)
+
 // RegisterRoutes registers all location-related routes
 func (h *Handler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
 	locations := router.Group("/locations")
 	locations.Use(authMiddleware)
 	{
 		locations.POST("", h.UpdateLocation)
+		locations.POST("/current", h.ReportCurrentCountry)
+	}
+
+	groups := router.Group("/groups")
+	groups.Use(authMiddleware)
+	{
+		groups.GET("/:id/presence", h.GetGroupPresence)
+	}
+
+	byCountry := router.Group("/countries")
+	byCountry.Use(authMiddleware)
+	{
+		byCountry.GET("/:code/members", h.ListCountryMembers)
 	}
 }
 
-// UpdateLocationRequest represents the request body for updating location
+// UpdateLocationRequest represents the request body for updating location.
+// Clients that only know their current country should use
+// ReportCurrentCountryRequest instead.
 type UpdateLocationRequest struct {
-	CountryCode string `json:"countryCode" binding:"required,len=2"`
-	Status      string `json:"status" binding:"required,oneof=arrived left"`
+	CountryCode string   `json:"countryCode" binding:"omitempty,len=2"`
+	Latitude    *float64 `json:"latitude" binding:"omitempty,latitude"`
+	Longitude   *float64 `json:"longitude" binding:"omitempty,longitude"`
+	Status      string   `json:"status" binding:"required,oneof=arrived left"`
 }
 
 // UpdateLocationResponse represents the response for updating location
 type UpdateLocationResponse struct {
 	Location *db.UserLocation `json:"location"`
+	Result   string           `json:"result"` // 'accepted', 'deduplicated' or 'debounced'
 	Message  string           `json:"message"`
 }
 
@@ -62,65 +100,200 @@ func (h *Handler) UpdateLocation(c *gin.Context) {
 		return
 	}
 
-	// Create the location update
-	location, err := h.db.CreateUserLocation(c.Request.Context(), user.ID, req.CountryCode, req.Status)
+	countryCode, ok := h.resolveCountry(c, req.CountryCode, req.Latitude, req.Longitude)
+	if !ok {
+		return
+	}
+
+	// Compare against the current state to skip no-op transitions
+	latest, err := h.db.GetLatestUserLocation(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get latest user location")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+
+	if latest != nil && latest.CountryCode == countryCode && latest.Status == req.Status {
+		c.JSON(http.StatusOK, UpdateLocationResponse{
+			Location: latest,
+			Result:   ResultDeduplicated,
+			Message:  "Location unchanged, no notifications sent",
+		})
+		return
+	}
+
+	result, notifyAt := h.schedule(latest)
+
+	// Create the location update; notifications are fanned out asynchronously
+	location, err := h.db.CreateUserLocation(c.Request.Context(), user.ID, countryCode, req.Status, notifyAt)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create user location")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
 		return
 	}
 
-	// Get user's groups to notify members
-	userGroups, err := h.db.ListUserGroups(c.Request.Context(), user.ID)
+	h.publishPresence(c.Request.Context(), user, location)
+
+	message := "Location updated, notifications queued"
+	if result == ResultDebounced {
+		message = "Location updated, notifications delayed"
+	}
+
+	c.JSON(http.StatusCreated, UpdateLocationResponse{
+		Location: location,
+		Result:   result,
+		Message:  message,
+	})
+}
+
+// ReportCurrentCountryRequest represents the request body for reporting the current country
+type ReportCurrentCountryRequest struct {
+	CountryCode string   `json:"countryCode" binding:"omitempty,len=2"`
+	Latitude    *float64 `json:"latitude" binding:"omitempty,latitude"`
+	Longitude   *float64 `json:"longitude" binding:"omitempty,longitude"`
+}
+
+// ReportCurrentCountryResponse represents the response for reporting the current country
+type ReportCurrentCountryResponse struct {
+	Locations []*db.UserLocation `json:"locations"`
+	Result    string             `json:"result"` // 'accepted', 'deduplicated' or 'debounced'
+	Message   string             `json:"message"`
+}
+
+// ReportCurrentCountry records the user's current country and lets the
+// server infer the transition from the previous location, e.g. reporting
+// "DE" while in "FR" records "left FR" followed by "arrived DE"
+func (h *Handler) ReportCurrentCountry(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to list user groups")
-		// Don't fail the request, just log the error
-		c.JSON(http.StatusCreated, UpdateLocationResponse{
-			Location: location,
-			Message:  "Location updated successfully",
-		})
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	// Notify group members
-	for _, group := range userGroups {
-		// Get group members (excluding the user who triggered the update)
-		members, err := h.db.GetGroupMembers(c.Request.Context(), group.ID)
-		if err != nil {
-			log.Error().Err(err).Str("group_id", group.ID.String()).Msg("Failed to get group members")
-			continue
-		}
+	var req ReportCurrentCountryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		// Create notification message
-		var message string
-		if req.Status == "arrived" {
-			message = fmt.Sprintf("%s has arrived in %s", user.Name, req.CountryCode)
-		} else {
-			message = fmt.Sprintf("%s has left %s", user.Name, req.CountryCode)
+	countryCode, ok := h.resolveCountry(c, req.CountryCode, req.Latitude, req.Longitude)
+	if !ok {
+		return
+	}
+
+	latest, err := h.db.GetLatestUserLocation(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get latest user location")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+
+	// Infer the transition from the previous location
+	var fromCountryCode string
+	if latest != nil && latest.Status == "arrived" {
+		if latest.CountryCode == countryCode {
+			c.JSON(http.StatusOK, ReportCurrentCountryResponse{
+				Locations: []*db.UserLocation{latest},
+				Result:    ResultDeduplicated,
+				Message:   "Location unchanged, no notifications sent",
+			})
+			return
 		}
+		fromCountryCode = latest.CountryCode
+	}
 
-		// Notify each member (excluding the user who triggered the update)
-		for _, member := range members {
-			if member.ID == user.ID {
-				continue // Don't notify the user who triggered the update
-			}
+	result, notifyAt := h.schedule(latest)
 
-			// Create notification in database
-			_, err := h.db.CreateNotification(c.Request.Context(), member.ID, group.ID, message)
-			if err != nil {
-				log.Error().Err(err).Str("member_id", member.ID.String()).Msg("Failed to create notification")
-				continue
-			}
+	locations, err := h.db.CreateUserLocationChange(c.Request.Context(), user.ID, fromCountryCode, countryCode, notifyAt)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create user location change")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+
+	h.publishPresence(c.Request.Context(), user, locations[len(locations)-1])
 
-			// Send push notification (stub for now)
-			if member.PushToken != nil && *member.PushToken != "" {
-				h.notificationService.SendPushNotification(*member.PushToken, message)
+	message := "Location updated, notifications queued"
+	if result == ResultDebounced {
+		message = "Location updated, notifications delayed"
+	}
+
+	c.JSON(http.StatusCreated, ReportCurrentCountryResponse{
+		Locations: locations,
+		Result:    result,
+		Message:   message,
+	})
+}
+
+// resolveCountry determines the country of a location report. Coordinates,
+// when given, are reverse geocoded on the server and take precedence over a
+// client-supplied country code, which is only used as a fallback (e.g. for
+// points just off the coast). Country codes are validated against the ISO
+// 3166 registry and normalized to upper case. It writes an error response
+// and returns false if no country can be determined.
+func (h *Handler) resolveCountry(c *gin.Context, countryCode string, lat, lng *float64) (string, bool) {
+	if (lat == nil) != (lng == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "latitude and longitude must be provided together"})
+		return "", false
+	}
+
+	if countryCode != "" {
+		normalized, ok := countries.Normalize(countryCode)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown country code"})
+			return "", false
+		}
+		countryCode = normalized
+	}
+
+	if lat != nil {
+		if resolved, ok := h.geocoder.CountryAt(*lat, *lng); ok {
+			if countryCode != "" && countryCode != resolved {
+				log.Debug().
+					Str("client_country", countryCode).
+					Str("resolved_country", resolved).
+					Msg("Client country code differs from reverse geocoded country")
 			}
+			return resolved, true
 		}
 	}
 
-	c.JSON(http.StatusCreated, UpdateLocationResponse{
-		Location: location,
-		Message:  "Location updated and notifications sent",
-	})
-}
\ No newline at end of file
+	if countryCode == "" {
+		if lat != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Coordinates are not inside any country"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "countryCode or latitude/longitude is required"})
+		}
+		return "", false
+	}
+	return countryCode, true
+}
+
+// schedule decides when notifications for a new update go out. Updates that
+// follow the previous one closely are held back for the debounce window, so
+// flapping at a border collapses into the final state.
+func (h *Handler) schedule(latest *db.UserLocation) (string, time.Time) {
+	now := time.Now()
+	if latest != nil && h.debounceWindow > 0 && now.Sub(latest.UpdatedAt) < h.debounceWindow {
+		return ResultDebounced, now.Add(h.debounceWindow)
+	}
+	return ResultAccepted, now
+}
+
+// publishPresence tells the user's group-mates with an open stream where the
+// user is now. Failures are only logged; the update itself succeeded.
+func (h *Handler) publishPresence(ctx context.Context, user *auth.User, location *db.UserLocation) {
+	mates, err := h.db.ListGroupMateIDs(ctx, user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list group mates for presence")
+		return
+	}
+
+	presence := &db.Presence{UserID: user.ID, Name: user.Name}
+	if location.Status == "arrived" {
+		presence.CountryCode = &location.CountryCode
+		presence.Since = &location.UpdatedAt
+	}
+	h.hub.Publish(ctx, stream.Event{Type: stream.EventPresence, Data: presence}, mates...)
+}
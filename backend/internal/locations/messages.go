@@ -0,0 +1,62 @@
+package locations
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+
+	"github.com/marko/backend/internal/countries"
+	"github.com/marko/backend/internal/i18n"
+)
+
+// messageTemplates holds the notification text for each supported language.
+// Each template takes the person's name followed by one or two country labels.
+type messageTemplates struct {
+	arrived     string
+	left        string
+	leftArrived string
+}
+
+// templates has an entry for every language in i18n.Supported
+var templates = map[language.Tag]messageTemplates{
+	language.English: {
+		arrived:     "%s has arrived in %s",
+		left:        "%s has left %s",
+		leftArrived: "%s has left %s and arrived in %s",
+	},
+	language.Spanish: {
+		arrived:     "%s ha llegado a %s",
+		left:        "%s ha salido de %s",
+		leftArrived: "%s ha salido de %s y ha llegado a %s",
+	},
+	language.French: {
+		arrived:     "%s est arrivé(e) : %s",
+		left:        "%s a quitté : %s",
+		leftArrived: "%s a quitté %s et est arrivé(e) : %s",
+	},
+	language.German: {
+		arrived:     "%s ist angekommen: %s",
+		left:        "%s hat verlassen: %s",
+		leftArrived: "%s hat %s verlassen und ist angekommen: %s",
+	},
+	language.Portuguese: {
+		arrived:     "%s chegou a %s",
+		left:        "%s saiu de %s",
+		leftArrived: "%s saiu de %s e chegou a %s",
+	},
+}
+
+// locationMessage renders the notification text for a location event in the
+// recipient's locale, e.g. "Alice has arrived in 🇯🇵 Japan"
+func locationMessage(name, status, countryCode, fromCountryCode, locale string) string {
+	t, locale := i18n.Lookup(templates, locale)
+
+	switch {
+	case status == "arrived" && fromCountryCode != "":
+		return fmt.Sprintf(t.leftArrived, name, countries.Label(fromCountryCode, locale), countries.Label(countryCode, locale))
+	case status == "arrived":
+		return fmt.Sprintf(t.arrived, name, countries.Label(countryCode, locale))
+	default:
+		return fmt.Sprintf(t.left, name, countries.Label(countryCode, locale))
+	}
+}
@@ -0,0 +1,88 @@
+package locations
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/countries"
+	"github.com/marko/backend/internal/db"
+)
+
+// GroupPresenceResponse represents where the members of a group are
+type GroupPresenceResponse struct {
+	Members []*db.Presence `json:"members"`
+}
+
+// GetGroupPresence returns each member's current country and since when
+// they have been there. Members whose latest update is a departure, or who
+// never sent one, have no country.
+func (h *Handler) GetGroupPresence(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return
+	}
+
+	isMember, err := h.db.IsGroupMember(c.Request.Context(), groupID, user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check group membership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get presence"})
+		return
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+		return
+	}
+
+	members, err := h.db.ListGroupPresence(c.Request.Context(), groupID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list group presence")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get presence"})
+		return
+	}
+
+	c.JSON(http.StatusOK, GroupPresenceResponse{Members: members})
+}
+
+// CountryMembersResponse represents the group-mates currently in a country
+type CountryMembersResponse struct {
+	CountryCode string         `json:"country_code"`
+	Members     []*db.Presence `json:"members"`
+}
+
+// ListCountryMembers lists the users who share at least one group with the
+// current user and are in the given country right now
+func (h *Handler) ListCountryMembers(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	countryCode, ok := countries.Normalize(c.Param("code"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown country code"})
+		return
+	}
+
+	members, err := h.db.ListCountryPresence(c.Request.Context(), user.ID, countryCode)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list country presence")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list members"})
+		return
+	}
+
+	c.JSON(http.StatusOK, CountryMembersResponse{CountryCode: countryCode, Members: members})
+}
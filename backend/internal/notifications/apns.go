@@ -0,0 +1,236 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/marko/backend/internal/db"
+)
+
+const (
+	// DefaultAPNsBaseURL is the base URL of Apple's production push service
+	DefaultAPNsBaseURL = "https://api.push.apple.com"
+	// APNsSandboxBaseURL is the base URL of Apple's development push service
+	APNsSandboxBaseURL = "https://api.sandbox.push.apple.com"
+	// apnsTokenLifetime is how long a provider token is reused. Apple rejects
+	// tokens older than an hour and throttles ones renewed too often.
+	apnsTokenLifetime = 50 * time.Minute
+
+	// APNsErrorUnregistered means the token is no longer active for the topic
+	APNsErrorUnregistered = "Unregistered"
+	// APNsErrorBadDeviceToken means the token is invalid, e.g. a sandbox
+	// token sent to production
+	APNsErrorBadDeviceToken = "BadDeviceToken"
+	// APNsErrorDeviceTokenNotForTopic means the token belongs to another app
+	APNsErrorDeviceTokenNotForTopic = "DeviceTokenNotForTopic"
+	// APNsErrorExpiredProviderToken means the provider token must be renewed
+	APNsErrorExpiredProviderToken = "ExpiredProviderToken"
+)
+
+// apnsPayload represents the aps dictionary of a push. Custom data is sent
+// alongside it at the top level.
+type apnsPayload struct {
+	APS apnsAPS `json:"aps"`
+}
+
+// apnsAPS holds the Apple-defined keys of a push
+type apnsAPS struct {
+	Alert *apnsAlert `json:"alert,omitempty"`
+	Badge *int       `json:"badge,omitempty"`
+	Sound string     `json:"sound,omitempty"`
+}
+
+// apnsAlert holds the user-visible part of a push
+type apnsAlert struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+// apnsErrorResponse represents an error returned by APNs
+type apnsErrorResponse struct {
+	Reason string `json:"reason"`
+}
+
+// APNsConfig holds the settings for token-based APNs authentication
+type APNsConfig struct {
+	// BaseURL defaults to DefaultAPNsBaseURL
+	BaseURL string
+	// KeyFile is the path of the .p8 signing key downloaded from Apple
+	KeyFile string
+	KeyID   string
+	TeamID  string
+	// Topic is the app's bundle ID
+	Topic string
+}
+
+// APNsClient sends pushes directly through the Apple Push Notification
+// service, for iOS builds that register native device tokens
+type APNsClient struct {
+	baseURL    string
+	keyID      string
+	teamID     string
+	topic      string
+	signingKey *ecdsa.PrivateKey
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// NewAPNsClient creates a new APNs client
+func NewAPNsClient(cfg APNsConfig) (*APNsClient, error) {
+	if cfg.KeyID == "" || cfg.TeamID == "" || cfg.Topic == "" {
+		return nil, fmt.Errorf("APNs key ID, team ID and topic are required")
+	}
+
+	data, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read APNs key: %w", err)
+	}
+	signingKey, err := jwt.ParseECPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse APNs key: %w", err)
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultAPNsBaseURL
+	}
+	return &APNsClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		keyID:      cfg.KeyID,
+		teamID:     cfg.TeamID,
+		topic:      cfg.Topic,
+		signingKey: signingKey,
+		// APNs requires HTTP/2, which the default transport negotiates over TLS
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// TokenType implements PushProvider
+func (c *APNsClient) TokenType() string {
+	return db.TokenTypeAPNs
+}
+
+// Push implements PushProvider. APNs accepts one message per request, so
+// messages are sent one after another. Accepted messages count as delivered.
+func (c *APNsClient) Push(ctx context.Context, messages []PushMessage) ([]PushResult, error) {
+	results := make([]PushResult, 0, len(messages))
+	for _, message := range messages {
+		result, err := c.send(ctx, message)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// send sends a single message. Rejections of the message itself are
+// reported in the result; failures that may succeed on retry are errors.
+func (c *APNsClient) send(ctx context.Context, message PushMessage) (PushResult, error) {
+	payload := make(map[string]any, len(message.Data)+1)
+	for key, value := range message.Data {
+		payload[key] = value
+	}
+	payload["aps"] = apnsAPS{
+		Alert: &apnsAlert{Title: message.Title, Body: message.Body},
+		Badge: message.Badge,
+		Sound: "default",
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return PushResult{}, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	token, err := c.providerToken()
+	if err != nil {
+		return PushResult{}, err
+	}
+
+	endpoint := c.baseURL + "/3/device/" + url.PathEscape(message.Token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return PushResult{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("apns-topic", c.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return PushResult{}, fmt.Errorf("failed to send apns request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return PushResult{}, nil
+	}
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var apnsErr apnsErrorResponse
+	_ = json.Unmarshal(respBody, &apnsErr)
+	reason := apnsErr.Reason
+	if reason == "" {
+		reason = http.StatusText(resp.StatusCode)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		reason == APNsErrorUnregistered,
+		reason == APNsErrorBadDeviceToken,
+		reason == APNsErrorDeviceTokenNotForTopic:
+		return PushResult{Error: reason, Unregistered: true}, nil
+	case resp.StatusCode == http.StatusBadRequest, resp.StatusCode == http.StatusRequestEntityTooLarge:
+		return PushResult{Error: reason}, nil
+	case reason == APNsErrorExpiredProviderToken:
+		// Sign a new token on the next attempt
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+	}
+	return PushResult{}, fmt.Errorf("apns request failed with status %d: %s", resp.StatusCode, string(respBody))
+}
+
+// providerToken returns the cached provider token, signing a new one when it
+// is due for renewal
+func (c *APNsClient) providerToken() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Since(c.issuedAt) < apnsTokenLifetime {
+		return c.token, nil
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": c.teamID,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = c.keyID
+
+	signed, err := token.SignedString(c.signingKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign apns provider token: %w", err)
+	}
+
+	c.token = signed
+	c.issuedAt = now
+	return c.token, nil
+}
@@ -0,0 +1,289 @@
+package notifications
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// apnsServer is a stand-in for APNs. Pushes are answered according to the
+// device token in the request path.
+type apnsServer struct {
+	*httptest.Server
+	key       *ecdsa.PrivateKey
+	responses map[string]apnsStubResponse
+
+	mu       sync.Mutex
+	tokens   []string
+	payloads []map[string]any
+}
+
+// apnsStubResponse is the canned answer for one device token
+type apnsStubResponse struct {
+	status int
+	reason string
+}
+
+func newAPNsServer(t *testing.T, responses map[string]apnsStubResponse) *apnsServer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &apnsServer{key: key, responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deviceToken, ok := strings.CutPrefix(r.URL.Path, "/3/device/")
+		if !ok || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Every request must carry a valid ES256 provider token
+		auth, _ := strings.CutPrefix(r.Header.Get("Authorization"), "bearer ")
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(auth, claims, func(token *jwt.Token) (any, error) {
+			return &s.key.PublicKey, nil
+		}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithIssuer("TEAM123456"), jwt.WithIssuedAt())
+		if err != nil {
+			t.Errorf("invalid provider token: %v", err)
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"reason":"InvalidProviderToken"}`))
+			return
+		}
+		if token.Header["kid"] != "KEY1234567" {
+			t.Errorf("provider token kid = %v, want KEY1234567", token.Header["kid"])
+		}
+		if r.Header.Get("apns-topic") != "com.marko.app" || r.Header.Get("apns-push-type") != "alert" || r.Header.Get("apns-priority") != "10" {
+			t.Errorf("apns headers = topic %q, push type %q, priority %q",
+				r.Header.Get("apns-topic"), r.Header.Get("apns-push-type"), r.Header.Get("apns-priority"))
+		}
+
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.tokens = append(s.tokens, auth)
+		s.payloads = append(s.payloads, payload)
+		s.mu.Unlock()
+
+		resp, ok := s.responses[deviceToken]
+		if !ok {
+			w.Header().Set("apns-id", "00000000-0000-0000-0000-000000000001")
+			return
+		}
+		w.WriteHeader(resp.status)
+		if resp.reason != "" {
+			_ = json.NewEncoder(w).Encode(apnsErrorResponse{Reason: resp.reason})
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// newTestAPNsClient writes the server's signing key as a .p8 file and creates
+// a client using it
+func newTestAPNsClient(t *testing.T, s *apnsServer) *APNsClient {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "AuthKey_KEY1234567.p8")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewAPNsClient(APNsConfig{
+		BaseURL: s.URL,
+		KeyFile: path,
+		KeyID:   "KEY1234567",
+		TeamID:  "TEAM123456",
+		Topic:   "com.marko.app",
+	})
+	if err != nil {
+		t.Fatalf("NewAPNsClient() error = %v", err)
+	}
+	return client
+}
+
+func TestAPNsPushPayloadAndProviderToken(t *testing.T) {
+	srv := newAPNsServer(t, nil)
+	client := newTestAPNsClient(t, srv)
+
+	badge := 2
+	messages := []PushMessage{
+		{Token: "device-a", Title: "Ana arrived", Body: "Ana arrived in France", Data: map[string]any{"type": "location_update"}, Badge: &badge},
+		{Token: "device-b", Title: "Ana arrived", Body: "Ana arrived in France"},
+	}
+	results, err := client.Push(context.Background(), messages)
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if len(results) != 2 || !results[0].OK() || !results[1].OK() {
+		t.Fatalf("results = %+v, want two delivered", results)
+	}
+
+	// The provider token is signed once and reused
+	if len(srv.tokens) != 2 || srv.tokens[0] != srv.tokens[1] {
+		t.Error("provider token was not reused between pushes")
+	}
+
+	// Custom data sits next to the aps dictionary
+	first := srv.payloads[0]
+	if first["type"] != "location_update" {
+		t.Errorf("payload data = %v", first)
+	}
+	aps, _ := first["aps"].(map[string]any)
+	alert, _ := aps["alert"].(map[string]any)
+	if alert["title"] != "Ana arrived" || alert["body"] != "Ana arrived in France" || aps["badge"] != float64(2) || aps["sound"] != "default" {
+		t.Errorf("aps = %v", aps)
+	}
+	if aps, _ := srv.payloads[1]["aps"].(map[string]any); aps["badge"] != nil {
+		t.Errorf("aps = %v, want no badge", aps)
+	}
+}
+
+func TestAPNsResults(t *testing.T) {
+	tests := []struct {
+		name             string
+		response         apnsStubResponse
+		wantErr          bool
+		wantError        string
+		wantUnregistered bool
+		wantTokenReset   bool
+	}{
+		{
+			name:             "gone",
+			response:         apnsStubResponse{status: http.StatusGone, reason: APNsErrorUnregistered},
+			wantError:        APNsErrorUnregistered,
+			wantUnregistered: true,
+		},
+		{
+			name:             "gone without reason",
+			response:         apnsStubResponse{status: http.StatusGone},
+			wantError:        "Gone",
+			wantUnregistered: true,
+		},
+		{
+			name:             "bad device token",
+			response:         apnsStubResponse{status: http.StatusBadRequest, reason: APNsErrorBadDeviceToken},
+			wantError:        APNsErrorBadDeviceToken,
+			wantUnregistered: true,
+		},
+		{
+			name:             "token for another topic",
+			response:         apnsStubResponse{status: http.StatusBadRequest, reason: APNsErrorDeviceTokenNotForTopic},
+			wantError:        APNsErrorDeviceTokenNotForTopic,
+			wantUnregistered: true,
+		},
+		{
+			name:      "bad request",
+			response:  apnsStubResponse{status: http.StatusBadRequest, reason: "PayloadEmpty"},
+			wantError: "PayloadEmpty",
+		},
+		{
+			name:      "payload too large",
+			response:  apnsStubResponse{status: http.StatusRequestEntityTooLarge, reason: "PayloadTooLarge"},
+			wantError: "PayloadTooLarge",
+		},
+		{
+			name:           "expired provider token",
+			response:       apnsStubResponse{status: http.StatusForbidden, reason: APNsErrorExpiredProviderToken},
+			wantErr:        true,
+			wantTokenReset: true,
+		},
+		{
+			name:     "too many requests",
+			response: apnsStubResponse{status: http.StatusTooManyRequests, reason: "TooManyRequests"},
+			wantErr:  true,
+		},
+		{
+			name:     "server error",
+			response: apnsStubResponse{status: http.StatusInternalServerError, reason: "InternalServerError"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newAPNsServer(t, map[string]apnsStubResponse{"device": tt.response})
+			client := newTestAPNsClient(t, srv)
+
+			results, err := client.Push(context.Background(), []PushMessage{{Token: "device", Title: "Title", Body: "Body"}})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Push() error = nil, want an error so the push is retried")
+				}
+				if len(results) != 0 {
+					t.Errorf("got %d results, want none", len(results))
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Push() error = %v", err)
+				}
+				want := PushResult{Error: tt.wantError, Unregistered: tt.wantUnregistered}
+				if len(results) != 1 || results[0] != want {
+					t.Fatalf("results = %+v, want [%+v]", results, want)
+				}
+			}
+
+			client.mu.Lock()
+			reset := client.token == ""
+			client.mu.Unlock()
+			if reset != tt.wantTokenReset {
+				t.Errorf("provider token reset = %v, want %v", reset, tt.wantTokenReset)
+			}
+		})
+	}
+}
+
+func TestAPNsPushStopsAtFailure(t *testing.T) {
+	srv := newAPNsServer(t, map[string]apnsStubResponse{
+		"gone":   {status: http.StatusGone, reason: APNsErrorUnregistered},
+		"broken": {status: http.StatusServiceUnavailable, reason: "ServiceUnavailable"},
+	})
+	client := newTestAPNsClient(t, srv)
+
+	results, err := client.Push(context.Background(), []PushMessage{
+		{Token: "ok"}, {Token: "gone"}, {Token: "broken"}, {Token: "never-sent"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "status 503") {
+		t.Fatalf("Push() error = %v, want status 503", err)
+	}
+	if len(results) != 2 || !results[0].OK() || !results[1].Unregistered {
+		t.Fatalf("results = %+v, want the two results before the failure", results)
+	}
+	if len(srv.payloads) != 3 {
+		t.Errorf("sent %d pushes, want 3", len(srv.payloads))
+	}
+}
+
+func TestNewAPNsClientValidatesConfig(t *testing.T) {
+	if _, err := NewAPNsClient(APNsConfig{KeyFile: "unused", KeyID: "KEY1234567"}); err == nil {
+		t.Error("NewAPNsClient() accepted a config without team ID and topic")
+	}
+
+	path := filepath.Join(t.TempDir(), "AuthKey.p8")
+	if err := os.WriteFile(path, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAPNsClient(APNsConfig{KeyFile: path, KeyID: "KEY1234567", TeamID: "TEAM123456", Topic: "com.marko.app"}); err == nil {
+		t.Error("NewAPNsClient() accepted an invalid signing key")
+	}
+}
@@ -0,0 +1,134 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/db"
+	"github.com/marko/backend/internal/stream"
+)
+
+const (
+	// digestPreviewLines is the number of messages quoted in a digest push
+	digestPreviewLines = 3
+	// defaultDigestInterval is used when no positive interval is given
+	defaultDigestInterval = 6 * time.Hour
+)
+
+// DigestWorker periodically bundles notifications held back for a digest.
+// It only enqueues the digests; Service.HandleNotificationDigest sends them.
+type DigestWorker struct {
+	db       *db.DB
+	interval time.Duration
+}
+
+// NewDigestWorker creates a new digest worker
+func NewDigestWorker(database *db.DB, interval time.Duration) *DigestWorker {
+	if interval <= 0 {
+		interval = defaultDigestInterval
+	}
+	return &DigestWorker{
+		db:       database,
+		interval: interval,
+	}
+}
+
+// Run schedules digests until the context is cancelled
+func (w *DigestWorker) Run(ctx context.Context) {
+	log.Info().Dur("interval", w.interval).Msg("Starting notification digest worker")
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Notification digest worker stopped")
+			return
+		case <-ticker.C:
+			digests, err := w.db.ScheduleNotificationDigests(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to schedule notification digests")
+				continue
+			}
+			if digests > 0 {
+				log.Debug().Int("digests", digests).Msg("Notification digests scheduled")
+			}
+		}
+	}
+}
+
+// HandleNotificationDigest sends a single push summarizing a user's held
+// back notifications. It is registered as an outbox handler.
+func (s *Service) HandleNotificationDigest(ctx context.Context, event *db.OutboxEvent) error {
+	var payload db.NotificationDigestEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to decode digest event: %w", err)
+	}
+
+	notifications, err := s.db.ListNotificationsByIDs(ctx, payload.NotificationIDs)
+	if err != nil {
+		return err
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	// Digest notifications reach open streams when the digest goes out
+	if event.Attempts == 1 {
+		for _, notification := range notifications {
+			s.hub.Publish(ctx, stream.Event{Type: stream.EventNotification, Data: notification}, payload.UserID)
+		}
+	}
+
+	devices, err := s.db.ListActiveUserDevices(ctx, payload.UserID)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+
+	user, err := s.db.GetUserByID(ctx, payload.UserID)
+	if err != nil {
+		return err
+	}
+	locale := ""
+	if user != nil {
+		locale = user.Locale
+	}
+
+	notificationIDs := make([]uuid.UUID, len(notifications))
+	for i, notification := range notifications {
+		notificationIDs[i] = notification.ID
+	}
+
+	return s.SendPushNotification(ctx, devices, PushNotification{
+		NotificationIDs: notificationIDs,
+		Title:           digestTitle(locale, len(notifications)),
+		Body:            digestBody(locale, notifications),
+		Data: map[string]any{
+			"type":  "digest",
+			"count": len(notifications),
+		},
+	})
+}
+
+// digestBody quotes the most recent messages of a digest. The messages were
+// already rendered in the recipient's locale when they were created.
+func digestBody(locale string, notifications []*db.Notification) string {
+	var lines []string
+	for i := len(notifications) - 1; i >= 0 && len(lines) < digestPreviewLines; i-- {
+		lines = append(lines, notifications[i].Message)
+	}
+	if more := len(notifications) - len(lines); more > 0 {
+		lines = append(lines, digestMore(locale, more))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,75 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marko/backend/internal/db"
+	"github.com/marko/backend/internal/i18n"
+)
+
+func TestNewDigestWorkerDefaults(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		want     time.Duration
+	}{
+		{interval: time.Hour, want: time.Hour},
+		{interval: 0, want: defaultDigestInterval},
+		{interval: -time.Minute, want: defaultDigestInterval},
+	}
+	for _, tt := range tests {
+		if got := NewDigestWorker(nil, tt.interval).interval; got != tt.want {
+			t.Errorf("NewDigestWorker(%v) interval = %v, want %v", tt.interval, got, tt.want)
+		}
+	}
+}
+
+func TestDigestText(t *testing.T) {
+	notifications := make([]*db.Notification, 5)
+	for i := range notifications {
+		notifications[i] = &db.Notification{Message: fmt.Sprintf("message %d", i)}
+	}
+
+	tests := []struct {
+		locale    string
+		count     int
+		wantTitle string
+		wantMore  string
+	}{
+		{locale: "en", count: 1, wantTitle: "1 update from your groups"},
+		{locale: "en", count: 5, wantTitle: "5 updates from your groups", wantMore: "and 2 more"},
+		{locale: "es-MX", count: 5, wantTitle: "5 novedades de tus grupos", wantMore: "y 2 más"},
+		{locale: "fr", count: 4, wantTitle: "4 nouveautés de vos groupes", wantMore: "et 1 de plus"},
+		{locale: "de", count: 1, wantTitle: "1 Neuigkeit aus deinen Gruppen"},
+		{locale: "pt-BR", count: 5, wantTitle: "5 novidades dos seus grupos", wantMore: "e mais 2"},
+		{locale: "ja", count: 2, wantTitle: "2 updates from your groups"},
+	}
+	for _, tt := range tests {
+		if got := digestTitle(tt.locale, tt.count); got != tt.wantTitle {
+			t.Errorf("digestTitle(%q, %d) = %q, want %q", tt.locale, tt.count, got, tt.wantTitle)
+		}
+
+		// The newest messages come first, followed by the count of the rest
+		lines := strings.Split(digestBody(tt.locale, notifications[:tt.count]), "\n")
+		if lines[0] != fmt.Sprintf("message %d", tt.count-1) {
+			t.Errorf("digest body starts with %q, want the newest message", lines[0])
+		}
+		more := ""
+		if len(lines) > digestPreviewLines {
+			more = lines[digestPreviewLines]
+		}
+		if more != tt.wantMore {
+			t.Errorf("digestBody(%q) more line = %q, want %q", tt.locale, more, tt.wantMore)
+		}
+	}
+}
+
+func TestDigestTemplatesCoverSupportedLanguages(t *testing.T) {
+	for _, tag := range i18n.Supported {
+		if _, ok := templates[tag]; !ok {
+			t.Errorf("no digest text for %s", tag)
+		}
+	}
+}
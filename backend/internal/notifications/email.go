@@ -0,0 +1,201 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/db"
+)
+
+const (
+	// smtpImplicitTLSPort is the submission port that expects TLS right away
+	// rather than upgrading with STARTTLS
+	smtpImplicitTLSPort = 465
+	// smtpTimeout bounds a whole SMTP conversation
+	smtpTimeout = 30 * time.Second
+
+	// emailFooter explains why a notification email was sent
+	emailFooter = "You are receiving this email because email notifications are turned on for this group in Marko."
+)
+
+// SMTPConfig holds the settings for sending email
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From is the sender, e.g. "Marko <no-reply@example.com>"
+	From string
+}
+
+// SMTPClient sends plain text email through an SMTP server. Connections on
+// port 465 use TLS from the start; others are upgraded with STARTTLS when
+// the server offers it.
+type SMTPClient struct {
+	cfg  SMTPConfig
+	from *mail.Address
+}
+
+// NewSMTPClient creates a new SMTP client
+func NewSMTPClient(cfg SMTPConfig) (*SMTPClient, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("SMTP host is required")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP sender address: %w", err)
+	}
+	return &SMTPClient{cfg: cfg, from: from}, nil
+}
+
+// Send sends a plain text email to a single recipient
+func (c *SMTPClient) Send(ctx context.Context, to, subject, body string) error {
+	recipient, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+
+	msg, err := c.message(recipient, subject, body)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(c.cfg.Host, strconv.Itoa(c.cfg.Port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	tlsConfig := &tls.Config{ServerName: c.cfg.Host}
+
+	var conn net.Conn
+	if c.cfg.Port == smtpImplicitTLSPort {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	deadline := time.Now().Add(smtpTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to set SMTP deadline: %w", err)
+	}
+
+	client, err := smtp.NewClient(conn, c.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if c.cfg.Port != smtpImplicitTLSPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("failed to start TLS: %w", err)
+			}
+		}
+	}
+	if c.cfg.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection
+		if err := client.Auth(smtp.PlainAuth("", c.cfg.Username, c.cfg.Password, c.cfg.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate with SMTP server: %w", err)
+		}
+	}
+
+	if err := client.Mail(c.from.Address); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	if err := client.Rcpt(recipient.Address); err != nil {
+		return fmt.Errorf("failed to set recipient: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return client.Quit()
+}
+
+// message renders the headers and quoted-printable body of an email
+func (c *SMTPClient) message(to *mail.Address, subject, body string) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", c.from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// HandleNotificationEmail emails a stored notification to its recipient. It
+// is registered as an outbox handler, so a returned error causes the email
+// to be retried. Emails are dropped when no SMTP server is configured.
+func (s *Service) HandleNotificationEmail(ctx context.Context, event *db.OutboxEvent) error {
+	var payload db.NotificationEmailEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to decode notification email event: %w", err)
+	}
+
+	if s.mailer == nil {
+		log.Debug().Str("notification_id", payload.NotificationID.String()).Msg("Email is not configured, dropping notification email")
+		return nil
+	}
+
+	notification, err := s.db.GetNotificationByID(ctx, payload.NotificationID)
+	if err != nil {
+		return err
+	}
+	if notification == nil {
+		// Deleted before we got to it
+		return nil
+	}
+
+	user, err := s.db.GetUserByID(ctx, notification.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+	if _, err := mail.ParseAddress(user.Email); err != nil {
+		// Retrying will not fix the address
+		log.Warn().Str("user_id", user.ID.String()).Msg("Skipping notification email to invalid address")
+		return nil
+	}
+
+	body := notification.Message + "\r\n\r\n-- \r\n" + emailFooter + "\r\n"
+	if err := s.mailer.Send(ctx, user.Email, notification.Title, body); err != nil {
+		return fmt.Errorf("failed to send notification email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package notifications
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts one SMTP session and records what the client sent
+type fakeSMTPServer struct {
+	listener net.Listener
+	// rejectRcpt makes the server refuse every recipient
+	rejectRcpt bool
+
+	done     chan struct{}
+	commands []string
+	auth     string
+	data     string
+}
+
+func newFakeSMTPServer(t *testing.T, rejectRcpt bool) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &fakeSMTPServer{listener: listener, rejectRcpt: rejectRcpt, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+// config returns an SMTP config pointing at the server
+func (s *fakeSMTPServer) config() SMTPConfig {
+	return SMTPConfig{
+		Host: "127.0.0.1",
+		Port: s.listener.Addr().(*net.TCPAddr).Port,
+		From: "Marko <no-reply@example.com>",
+	}
+}
+
+// wait waits for the session to end
+func (s *fakeSMTPServer) wait(t *testing.T) {
+	t.Helper()
+	<-s.done
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.commands = append(s.commands, line)
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch verb {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250-AUTH PLAIN")
+			reply("250 8BITMIME")
+		case "AUTH":
+			s.auth = line
+			reply("235 Authenticated")
+		case "MAIL":
+			reply("250 OK")
+		case "RCPT":
+			if s.rejectRcpt {
+				reply("550 No such user")
+			} else {
+				reply("250 OK")
+			}
+		case "DATA":
+			reply("354 Go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			s.data = data.String()
+			reply("250 Queued")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+// readMessage parses a sent message, decoding its subject and body
+func readMessage(t *testing.T, raw string) (*mail.Message, string, string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage() error = %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("failed to decode subject: %v", err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	return msg, subject, string(body)
+}
+
+func TestSMTPClientSend(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	cfg := server.config()
+	cfg.Username, cfg.Password = "marko", "hunter2"
+	client, err := NewSMTPClient(cfg)
+	if err != nil {
+		t.Fatalf("NewSMTPClient() error = %v", err)
+	}
+
+	body := "Ana está en España.\r\n\r\n-- \r\n" + emailFooter + "\r\n"
+	if err := client.Send(context.Background(), "Ana <ana@example.com>", "Ana llegó a España", body); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	server.wait(t)
+
+	for _, want := range []string{"MAIL FROM:<no-reply@example.com>", "RCPT TO:<ana@example.com>", "QUIT"} {
+		found := false
+		for _, cmd := range server.commands {
+			found = found || strings.HasPrefix(cmd, want)
+		}
+		if !found {
+			t.Errorf("commands %q lack %q", server.commands, want)
+		}
+	}
+	wantAuth := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00marko\x00hunter2"))
+	if server.auth != wantAuth {
+		t.Errorf("auth = %q, want %q", server.auth, wantAuth)
+	}
+
+	msg, subject, gotBody := readMessage(t, server.data)
+	if subject != "Ana llegó a España" {
+		t.Errorf("subject = %q, want %q", subject, "Ana llegó a España")
+	}
+	if gotBody != body {
+		t.Errorf("body = %q, want %q", gotBody, body)
+	}
+	if got := msg.Header.Get("To"); got != `"Ana" <ana@example.com>` {
+		t.Errorf("To = %q", got)
+	}
+}
+
+func TestSMTPClientSendErrors(t *testing.T) {
+	server := newFakeSMTPServer(t, true)
+	client, err := NewSMTPClient(server.config())
+	if err != nil {
+		t.Fatalf("NewSMTPClient() error = %v", err)
+	}
+
+	err = client.Send(context.Background(), "ana@example.com", "Hi", "Hello")
+	if err == nil || !strings.Contains(err.Error(), "failed to set recipient") {
+		t.Errorf("Send() to a rejected recipient error = %v, want failed to set recipient", err)
+	}
+	server.wait(t)
+
+	if err := client.Send(context.Background(), "not an address", "Hi", "Hello"); err == nil {
+		t.Error("Send() to an invalid address error = nil")
+	}
+}
+
+func TestNewSMTPClientValidation(t *testing.T) {
+	if _, err := NewSMTPClient(SMTPConfig{From: "no-reply@example.com"}); err == nil {
+		t.Error("NewSMTPClient() without host error = nil")
+	}
+	if _, err := NewSMTPClient(SMTPConfig{Host: "smtp.example.com", From: "not an address"}); err == nil {
+		t.Error("NewSMTPClient() with invalid sender error = nil")
+	}
+}
+
+func TestSMTPClientMessage(t *testing.T) {
+	client, err := NewSMTPClient(SMTPConfig{Host: "smtp.example.com", From: "Marko <no-reply@example.com>"})
+	if err != nil {
+		t.Fatalf("NewSMTPClient() error = %v", err)
+	}
+	to := &mail.Address{Name: "Ana", Address: "ana@example.com"}
+
+	tests := []struct {
+		name        string
+		subject     string
+		wantEncoded bool
+	}{
+		{name: "ASCII subject stays readable", subject: "Ana arrived in France"},
+		{name: "non-ASCII subject is Q-encoded", subject: "Ana est arrivée en France 🇫🇷", wantEncoded: true},
+		{name: "line breaks cannot inject headers", subject: "Hi\r\nBcc: eve@example.com", wantEncoded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := client.message(to, tt.subject, strings.Repeat("très long ", 20))
+			if err != nil {
+				t.Fatalf("message() error = %v", err)
+			}
+			msg, subject, body := readMessage(t, string(raw))
+
+			if subject != tt.subject {
+				t.Errorf("subject = %q, want %q", subject, tt.subject)
+			}
+			encoded := strings.HasPrefix(msg.Header.Get("Subject"), "=?utf-8?q?")
+			if encoded != tt.wantEncoded {
+				t.Errorf("Subject header = %q, want encoded %v", msg.Header.Get("Subject"), tt.wantEncoded)
+			}
+			if len(msg.Header["Bcc"]) != 0 {
+				t.Errorf("message has a Bcc header %q", msg.Header["Bcc"])
+			}
+			if body != strings.Repeat("très long ", 20) {
+				t.Errorf("body = %q", body)
+			}
+
+			// Quoted-printable keeps lines within the 76 character limit
+			for _, line := range strings.Split(string(raw), "\r\n") {
+				if len(line) > 998 || (!strings.Contains(line, ":") && len(line) > 76) {
+					t.Errorf("line too long: %q", line)
+				}
+			}
+			for _, header := range []string{"From", "To", "Date", "MIME-Version", "Content-Type", "Content-Transfer-Encoding"} {
+				if msg.Header.Get(header) == "" {
+					t.Errorf("message lacks a %s header", header)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/marko/backend/internal/db"
+)
+
+const (
+	// DefaultExpoBaseURL is the base URL of Expo's push API
+	DefaultExpoBaseURL = "https://exp.host/--/api/v2"
+	// expoMaxBatchSize is the maximum number of messages Expo accepts per request
+	expoMaxBatchSize = 100
+	// expoMaxReceiptBatchSize is the maximum number of receipt IDs per request
+	expoMaxReceiptBatchSize = 1000
+
+	// ExpoErrorDeviceNotRegistered means the token is no longer valid
+	ExpoErrorDeviceNotRegistered = "DeviceNotRegistered"
+)
+
+// ExpoMessage represents a single message for Expo's push API
+type ExpoMessage struct {
+	To        string         `json:"to"`
+	Title     string         `json:"title,omitempty"`
+	Body      string         `json:"body,omitempty"`
+	Data      map[string]any `json:"data,omitempty"`
+	Sound     string         `json:"sound,omitempty"`
+	ChannelID string         `json:"channelId,omitempty"`
+	Badge     *int           `json:"badge,omitempty"`
+}
+
+// ExpoTicket represents Expo's result for a single message. A ticket with
+// status "ok" carries an ID that can later be exchanged for a receipt.
+type ExpoTicket struct {
+	Status  string            `json:"status"`
+	ID      string            `json:"id,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Details *ExpoErrorDetails `json:"details,omitempty"`
+}
+
+// ExpoErrorDetails holds the machine-readable part of an Expo error
+type ExpoErrorDetails struct {
+	Error string `json:"error,omitempty"`
+}
+
+// ErrorCode returns the Expo error code, e.g. "DeviceNotRegistered"
+func (t ExpoTicket) ErrorCode() string {
+	if t.Details == nil {
+		return ""
+	}
+	return t.Details.Error
+}
+
+// ExpoReceipt represents the delivery result for a previously issued ticket
+type ExpoReceipt struct {
+	Status  string            `json:"status"`
+	Message string            `json:"message,omitempty"`
+	Details *ExpoErrorDetails `json:"details,omitempty"`
+}
+
+// ErrorCode returns the Expo error code, e.g. "DeviceNotRegistered"
+func (r ExpoReceipt) ErrorCode() string {
+	if r.Details == nil {
+		return ""
+	}
+	return r.Details.Error
+}
+
+// expoSendResponse represents the response body of /push/send
+type expoSendResponse struct {
+	Data   []ExpoTicket `json:"data"`
+	Errors []expoError  `json:"errors"`
+}
+
+// expoReceiptsResponse represents the response body of /push/getReceipts
+type expoReceiptsResponse struct {
+	Data   map[string]ExpoReceipt `json:"data"`
+	Errors []expoError            `json:"errors"`
+}
+
+// expoError represents a request-level error returned by Expo
+type expoError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ExpoClient talks to Expo's push API
+type ExpoClient struct {
+	baseURL     string
+	accessToken string
+	httpClient  *http.Client
+}
+
+// NewExpoClient creates a new Expo push API client. The base URL can be
+// overridden to point at a stand-in server.
+func NewExpoClient(baseURL, accessToken string) *ExpoClient {
+	if baseURL == "" {
+		baseURL = DefaultExpoBaseURL
+	}
+	return &ExpoClient{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		accessToken: accessToken,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send sends messages in batches of up to 100 and returns one ticket per
+// message, in the same order as the input
+func (c *ExpoClient) Send(ctx context.Context, messages []ExpoMessage) ([]ExpoTicket, error) {
+	tickets := make([]ExpoTicket, 0, len(messages))
+	for start := 0; start < len(messages); start += expoMaxBatchSize {
+		end := min(start+expoMaxBatchSize, len(messages))
+		batch := messages[start:end]
+
+		var resp expoSendResponse
+		if err := c.post(ctx, "/push/send", batch, &resp); err != nil {
+			return tickets, err
+		}
+		if len(resp.Errors) > 0 {
+			return tickets, fmt.Errorf("expo push request failed: %s: %s", resp.Errors[0].Code, resp.Errors[0].Message)
+		}
+		if len(resp.Data) != len(batch) {
+			return tickets, fmt.Errorf("expo returned %d tickets for %d messages", len(resp.Data), len(batch))
+		}
+		tickets = append(tickets, resp.Data...)
+	}
+	return tickets, nil
+}
+
+// GetReceipts fetches receipts for the given ticket IDs in batches of up to
+// 1000. IDs whose receipt is not available yet are absent from the result.
+func (c *ExpoClient) GetReceipts(ctx context.Context, ticketIDs []string) (map[string]ExpoReceipt, error) {
+	receipts := make(map[string]ExpoReceipt, len(ticketIDs))
+	for start := 0; start < len(ticketIDs); start += expoMaxReceiptBatchSize {
+		end := min(start+expoMaxReceiptBatchSize, len(ticketIDs))
+
+		var resp expoReceiptsResponse
+		payload := map[string][]string{"ids": ticketIDs[start:end]}
+		if err := c.post(ctx, "/push/getReceipts", payload, &resp); err != nil {
+			return receipts, err
+		}
+		if len(resp.Errors) > 0 {
+			return receipts, fmt.Errorf("expo receipts request failed: %s: %s", resp.Errors[0].Code, resp.Errors[0].Message)
+		}
+		for id, receipt := range resp.Data {
+			receipts[id] = receipt
+		}
+	}
+	return receipts, nil
+}
+
+// post sends a JSON request to the Expo API and decodes the response
+func (c *ExpoClient) post(ctx context.Context, path string, payload, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send expo request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("expo request failed with status %d: %s", resp.StatusCode, string(data))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode expo response: %w", err)
+	}
+	return nil
+}
+
+// TokenType implements PushProvider
+func (c *ExpoClient) TokenType() string {
+	return db.TokenTypeExpo
+}
+
+// Push implements PushProvider. Accepted messages carry a ticket ID whose
+// receipt is fetched later by the ReceiptWorker.
+func (c *ExpoClient) Push(ctx context.Context, messages []PushMessage) ([]PushResult, error) {
+	expoMessages := make([]ExpoMessage, len(messages))
+	for i, message := range messages {
+		expoMessages[i] = ExpoMessage{
+			To:        message.Token,
+			Title:     message.Title,
+			Body:      message.Body,
+			Data:      message.Data,
+			Sound:     "default",
+			ChannelID: "default",
+			Badge:     message.Badge,
+		}
+	}
+
+	tickets, err := c.Send(ctx, expoMessages)
+
+	results := make([]PushResult, len(tickets))
+	for i, ticket := range tickets {
+		if ticket.Status == "ok" {
+			results[i] = PushResult{TicketID: ticket.ID}
+			continue
+		}
+		msg := ticket.Message
+		if code := ticket.ErrorCode(); code != "" {
+			msg = code + ": " + msg
+		}
+		results[i] = PushResult{
+			Error:        msg,
+			Unregistered: ticket.ErrorCode() == ExpoErrorDeviceNotRegistered,
+		}
+	}
+	return results, err
+}
@@ -0,0 +1,349 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// expoServer is a stand-in for Expo's push API. Each /push/send batch is
+// answered by the send func.
+type expoServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	batches [][]ExpoMessage
+	auth    []string
+}
+
+func newExpoServer(t *testing.T, send func(batch int, messages []ExpoMessage) (int, any)) *expoServer {
+	t.Helper()
+	s := &expoServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/push/send":
+			var messages []ExpoMessage
+			if err := json.NewDecoder(r.Body).Decode(&messages); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.mu.Lock()
+			batch := len(s.batches)
+			s.batches = append(s.batches, messages)
+			s.auth = append(s.auth, r.Header.Get("Authorization"))
+			s.mu.Unlock()
+
+			status, body := send(batch, messages)
+			w.WriteHeader(status)
+			if str, ok := body.(string); ok {
+				_, _ = w.Write([]byte(str))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// okTickets answers every message with an ok ticket whose ID is the token
+func okTickets(batch int, messages []ExpoMessage) (int, any) {
+	tickets := make([]ExpoTicket, len(messages))
+	for i, m := range messages {
+		tickets[i] = ExpoTicket{Status: "ok", ID: "ticket-" + m.To}
+	}
+	return http.StatusOK, expoSendResponse{Data: tickets}
+}
+
+func expoMessages(n int) []ExpoMessage {
+	messages := make([]ExpoMessage, n)
+	for i := range messages {
+		messages[i] = ExpoMessage{To: fmt.Sprintf("ExponentPushToken[%d]", i), Title: "Title", Body: "Body"}
+	}
+	return messages
+}
+
+func TestExpoSendChunking(t *testing.T) {
+	tests := []struct {
+		name        string
+		messages    int
+		wantBatches []int
+	}{
+		{name: "single message", messages: 1, wantBatches: []int{1}},
+		{name: "exactly one batch", messages: 100, wantBatches: []int{100}},
+		{name: "one over", messages: 101, wantBatches: []int{100, 1}},
+		{name: "several batches", messages: 250, wantBatches: []int{100, 100, 50}},
+		{name: "no messages", messages: 0, wantBatches: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newExpoServer(t, okTickets)
+			client := NewExpoClient(srv.URL, "expo-access-token")
+
+			messages := expoMessages(tt.messages)
+			tickets, err := client.Send(context.Background(), messages)
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			if len(srv.batches) != len(tt.wantBatches) {
+				t.Fatalf("got %d batches, want %d", len(srv.batches), len(tt.wantBatches))
+			}
+			for i, want := range tt.wantBatches {
+				if len(srv.batches[i]) != want {
+					t.Errorf("batch %d has %d messages, want %d", i, len(srv.batches[i]), want)
+				}
+				if srv.auth[i] != "Bearer expo-access-token" {
+					t.Errorf("batch %d Authorization = %q", i, srv.auth[i])
+				}
+			}
+
+			// Tickets come back in input order across batches
+			if len(tickets) != len(messages) {
+				t.Fatalf("got %d tickets, want %d", len(tickets), len(messages))
+			}
+			for i, ticket := range tickets {
+				if ticket.ID != "ticket-"+messages[i].To {
+					t.Fatalf("ticket %d ID = %q, want ticket for %q", i, ticket.ID, messages[i].To)
+				}
+			}
+		})
+	}
+}
+
+func TestExpoSendTicketErrors(t *testing.T) {
+	srv := newExpoServer(t, func(batch int, messages []ExpoMessage) (int, any) {
+		return http.StatusOK, `{"data":[
+			{"status":"ok","id":"abc"},
+			{"status":"error","message":"\"ExponentPushToken[1]\" is not a registered push notification recipient","details":{"error":"DeviceNotRegistered"}},
+			{"status":"error","message":"Message too big"}
+		]}`
+	})
+	client := NewExpoClient(srv.URL, "")
+
+	tickets, err := client.Send(context.Background(), expoMessages(3))
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	tests := []struct {
+		status string
+		id     string
+		code   string
+	}{
+		{status: "ok", id: "abc"},
+		{status: "error", code: ExpoErrorDeviceNotRegistered},
+		{status: "error", code: ""},
+	}
+	for i, want := range tests {
+		got := tickets[i]
+		if got.Status != want.status || got.ID != want.id || got.ErrorCode() != want.code {
+			t.Errorf("ticket %d = {status %q, id %q, code %q}, want {%q, %q, %q}",
+				i, got.Status, got.ID, got.ErrorCode(), want.status, want.id, want.code)
+		}
+	}
+	if srv.auth[0] != "" {
+		t.Errorf("Authorization = %q, want none without an access token", srv.auth[0])
+	}
+}
+
+func TestExpoSendFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    any
+		wantErr string
+	}{
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			body:    "upstream unavailable",
+			wantErr: "status 500: upstream unavailable",
+		},
+		{
+			name:    "rate limited",
+			status:  http.StatusTooManyRequests,
+			body:    `{"errors":[{"code":"RATE_LIMIT_ERROR","message":"slow down"}]}`,
+			wantErr: "status 429",
+		},
+		{
+			name:    "request level error",
+			status:  http.StatusOK,
+			body:    expoSendResponse{Errors: []expoError{{Code: "PUSH_TOO_MANY_EXPERIENCE_IDS", Message: "mixed projects"}}},
+			wantErr: "PUSH_TOO_MANY_EXPERIENCE_IDS: mixed projects",
+		},
+		{
+			name:    "ticket count mismatch",
+			status:  http.StatusOK,
+			body:    expoSendResponse{Data: []ExpoTicket{{Status: "ok", ID: "only-one"}}},
+			wantErr: "1 tickets for 2 messages",
+		},
+		{
+			name:    "malformed body",
+			status:  http.StatusOK,
+			body:    "not json",
+			wantErr: "failed to decode expo response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newExpoServer(t, func(int, []ExpoMessage) (int, any) {
+				return tt.status, tt.body
+			})
+			client := NewExpoClient(srv.URL, "")
+
+			tickets, err := client.Send(context.Background(), expoMessages(2))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Send() error = %v, want error containing %q", err, tt.wantErr)
+			}
+			if len(tickets) != 0 {
+				t.Errorf("got %d tickets, want none", len(tickets))
+			}
+		})
+	}
+}
+
+func TestExpoGetReceipts(t *testing.T) {
+	var mu sync.Mutex
+	var requests [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/push/getReceipts" {
+			http.NotFound(w, r)
+			return
+		}
+		var payload struct {
+			IDs []string `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, payload.IDs)
+		mu.Unlock()
+
+		// Receipts for odd IDs are not ready yet
+		data := make(map[string]ExpoReceipt)
+		for i, id := range payload.IDs {
+			if i%2 == 1 {
+				continue
+			}
+			if id == "id-0" {
+				data[id] = ExpoReceipt{Status: "error", Message: "gone", Details: &ExpoErrorDetails{Error: ExpoErrorDeviceNotRegistered}}
+				continue
+			}
+			data[id] = ExpoReceipt{Status: "ok"}
+		}
+		_ = json.NewEncoder(w).Encode(expoReceiptsResponse{Data: data})
+	}))
+	defer srv.Close()
+
+	ids := make([]string, 1500)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("id-%d", i)
+	}
+
+	receipts, err := NewExpoClient(srv.URL, "").GetReceipts(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("GetReceipts() error = %v", err)
+	}
+	if len(requests) != 2 || len(requests[0]) != 1000 || len(requests[1]) != 500 {
+		t.Fatalf("receipt batches = %d, want 1000 and 500 IDs", len(requests))
+	}
+	if len(receipts) != 750 {
+		t.Errorf("got %d receipts, want 750", len(receipts))
+	}
+	if _, ok := receipts["id-1"]; ok {
+		t.Error("receipt for pending ticket id-1 should be absent")
+	}
+	if got := receipts["id-0"].ErrorCode(); got != ExpoErrorDeviceNotRegistered {
+		t.Errorf("id-0 error code = %q, want %q", got, ExpoErrorDeviceNotRegistered)
+	}
+}
+
+func pushMessages(n int) []PushMessage {
+	messages := make([]PushMessage, n)
+	for i := range messages {
+		messages[i] = PushMessage{Token: fmt.Sprintf("ExponentPushToken[%d]", i), Title: "Title", Body: "Body"}
+	}
+	return messages
+}
+
+func TestExpoPush(t *testing.T) {
+	srv := newExpoServer(t, func(batch int, messages []ExpoMessage) (int, any) {
+		tickets := make([]ExpoTicket, len(messages))
+		for i, m := range messages {
+			switch m.To {
+			case "ExponentPushToken[1]":
+				tickets[i] = ExpoTicket{Status: "error", Message: "not registered", Details: &ExpoErrorDetails{Error: ExpoErrorDeviceNotRegistered}}
+			case "ExponentPushToken[2]":
+				tickets[i] = ExpoTicket{Status: "error", Message: "Message too big", Details: &ExpoErrorDetails{Error: "MessageTooBig"}}
+			default:
+				tickets[i] = ExpoTicket{Status: "ok", ID: "ticket-" + m.To}
+			}
+		}
+		return http.StatusOK, expoSendResponse{Data: tickets}
+	})
+
+	results, err := NewExpoClient(srv.URL, "").Push(context.Background(), pushMessages(3))
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	want := []PushResult{
+		{TicketID: "ticket-ExponentPushToken[0]"},
+		{Error: "DeviceNotRegistered: not registered", Unregistered: true},
+		{Error: "MessageTooBig: Message too big"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, results[i], want[i])
+		}
+	}
+	if !results[0].OK() || results[1].OK() {
+		t.Error("OK() does not match the ticket status")
+	}
+
+	// Push fills in the Expo specific message options
+	sent := srv.batches[0][0]
+	if sent.Sound != "default" || sent.ChannelID != "default" || sent.Title != "Title" {
+		t.Errorf("sent message = %+v", sent)
+	}
+}
+
+func TestExpoPushPartialChunkFailure(t *testing.T) {
+	srv := newExpoServer(t, func(batch int, messages []ExpoMessage) (int, any) {
+		if batch == 1 {
+			return http.StatusBadGateway, "bad gateway"
+		}
+		return okTickets(batch, messages)
+	})
+
+	results, err := NewExpoClient(srv.URL, "").Push(context.Background(), pushMessages(150))
+	if err == nil {
+		t.Fatal("Push() error = nil, want the failure of the second chunk")
+	}
+
+	// Results of the chunk sent before the failure are kept, so their
+	// tickets can still be stored
+	if len(results) != expoMaxBatchSize {
+		t.Fatalf("got %d results, want %d", len(results), expoMaxBatchSize)
+	}
+	for i, result := range results {
+		if result.TicketID != fmt.Sprintf("ticket-ExponentPushToken[%d]", i) {
+			t.Fatalf("result %d = %+v", i, result)
+		}
+	}
+}
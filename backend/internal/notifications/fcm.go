@@ -0,0 +1,331 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/marko/backend/internal/db"
+)
+
+const (
+	// DefaultFCMBaseURL is the base URL of the FCM HTTP v1 API
+	DefaultFCMBaseURL = "https://fcm.googleapis.com/v1"
+	// fcmScope is the OAuth scope needed to send messages
+	fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+	// fcmTokenLifetime is how long requested access tokens are valid
+	fcmTokenLifetime = time.Hour
+	// fcmTokenRefreshMargin renews access tokens shortly before they expire
+	fcmTokenRefreshMargin = time.Minute
+
+	// FCMErrorUnregistered means the token is no longer valid
+	FCMErrorUnregistered = "UNREGISTERED"
+	// FCMErrorSenderIDMismatch means the token belongs to another project
+	FCMErrorSenderIDMismatch = "SENDER_ID_MISMATCH"
+)
+
+// fcmCredentials is the part of a Google service account key file needed to
+// obtain access tokens
+type fcmCredentials struct {
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// fcmRequest represents the request body of messages:send
+type fcmRequest struct {
+	Message fcmMessage `json:"message"`
+}
+
+// fcmMessage represents a single FCM message
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      fcmAndroidConfig  `json:"android"`
+	APNs         *fcmAPNsConfig    `json:"apns,omitempty"`
+}
+
+// fcmNotification holds the user-visible part of a message
+type fcmNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+// fcmAndroidConfig holds Android specific options
+type fcmAndroidConfig struct {
+	Notification fcmAndroidNotification `json:"notification"`
+}
+
+// fcmAndroidNotification holds Android specific notification options
+type fcmAndroidNotification struct {
+	Sound     string `json:"sound,omitempty"`
+	ChannelID string `json:"channel_id,omitempty"`
+}
+
+// fcmAPNsConfig holds the APNs payload for iOS devices registered with FCM
+type fcmAPNsConfig struct {
+	Payload apnsPayload `json:"payload"`
+}
+
+// fcmErrorResponse represents an error returned by the FCM API
+type fcmErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// errorCode returns the FCM error code, e.g. "UNREGISTERED", falling back to
+// the generic status
+func (r fcmErrorResponse) errorCode() string {
+	for _, detail := range r.Error.Details {
+		if detail.ErrorCode != "" {
+			return detail.ErrorCode
+		}
+	}
+	return r.Error.Status
+}
+
+// fcmTokenResponse represents the response of the OAuth token endpoint
+type fcmTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// FCMClient sends pushes directly through Firebase Cloud Messaging, for
+// builds that register native FCM tokens rather than Expo tokens
+type FCMClient struct {
+	baseURL     string
+	credentials fcmCredentials
+	privateKey  *rsa.PrivateKey
+	httpClient  *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewFCMClient creates a new FCM client authenticating with the service
+// account key in credentialsFile. The base URL can be overridden to point at
+// a stand-in server.
+func NewFCMClient(baseURL, credentialsFile string) (*FCMClient, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FCM credentials: %w", err)
+	}
+
+	var credentials fcmCredentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, fmt.Errorf("failed to parse FCM credentials: %w", err)
+	}
+	if credentials.ProjectID == "" || credentials.ClientEmail == "" || credentials.TokenURI == "" {
+		return nil, fmt.Errorf("FCM credentials must contain project_id, client_email and token_uri")
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(credentials.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FCM private key: %w", err)
+	}
+
+	if baseURL == "" {
+		baseURL = DefaultFCMBaseURL
+	}
+	return &FCMClient{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		credentials: credentials,
+		privateKey:  privateKey,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// TokenType implements PushProvider
+func (c *FCMClient) TokenType() string {
+	return db.TokenTypeFCM
+}
+
+// Push implements PushProvider. FCM accepts one message per request, so
+// messages are sent one after another. Accepted messages count as delivered.
+func (c *FCMClient) Push(ctx context.Context, messages []PushMessage) ([]PushResult, error) {
+	results := make([]PushResult, 0, len(messages))
+	for _, message := range messages {
+		result, err := c.send(ctx, message)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// send sends a single message. Rejections of the message itself are
+// reported in the result; failures that may succeed on retry are errors.
+func (c *FCMClient) send(ctx context.Context, message PushMessage) (PushResult, error) {
+	data, err := stringData(message.Data)
+	if err != nil {
+		return PushResult{}, err
+	}
+
+	payload := fcmRequest{Message: fcmMessage{
+		Token:        message.Token,
+		Notification: fcmNotification{Title: message.Title, Body: message.Body},
+		Data:         data,
+		Android:      fcmAndroidConfig{Notification: fcmAndroidNotification{Sound: "default", ChannelID: "default"}},
+	}}
+	if message.Badge != nil {
+		payload.Message.APNs = &fcmAPNsConfig{Payload: apnsPayload{APS: apnsAPS{Badge: message.Badge}}}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return PushResult{}, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	accessToken, err := c.token(ctx)
+	if err != nil {
+		return PushResult{}, err
+	}
+
+	endpoint := c.baseURL + "/projects/" + url.PathEscape(c.credentials.ProjectID) + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return PushResult{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return PushResult{}, fmt.Errorf("failed to send fcm request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return PushResult{}, nil
+	}
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var fcmErr fcmErrorResponse
+	_ = json.Unmarshal(respBody, &fcmErr)
+	code := fcmErr.errorCode()
+	msg := fcmErr.Error.Message
+	if code != "" {
+		msg = code + ": " + msg
+	}
+	if msg == "" {
+		msg = http.StatusText(resp.StatusCode)
+	}
+
+	switch {
+	case code == FCMErrorUnregistered || code == FCMErrorSenderIDMismatch || resp.StatusCode == http.StatusNotFound:
+		return PushResult{Error: msg, Unregistered: true}, nil
+	case resp.StatusCode == http.StatusBadRequest:
+		return PushResult{Error: msg}, nil
+	case resp.StatusCode == http.StatusUnauthorized:
+		// Fetch a new access token on the next attempt
+		c.mu.Lock()
+		c.accessToken = ""
+		c.mu.Unlock()
+	}
+	return PushResult{}, fmt.Errorf("fcm request failed with status %d: %s", resp.StatusCode, string(respBody))
+}
+
+// token returns a cached access token, exchanging a signed assertion for a
+// new one when it is about to expire
+func (c *FCMClient) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.accessToken != "" && time.Until(c.expiresAt) > fcmTokenRefreshMargin {
+		return c.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   c.credentials.ClientEmail,
+		"scope": fcmScope,
+		"aud":   c.credentials.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(fcmTokenLifetime).Unix(),
+	})
+	if c.credentials.PrivateKeyID != "" {
+		assertion.Header["kid"] = c.credentials.PrivateKeyID
+	}
+	signed, err := assertion.SignedString(c.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign fcm token assertion: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {signed},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.credentials.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch fcm access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("fcm token request failed with status %d: %s", resp.StatusCode, string(data))
+	}
+
+	var token fcmTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode fcm token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("fcm token response contained no access token")
+	}
+
+	c.accessToken = token.AccessToken
+	c.expiresAt = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	return c.accessToken, nil
+}
+
+// stringData converts push data to the string-only map FCM expects. Strings
+// are passed through, anything else is JSON encoded.
+func stringData(data map[string]any) (map[string]string, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	out := make(map[string]string, len(data))
+	for key, value := range data {
+		if str, ok := value.(string); ok {
+			out[key] = str
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode push data %q: %w", key, err)
+		}
+		out[key] = string(encoded)
+	}
+	return out, nil
+}
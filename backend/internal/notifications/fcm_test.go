@@ -0,0 +1,316 @@
+package notifications
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fcmServer is a stand-in for both Google's OAuth token endpoint and the FCM
+// HTTP v1 API. Messages are answered according to their token.
+type fcmServer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	responses map[string]fcmStubResponse
+
+	mu            sync.Mutex
+	tokenRequests int
+	sent          []fcmMessage
+	auth          []string
+}
+
+// fcmStubResponse is the canned answer for one device token
+type fcmStubResponse struct {
+	status int
+	body   string
+}
+
+func newFCMServer(t *testing.T, responses map[string]fcmStubResponse) *fcmServer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fcmServer{key: key, responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			s.handleToken(t, w, r)
+		case "/v1/projects/marko-test/messages:send":
+			s.handleSend(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fcmServer) handleToken(t *testing.T, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		http.Error(w, "unsupported grant type", http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(r.Form.Get("assertion"), claims, func(token *jwt.Token) (any, error) {
+		return &s.key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(s.URL+"/token"), jwt.WithIssuer("push@marko-test.iam.gserviceaccount.com"))
+	if err != nil {
+		t.Errorf("invalid token assertion: %v", err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if token.Header["kid"] != "key-1" || claims["scope"] != fcmScope {
+		t.Errorf("assertion kid = %v, scope = %v", token.Header["kid"], claims["scope"])
+	}
+
+	s.mu.Lock()
+	s.tokenRequests++
+	accessToken := fmt.Sprintf("access-%d", s.tokenRequests)
+	s.mu.Unlock()
+
+	_ = json.NewEncoder(w).Encode(fcmTokenResponse{AccessToken: accessToken, ExpiresIn: 3600})
+}
+
+func (s *fcmServer) handleSend(w http.ResponseWriter, r *http.Request) {
+	var req fcmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.sent = append(s.sent, req.Message)
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+	s.mu.Unlock()
+
+	resp, ok := s.responses[req.Message.Token]
+	if !ok {
+		resp = fcmStubResponse{status: http.StatusOK, body: `{"name":"projects/marko-test/messages/1"}`}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.status)
+	_, _ = w.Write([]byte(resp.body))
+}
+
+// newTestFCMClient writes a service account key for the stand-in server and
+// creates a client using it
+func newTestFCMClient(t *testing.T, s *fcmServer) *FCMClient {
+	t.Helper()
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(s.key)})
+	credentials, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "marko-test",
+		"private_key_id": "key-1",
+		"private_key":    string(keyPEM),
+		"client_email":   "push@marko-test.iam.gserviceaccount.com",
+		"token_uri":      s.URL + "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "service-account.json")
+	if err := os.WriteFile(path, credentials, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewFCMClient(s.URL+"/v1", path)
+	if err != nil {
+		t.Fatalf("NewFCMClient() error = %v", err)
+	}
+	return client
+}
+
+func fcmError(code int, status, errorCode, message string) string {
+	details := ""
+	if errorCode != "" {
+		details = fmt.Sprintf(`,"details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":%q}]`, errorCode)
+	}
+	return fmt.Sprintf(`{"error":{"code":%d,"message":%q,"status":%q%s}}`, code, message, status, details)
+}
+
+func TestFCMTokenExchangeAndCaching(t *testing.T) {
+	srv := newFCMServer(t, nil)
+	client := newTestFCMClient(t, srv)
+
+	badge := 3
+	messages := []PushMessage{
+		{Token: "token-a", Title: "Ana arrived", Body: "Ana arrived in France", Data: map[string]any{"type": "location_update", "count": 2}, Badge: &badge},
+		{Token: "token-b", Title: "Ana arrived", Body: "Ana arrived in France"},
+	}
+	for i := 0; i < 2; i++ {
+		results, err := client.Push(context.Background(), messages)
+		if err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+		for j, result := range results {
+			if !result.OK() || result.TicketID != "" {
+				t.Errorf("result %d = %+v, want delivered without ticket", j, result)
+			}
+		}
+	}
+
+	if srv.tokenRequests != 1 {
+		t.Errorf("token requests = %d, want 1 for cached access token", srv.tokenRequests)
+	}
+	for i, auth := range srv.auth {
+		if auth != "Bearer access-1" {
+			t.Errorf("request %d Authorization = %q", i, auth)
+		}
+	}
+
+	// Data values are sent as strings and the badge through the APNs payload
+	first := srv.sent[0]
+	if first.Data["type"] != "location_update" || first.Data["count"] != "2" {
+		t.Errorf("data = %v", first.Data)
+	}
+	if first.APNs == nil || first.APNs.Payload.APS.Badge == nil || *first.APNs.Payload.APS.Badge != 3 {
+		t.Errorf("apns = %+v, want badge 3", first.APNs)
+	}
+	if srv.sent[1].APNs != nil {
+		t.Errorf("apns = %+v, want none without a badge", srv.sent[1].APNs)
+	}
+}
+
+func TestFCMResults(t *testing.T) {
+	tests := []struct {
+		name             string
+		response         fcmStubResponse
+		wantErr          bool
+		wantError        string
+		wantUnregistered bool
+		wantTokenReset   bool
+	}{
+		{
+			name:     "accepted",
+			response: fcmStubResponse{status: http.StatusOK, body: `{"name":"projects/marko-test/messages/1"}`},
+		},
+		{
+			name:             "unregistered",
+			response:         fcmStubResponse{status: http.StatusNotFound, body: fcmError(404, "NOT_FOUND", FCMErrorUnregistered, "Requested entity was not found.")},
+			wantError:        "UNREGISTERED: Requested entity was not found.",
+			wantUnregistered: true,
+		},
+		{
+			name:             "sender ID mismatch",
+			response:         fcmStubResponse{status: http.StatusForbidden, body: fcmError(403, "PERMISSION_DENIED", FCMErrorSenderIDMismatch, "SenderId mismatch")},
+			wantError:        "SENDER_ID_MISMATCH: SenderId mismatch",
+			wantUnregistered: true,
+		},
+		{
+			name:      "invalid argument",
+			response:  fcmStubResponse{status: http.StatusBadRequest, body: fcmError(400, "INVALID_ARGUMENT", "INVALID_ARGUMENT", "Invalid registration token")},
+			wantError: "INVALID_ARGUMENT: Invalid registration token",
+		},
+		{
+			name:      "bad request without body",
+			response:  fcmStubResponse{status: http.StatusBadRequest},
+			wantError: "Bad Request",
+		},
+		{
+			name:     "server error",
+			response: fcmStubResponse{status: http.StatusServiceUnavailable, body: fcmError(503, "UNAVAILABLE", "UNAVAILABLE", "The service is currently unavailable.")},
+			wantErr:  true,
+		},
+		{
+			name:           "unauthorized",
+			response:       fcmStubResponse{status: http.StatusUnauthorized, body: fcmError(401, "UNAUTHENTICATED", "THIRD_PARTY_AUTH_ERROR", "Request had invalid authentication credentials.")},
+			wantErr:        true,
+			wantTokenReset: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFCMServer(t, map[string]fcmStubResponse{"device": tt.response})
+			client := newTestFCMClient(t, srv)
+
+			results, err := client.Push(context.Background(), []PushMessage{{Token: "device", Title: "Title", Body: "Body"}})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Push() error = nil, want an error so the push is retried")
+				}
+				if len(results) != 0 {
+					t.Errorf("got %d results, want none", len(results))
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Push() error = %v", err)
+				}
+				want := PushResult{Error: tt.wantError, Unregistered: tt.wantUnregistered}
+				if len(results) != 1 || results[0] != want {
+					t.Fatalf("results = %+v, want [%+v]", results, want)
+				}
+			}
+
+			client.mu.Lock()
+			reset := client.accessToken == ""
+			client.mu.Unlock()
+			if reset != tt.wantTokenReset {
+				t.Errorf("access token reset = %v, want %v", reset, tt.wantTokenReset)
+			}
+
+			// A reset token is exchanged again on the next attempt
+			if tt.wantTokenReset {
+				_, _ = client.Push(context.Background(), []PushMessage{{Token: "other", Title: "Title"}})
+				if srv.tokenRequests != 2 {
+					t.Errorf("token requests = %d, want 2 after reset", srv.tokenRequests)
+				}
+			}
+		})
+	}
+}
+
+func TestFCMPushStopsAtFailure(t *testing.T) {
+	srv := newFCMServer(t, map[string]fcmStubResponse{
+		"gone":   {status: http.StatusNotFound, body: fcmError(404, "NOT_FOUND", FCMErrorUnregistered, "gone")},
+		"broken": {status: http.StatusInternalServerError, body: fcmError(500, "INTERNAL", "INTERNAL", "oops")},
+	})
+	client := newTestFCMClient(t, srv)
+
+	results, err := client.Push(context.Background(), []PushMessage{
+		{Token: "ok"}, {Token: "gone"}, {Token: "broken"}, {Token: "never-sent"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "status 500") {
+		t.Fatalf("Push() error = %v, want status 500", err)
+	}
+	if len(results) != 2 || !results[0].OK() || !results[1].Unregistered {
+		t.Fatalf("results = %+v, want the two results before the failure", results)
+	}
+	if len(srv.sent) != 3 {
+		t.Errorf("sent %d messages, want 3", len(srv.sent))
+	}
+}
+
+func TestNewFCMClientValidatesCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service-account.json")
+	if err := os.WriteFile(path, []byte(`{"project_id":"marko-test"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFCMClient("", path); err == nil {
+		t.Error("NewFCMClient() accepted credentials without client_email and token_uri")
+	}
+	if _, err := NewFCMClient("", filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("NewFCMClient() accepted a missing credentials file")
+	}
+}
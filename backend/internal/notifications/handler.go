@@ -3,8 +3,10 @@ package notifications
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 
 	"github.com/marko/backend/internal/auth"
@@ -27,15 +29,19 @@ func (h *Handler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.Han
 	notifications.Use(authMiddleware)
 	{
 		notifications.GET("", h.ListNotifications)
+		notifications.GET("/unread-count", h.UnreadCount)
+		notifications.POST("/read", h.MarkRead)
 	}
 }
 
 // ListNotificationsResponse represents the response for listing notifications
 type ListNotificationsResponse struct {
 	Notifications []*db.Notification `json:"notifications"`
+	NextCursor    *string            `json:"next_cursor"` // nil on the last page
 }
 
-// ListNotifications lists notifications for the authenticated user
+// ListNotifications lists notifications for the authenticated user, newest
+// first
 func (h *Handler) ListNotifications(c *gin.Context) {
 	user, err := auth.GetUserFromGin(c)
 	if err != nil {
@@ -47,17 +53,150 @@ func (h *Handler) ListNotifications(c *gin.Context) {
 	// Get limit parameter (default to 50, max 100)
 	limit := 50
 	if limitStr := c.Query("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
-			limit = parsedLimit
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 1 || parsedLimit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
 		}
+		limit = parsedLimit
 	}
 
-	notifications, err := h.db.ListUserNotifications(c.Request.Context(), user.ID, limit)
+	cursor, err := db.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+
+	filter, ok := parseFilter(c)
+	if !ok {
+		return
+	}
+
+	notifications, next, err := h.db.ListUserNotifications(c.Request.Context(), user.ID, filter, cursor, limit)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to list user notifications")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list notifications"})
 		return
 	}
 
-	c.JSON(http.StatusOK, ListNotificationsResponse{Notifications: notifications})
-}
\ No newline at end of file
+	response := ListNotificationsResponse{Notifications: notifications}
+	if next != nil {
+		encoded := next.Encode()
+		response.NextCursor = &encoded
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UnreadCountResponse represents the number of unread notifications
+type UnreadCountResponse struct {
+	Unread int `json:"unread"`
+}
+
+// UnreadCount counts the authenticated user's unread notifications. It
+// takes the same filters as ListNotifications.
+func (h *Handler) UnreadCount(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	filter, ok := parseFilter(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.db.CountUnreadNotifications(c.Request.Context(), user.ID, filter)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to count unread notifications")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, UnreadCountResponse{Unread: count})
+}
+
+// MarkReadRequest represents the request body for marking notifications as
+// read. Exactly one of IDs and UpToID must be set.
+type MarkReadRequest struct {
+	IDs []uuid.UUID `json:"ids" binding:"max=100"`
+	// UpToID marks this notification and every older one as read
+	UpToID *uuid.UUID `json:"upToId"`
+}
+
+// MarkReadResponse represents the response for marking notifications as read
+type MarkReadResponse struct {
+	Updated int64 `json:"updated"` // notifications that were unread
+}
+
+// MarkRead marks the authenticated user's notifications as read, either by
+// ID or everything up to a given notification
+func (h *Handler) MarkRead(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var req MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (len(req.IDs) == 0) == (req.UpToID == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either ids or upToId"})
+		return
+	}
+
+	if req.UpToID != nil {
+		updated, found, err := h.db.MarkNotificationsReadUpTo(c.Request.Context(), user.ID, *req.UpToID)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to mark notifications read")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications read"})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			return
+		}
+		c.JSON(http.StatusOK, MarkReadResponse{Updated: updated})
+		return
+	}
+
+	updated, err := h.db.MarkNotificationsRead(c.Request.Context(), user.ID, req.IDs)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to mark notifications read")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MarkReadResponse{Updated: updated})
+}
+
+// parseFilter reads the group_id and since (RFC 3339) query parameters. It
+// writes an error response and returns false if either is invalid.
+func parseFilter(c *gin.Context) (db.NotificationFilter, bool) {
+	var filter db.NotificationFilter
+
+	if groupIDStr := c.Query("group_id"); groupIDStr != "" {
+		groupID, err := uuid.Parse(groupIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+			return filter, false
+		}
+		filter.GroupID = &groupID
+	}
+
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		since, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp"})
+			return filter, false
+		}
+		filter.Since = &since
+	}
+
+	return filter, true
+}
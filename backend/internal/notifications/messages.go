@@ -0,0 +1,63 @@
+package notifications
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+
+	"github.com/marko/backend/internal/i18n"
+)
+
+// digestTemplates holds the text of digest pushes for each supported language
+type digestTemplates struct {
+	// titleOne and titleMany summarize the number of notifications; titleMany
+	// takes the count
+	titleOne  string
+	titleMany string
+	// more takes the number of notifications not quoted in the body
+	more string
+}
+
+// templates has an entry for every language in i18n.Supported
+var templates = map[language.Tag]digestTemplates{
+	language.English: {
+		titleOne:  "1 update from your groups",
+		titleMany: "%d updates from your groups",
+		more:      "and %d more",
+	},
+	language.Spanish: {
+		titleOne:  "1 novedad de tus grupos",
+		titleMany: "%d novedades de tus grupos",
+		more:      "y %d más",
+	},
+	language.French: {
+		titleOne:  "1 nouveauté de vos groupes",
+		titleMany: "%d nouveautés de vos groupes",
+		more:      "et %d de plus",
+	},
+	language.German: {
+		titleOne:  "1 Neuigkeit aus deinen Gruppen",
+		titleMany: "%d Neuigkeiten aus deinen Gruppen",
+		more:      "und %d weitere",
+	},
+	language.Portuguese: {
+		titleOne:  "1 novidade dos seus grupos",
+		titleMany: "%d novidades dos seus grupos",
+		more:      "e mais %d",
+	},
+}
+
+// digestTitle summarizes the number of notifications in a digest
+func digestTitle(locale string, count int) string {
+	t, _ := i18n.Lookup(templates, locale)
+	if count == 1 {
+		return t.titleOne
+	}
+	return fmt.Sprintf(t.titleMany, count)
+}
+
+// digestMore notes how many notifications a digest body leaves out
+func digestMore(locale string, count int) string {
+	t, _ := i18n.Lookup(templates, locale)
+	return fmt.Sprintf(t.more, count)
+}
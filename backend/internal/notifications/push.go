@@ -0,0 +1,43 @@
+package notifications
+
+import "context"
+
+// PushProvider delivers push messages through one push service. Each device
+// is routed to the provider matching its token type.
+type PushProvider interface {
+	// TokenType returns the device token type the provider handles, e.g.
+	// db.TokenTypeExpo
+	TokenType() string
+
+	// Push sends messages and returns one result per message, in the same
+	// order as the input. An error means the remaining messages could not be
+	// sent and the push should be retried; results for messages sent before
+	// the failure are still returned.
+	Push(ctx context.Context, messages []PushMessage) ([]PushResult, error)
+}
+
+// PushMessage is a push addressed to a single device token
+type PushMessage struct {
+	Token string
+	Title string
+	Body  string
+	Data  map[string]any
+	Badge *int
+}
+
+// PushResult is a provider's verdict on a single message
+type PushResult struct {
+	// TicketID identifies the message for a later receipt. It is empty for
+	// providers that confirm delivery when the message is sent.
+	TicketID string
+	// Error describes why the message was rejected, empty on success
+	Error string
+	// Unregistered means the token is no longer valid and the device should
+	// not be pushed to again
+	Unregistered bool
+}
+
+// OK reports whether the provider accepted the message
+func (r PushResult) OK() bool {
+	return r.Error == ""
+}
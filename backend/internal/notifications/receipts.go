@@ -0,0 +1,164 @@
+package notifications
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/db"
+)
+
+const (
+	// receiptBatchSize is the number of pending tickets checked per poll
+	receiptBatchSize = 1000
+	// receiptExpiry is how long Expo keeps receipts around
+	receiptExpiry = 24 * time.Hour
+	// defaultReceiptPollInterval is used when no positive interval is given
+	defaultReceiptPollInterval = time.Minute
+)
+
+// ReceiptWorker polls Expo for push receipts, records the delivery status of
+// each notification and disables devices whose tokens are no longer valid
+type ReceiptWorker struct {
+	db       *db.DB
+	expo     *ExpoClient
+	interval time.Duration
+	delay    time.Duration
+}
+
+// NewReceiptWorker creates a new receipt worker. Tickets are only checked
+// once they are older than delay, since Expo needs time to produce receipts.
+func NewReceiptWorker(database *db.DB, expo *ExpoClient, interval, delay time.Duration) *ReceiptWorker {
+	if interval <= 0 {
+		interval = defaultReceiptPollInterval
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return &ReceiptWorker{
+		db:       database,
+		expo:     expo,
+		interval: interval,
+		delay:    delay,
+	}
+}
+
+// Run polls for receipts until the context is cancelled
+func (w *ReceiptWorker) Run(ctx context.Context) {
+	log.Info().Dur("interval", w.interval).Dur("delay", w.delay).Msg("Starting push receipt worker")
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Push receipt worker stopped")
+			return
+		case <-ticker.C:
+			if err := w.Poll(ctx); err != nil {
+				log.Error().Err(err).Msg("Failed to poll push receipts")
+			}
+		}
+	}
+}
+
+// Poll expires tickets Expo no longer keeps receipts for and checks one
+// batch of pending tickets
+func (w *ReceiptWorker) Poll(ctx context.Context) error {
+	expired, err := w.db.ExpirePushTickets(ctx, time.Now().Add(-receiptExpiry))
+	if err != nil {
+		return err
+	}
+	if len(expired) > 0 {
+		if err := w.db.RefreshNotificationDeliveryStatus(ctx, expired); err != nil {
+			return err
+		}
+		log.Debug().Int("notifications", len(expired)).Msg("Expired push tickets without receipts")
+	}
+
+	tickets, err := w.db.ClaimPendingPushTickets(ctx, time.Now().Add(-w.delay), receiptBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(tickets) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(tickets))
+	for _, ticket := range tickets {
+		if ticket.TicketID != nil {
+			ids = append(ids, *ticket.TicketID)
+		}
+	}
+
+	receipts, err := w.expo.GetReceipts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	touched := make(map[uuid.UUID]struct{})
+	for _, ticket := range tickets {
+		if w.applyReceipt(ctx, ticket, receipts) && ticket.NotificationID != nil {
+			touched[*ticket.NotificationID] = struct{}{}
+		}
+	}
+
+	notificationIDs := make([]uuid.UUID, 0, len(touched))
+	for id := range touched {
+		notificationIDs = append(notificationIDs, id)
+	}
+	if err := w.db.RefreshNotificationDeliveryStatus(ctx, notificationIDs); err != nil {
+		return err
+	}
+
+	log.Debug().Int("tickets", len(tickets)).Int("receipts", len(receipts)).Msg("Polled push receipts")
+	return nil
+}
+
+// applyReceipt records the receipt for a ticket and reports whether the
+// ticket changed. Tickets without a receipt are retried on a later poll
+// until they expire.
+func (w *ReceiptWorker) applyReceipt(ctx context.Context, ticket *db.PushTicket, receipts map[string]ExpoReceipt) bool {
+	var receipt ExpoReceipt
+	var ok bool
+	if ticket.TicketID != nil {
+		receipt, ok = receipts[*ticket.TicketID]
+	}
+	if !ok {
+		return false
+	}
+
+	if receipt.Status == "ok" {
+		if err := w.db.UpdatePushTicketReceipt(ctx, ticket.ID, "ok", nil); err != nil {
+			log.Error().Err(err).Str("ticket_id", ticket.ID.String()).Msg("Failed to record push receipt")
+			return false
+		}
+		return true
+	}
+
+	msg := receipt.Message
+	if code := receipt.ErrorCode(); code != "" {
+		msg = code + ": " + msg
+	}
+	if err := w.db.UpdatePushTicketReceipt(ctx, ticket.ID, "error", &msg); err != nil {
+		log.Error().Err(err).Str("ticket_id", ticket.ID.String()).Msg("Failed to record push receipt")
+		return false
+	}
+
+	log.Warn().
+		Str("device_id", ticket.DeviceID.String()).
+		Str("error", msg).
+		Msg("Push notification delivery failed")
+
+	if receipt.ErrorCode() == ExpoErrorDeviceNotRegistered {
+		if err := w.db.DisableDevice(ctx, ticket.DeviceID); err != nil {
+			log.Error().Err(err).Str("device_id", ticket.DeviceID.String()).Msg("Failed to disable device")
+		} else {
+			log.Info().Str("device_id", ticket.DeviceID.String()).Msg("Disabled device with unregistered push token")
+		}
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewReceiptWorkerDefaults(t *testing.T) {
+	tests := []struct {
+		interval, delay         time.Duration
+		wantInterval, wantDelay time.Duration
+	}{
+		{interval: 30 * time.Second, delay: time.Minute, wantInterval: 30 * time.Second, wantDelay: time.Minute},
+		{interval: 0, delay: 0, wantInterval: defaultReceiptPollInterval, wantDelay: 0},
+		{interval: -time.Second, delay: -time.Second, wantInterval: defaultReceiptPollInterval, wantDelay: 0},
+	}
+	for _, tt := range tests {
+		w := NewReceiptWorker(nil, nil, tt.interval, tt.delay)
+		if w.interval != tt.wantInterval || w.delay != tt.wantDelay {
+			t.Errorf("NewReceiptWorker(%v, %v) interval = %v, delay = %v, want %v, %v",
+				tt.interval, tt.delay, w.interval, w.delay, tt.wantInterval, tt.wantDelay)
+		}
+	}
+}
@@ -1,67 +1,224 @@
 package notifications
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/db"
+	"github.com/marko/backend/internal/stream"
 )
 
+// PushNotification describes a push to deliver to one or more devices
+type PushNotification struct {
+	// NotificationIDs links the resulting tickets to stored notifications.
+	// A digest push covers several, and gets a ticket per notification.
+	NotificationIDs []uuid.UUID
+	Title           string
+	Body            string
+	Data            map[string]any
+	Badge           *int
+}
+
 // Service handles notification-related operations
 type Service struct {
-	expoPushToken string
+	db        *db.DB
+	providers map[string]PushProvider
+	hub       *stream.Hub
+	mailer    *SMTPClient
 }
 
-// NewService creates a new notification service
-func NewService(expoPushToken string) *Service {
+// NewService creates a new notification service. Pushes go to each device
+// through the provider for its token type; notifications are also published
+// to the recipient's open streams on hub and, for recipients who asked for
+// it, emailed through mailer. A nil mailer disables email.
+func NewService(database *db.DB, hub *stream.Hub, mailer *SMTPClient, providers ...PushProvider) *Service {
+	byTokenType := make(map[string]PushProvider, len(providers))
+	for _, provider := range providers {
+		byTokenType[provider.TokenType()] = provider
+	}
 	return &Service{
-		expoPushToken: expoPushToken,
+		db:        database,
+		providers: byTokenType,
+		hub:       hub,
+		mailer:    mailer,
 	}
 }
 
-// SendPushNotification sends a push notification to a user (stub implementation)
-func (s *Service) SendPushNotification(pushToken, message string) error {
-	// This is a stub implementation for now
-	// In production, this would integrate with Expo's Push API
-	log.Info().
-		Str("push_token", pushToken).
-		Str("message", message).
-		Msg("Sending push notification (stub)")
-	
-	// TODO: Implement actual Expo Push API integration
-	// Example of what the real implementation would look like:
-	/*
-	payload := map[string]interface{}{
-		"to": pushToken,
-		"sound": "default",
-		"body": message,
-		"data": map[string]string{
-			"type": "location_update",
-		},
-	}
-	
-	jsonPayload, err := json.Marshal(payload)
+// SendPushNotification sends a push notification to the given devices
+// through their push providers and stores one ticket per device. Devices
+// that already have a ticket for the notifications are skipped, so when one
+// provider fails and the delivery is retried, devices that got the push the
+// first time do not get it again.
+func (s *Service) SendPushNotification(ctx context.Context, devices []*db.Device, push PushNotification) error {
+	ticketed, err := s.db.ListTicketedDeviceIDs(ctx, push.NotificationIDs)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return err
+	}
+	done := make(map[uuid.UUID]bool, len(ticketed))
+	for _, id := range ticketed {
+		done[id] = true
 	}
-	
-	req, err := http.NewRequest("POST", "https://exp.host/--/api/v2/push/send", bytes.NewBuffer(jsonPayload))
+
+	byTokenType := make(map[string][]*db.Device)
+	for _, device := range devices {
+		if done[device.ID] {
+			continue
+		}
+		byTokenType[device.TokenType] = append(byTokenType[device.TokenType], device)
+	}
+	if len(byTokenType) == 0 {
+		return nil
+	}
+
+	var sendErr error
+	stored := false
+	for tokenType, group := range byTokenType {
+		provider, ok := s.providers[tokenType]
+		if !ok {
+			log.Warn().Str("token_type", tokenType).Int("devices", len(group)).Msg("No push provider configured for token type")
+			for _, device := range group {
+				s.storeTickets(ctx, push.NotificationIDs, device, PushResult{Error: "no push provider for token type " + tokenType})
+			}
+			stored = true
+			continue
+		}
+
+		messages := make([]PushMessage, len(group))
+		for i, device := range group {
+			messages[i] = PushMessage{
+				Token: device.PushToken,
+				Title: push.Title,
+				Body:  push.Body,
+				Data:  push.Data,
+				Badge: push.Badge,
+			}
+		}
+
+		results, err := provider.Push(ctx, messages)
+
+		// Store whatever results we got back, even if a later message failed
+		for i, result := range results {
+			s.storeTickets(ctx, push.NotificationIDs, group[i], result)
+		}
+		stored = stored || len(results) > 0
+		if err != nil && sendErr == nil {
+			sendErr = fmt.Errorf("failed to send %s push notification: %w", tokenType, err)
+		}
+	}
+
+	if stored {
+		if err := s.db.RefreshNotificationDeliveryStatus(ctx, push.NotificationIDs); err != nil {
+			log.Error().Err(err).Msg("Failed to refresh notification delivery status")
+		}
+	}
+
+	return sendErr
+}
+
+// HandleNotificationCreated delivers a stored notification to every active
+// device of its recipient. It is registered as an outbox handler, so a
+// returned error causes the delivery to be retried.
+func (s *Service) HandleNotificationCreated(ctx context.Context, event *db.OutboxEvent) error {
+	var payload db.NotificationCreatedEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to decode notification event: %w", err)
+	}
+
+	notification, err := s.db.GetNotificationByID(ctx, payload.NotificationID)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.expoPushToken))
-	
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+		return err
+	}
+	if notification == nil {
+		// Deleted before we got to it
+		return nil
+	}
+
+	// Retries only concern the push
+	if event.Attempts == 1 {
+		s.hub.Publish(ctx, stream.Event{Type: stream.EventNotification, Data: notification}, notification.UserID)
+	}
+
+	devices, err := s.db.ListActiveUserDevices(ctx, notification.UserID)
 	if err != nil {
-		return fmt.Errorf("failed to send push notification: %w", err)
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("push notification failed with status %d: %s", resp.StatusCode, string(body))
-	}
-	*/
-	
-	return nil
-}
\ No newline at end of file
+		return err
+	}
+
+	data := map[string]any{
+		"type":            notification.Type,
+		"notification_id": notification.ID.String(),
+	}
+	if notification.GroupID != nil {
+		data["group_id"] = notification.GroupID.String()
+	}
+	if len(notification.GroupIDs) > 1 {
+		groupIDs := make([]string, len(notification.GroupIDs))
+		for i, id := range notification.GroupIDs {
+			groupIDs[i] = id.String()
+		}
+		data["group_ids"] = groupIDs
+	}
+
+	return s.SendPushNotification(ctx, devices, PushNotification{
+		NotificationIDs: []uuid.UUID{notification.ID},
+		Title:           notification.Title,
+		Body:            notification.Message,
+		Data:            data,
+	})
+}
+
+// storeTickets records the result for a single device, one ticket per
+// notification the push covered, logging rather than failing
+func (s *Service) storeTickets(ctx context.Context, notificationIDs []uuid.UUID, device *db.Device, result PushResult) {
+	ticket := db.NewPushTicket{
+		DeviceID: device.ID,
+		Status:   "ok",
+	}
+	switch {
+	case !result.OK():
+		ticket.Status = "error"
+		ticket.Error = &result.Error
+
+		log.Warn().
+			Str("device_id", device.ID.String()).
+			Str("token_type", device.TokenType).
+			Str("error", result.Error).
+			Msg("Push notification rejected by provider")
+
+		if result.Unregistered {
+			s.disableDevice(ctx, device.ID)
+		}
+	case result.TicketID != "":
+		// The receipt worker fetches the receipt later
+		ticket.TicketID = &result.TicketID
+	default:
+		// The provider confirmed delivery right away
+		receiptStatus := "ok"
+		ticket.ReceiptStatus = &receiptStatus
+	}
+
+	if len(notificationIDs) == 0 {
+		if _, err := s.db.CreatePushTicket(ctx, ticket); err != nil {
+			log.Error().Err(err).Str("device_id", device.ID.String()).Msg("Failed to store push ticket")
+		}
+		return
+	}
+	for _, notificationID := range notificationIDs {
+		ticket.NotificationID = &notificationID
+		if _, err := s.db.CreatePushTicket(ctx, ticket); err != nil {
+			log.Error().Err(err).Str("device_id", device.ID.String()).Msg("Failed to store push ticket")
+		}
+	}
+}
+
+// disableDevice stops further pushes to a device with a dead token
+func (s *Service) disableDevice(ctx context.Context, deviceID uuid.UUID) {
+	if err := s.db.DisableDevice(ctx, deviceID); err != nil {
+		log.Error().Err(err).Str("device_id", deviceID.String()).Msg("Failed to disable device")
+		return
+	}
+	log.Info().Str("device_id", deviceID.String()).Msg("Disabled device with unregistered push token")
+}
@@ -0,0 +1,213 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/db"
+)
+
+// Headers sent with every webhook delivery
+const (
+	// WebhookEventHeader names the event, e.g. "location.updated"
+	WebhookEventHeader = "X-Marko-Event"
+	// WebhookDeliveryHeader identifies the delivery; it stays the same
+	// across retries so receivers can drop duplicates
+	WebhookDeliveryHeader = "X-Marko-Delivery"
+	// WebhookTimestampHeader holds the Unix time the request was signed at
+	WebhookTimestampHeader = "X-Marko-Timestamp"
+	// WebhookSignatureHeader holds "sha256=" followed by the hex encoded
+	// HMAC-SHA256 of "<timestamp>.<body>", keyed with the webhook secret
+	WebhookSignatureHeader = "X-Marko-Signature"
+)
+
+// errPrivateAddress is returned when a webhook URL resolves to an address
+// inside our own network
+var errPrivateAddress = errors.New("webhook address is not publicly routable")
+
+// nonPublicPrefixes are the special-purpose ranges (RFC 6890 and updates)
+// that webhooks may not be delivered to
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // this network
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link-local
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved and broadcast
+	netip.MustParsePrefix("::/96"),           // unspecified, loopback and IPv4-compatible
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments, incl. Teredo
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+	netip.MustParsePrefix("fe80::/10"),       // link-local
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+}
+
+// Prefixes of IPv6 addresses that embed the IPv4 address traffic ends up
+// at, which is checked instead
+var (
+	// nat64Prefix is the well-known NAT64 prefix (RFC 6052), with the IPv4
+	// address in the last 32 bits
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+	// sixToFourPrefix is 6to4 (RFC 3056), with the IPv4 address in bits 16-47
+	sixToFourPrefix = netip.MustParsePrefix("2002::/16")
+)
+
+// WebhookSender posts location updates to group webhooks
+type WebhookSender struct {
+	db         *db.DB
+	httpClient *http.Client
+}
+
+// NewWebhookSender creates a new webhook sender. Unless allowPrivate is set,
+// webhooks resolving to loopback, private, shared, link-local, multicast or
+// other special-purpose addresses are refused, so group admins cannot use
+// them to reach internal services. Requests never go through a proxy from
+// the environment, which would make the dialed address the proxy's instead
+// of the webhook's.
+func NewWebhookSender(database *db.DB, allowPrivate bool) *WebhookSender {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddress(addrPort.Addr()) {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &WebhookSender{
+		db:         database,
+		httpClient: &http.Client{Timeout: 10 * time.Second, Transport: transport},
+	}
+}
+
+// isPublicAddress reports whether addr is publicly routable, i.e. whether a
+// webhook may be delivered to it
+func isPublicAddress(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	// IPv4-mapped IPv6 addresses are checked as IPv4. Prefixes never
+	// contain zoned addresses.
+	addr = addr.WithZone("").Unmap()
+
+	switch b := addr.As16(); {
+	case nat64Prefix.Contains(addr):
+		return isPublicAddress(netip.AddrFrom4([4]byte(b[12:16])))
+	case sixToFourPrefix.Contains(addr):
+		return isPublicAddress(netip.AddrFrom4([4]byte(b[2:6])))
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// HandleWebhookDelivery posts a queued payload to its webhook. It is
+// registered as an outbox handler: network errors, timeouts and 408, 429 or
+// 5xx responses are retried with backoff, while other 4xx responses are
+// logged and dropped.
+func (s *WebhookSender) HandleWebhookDelivery(ctx context.Context, event *db.OutboxEvent) error {
+	var payload db.WebhookDeliveryEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to decode webhook delivery event: %w", err)
+	}
+
+	webhook, err := s.db.GetGroupWebhook(ctx, payload.WebhookID)
+	if err != nil {
+		return err
+	}
+	if webhook == nil {
+		// Deleted before we got to it
+		return nil
+	}
+
+	return s.deliver(ctx, webhook, event.ID.String(), payload.Payload)
+}
+
+// deliver posts a signed payload to a webhook and reports whether the
+// delivery should be retried
+func (s *WebhookSender) deliver(ctx context.Context, webhook *db.GroupWebhook, deliveryID string, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Marko-Webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, db.EventLocationUpdated)
+	req.Header.Set(WebhookDeliveryHeader, deliveryID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		if errors.Is(err, errPrivateAddress) {
+			log.Warn().Str("webhook_id", webhook.ID.String()).Msg("Dropping webhook delivery to private address")
+			return nil
+		}
+		return fmt.Errorf("failed to send webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return fmt.Errorf("webhook request failed with status %d", resp.StatusCode)
+	default:
+		log.Warn().
+			Str("webhook_id", webhook.ID.String()).
+			Int("status", resp.StatusCode).
+			Msg("Webhook delivery rejected")
+		return nil
+	}
+}
+
+// SignWebhook computes the WebhookSignatureHeader value for a request body
+// signed at the given Unix timestamp
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
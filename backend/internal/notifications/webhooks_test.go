@@ -0,0 +1,210 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/marko/backend/internal/db"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{ip: "100.63.255.255", want: true},
+		{ip: "100.128.0.0", want: true},
+		{ip: "127.0.0.1", want: false},
+		{ip: "::1", want: false},
+		{ip: "10.1.2.3", want: false},
+		{ip: "172.16.0.1", want: false},
+		{ip: "192.168.1.1", want: false},
+		{ip: "fd00::1", want: false},
+		{ip: "169.254.169.254", want: false},
+		{ip: "fe80::1", want: false},
+		{ip: "0.0.0.0", want: false},
+		{ip: "::", want: false},
+		{ip: "100.64.0.1", want: false},
+		{ip: "100.127.255.254", want: false},
+		{ip: "224.0.0.1", want: false},
+		{ip: "239.255.255.250", want: false},
+		{ip: "ff02::1", want: false},
+		{ip: "ff01::1", want: false},
+		{ip: "::ffff:127.0.0.1", want: false},
+		{ip: "::ffff:100.64.0.1", want: false},
+		{ip: "::ffff:93.184.216.34", want: true},
+		{ip: "fe80::1%eth0", want: false},
+		{ip: "192.0.0.1", want: false},
+		{ip: "192.0.0.170", want: false},
+		{ip: "192.0.2.1", want: false},
+		{ip: "198.18.0.1", want: false},
+		{ip: "255.255.255.255", want: false},
+		{ip: "2001:db8::1", want: false},
+		{ip: "::127.0.0.1", want: false},
+
+		// NAT64 and 6to4 addresses are judged by the IPv4 address they embed
+		{ip: "64:ff9b::93.184.216.34", want: true},
+		{ip: "64:ff9b::10.0.0.1", want: false},
+		{ip: "64:ff9b::127.0.0.1", want: false},
+		{ip: "64:ff9b::169.254.169.254", want: false},
+		{ip: "64:ff9b:1::a00:1", want: false},
+		{ip: "2002:5db8:d822::1", want: true},
+		{ip: "2002:a00:1::1", want: false},
+		{ip: "2002:7f00:1::1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := isPublicAddress(netip.MustParseAddr(tt.ip)); got != tt.want {
+				t.Errorf("isPublicAddress(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+	if isPublicAddress(netip.Addr{}) {
+		t.Error("isPublicAddress(invalid) = true, want false")
+	}
+}
+
+func TestWebhookSenderRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	sender := NewWebhookSender(nil, false)
+	transport := sender.httpClient.Transport.(*http.Transport)
+	if transport.Proxy != nil {
+		t.Fatal("webhook transport uses a proxy, which bypasses the address check")
+	}
+
+	_, err := sender.httpClient.Get(srv.URL)
+	if !errors.Is(err, errPrivateAddress) {
+		t.Fatalf("request to %s error = %v, want errPrivateAddress", srv.URL, err)
+	}
+
+	resp, err := NewWebhookSender(nil, true).httpClient.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request with private addresses allowed error = %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestSignWebhook(t *testing.T) {
+	// Computed independently with Python's hmac module
+	body := []byte(`{"text":"Ana arrived in France"}`)
+	want := "sha256=98a93fe749cc1229a857c764f902faabcf59ef086cffca11592e15f58cc0b3c6"
+	if got := SignWebhook("whsec_test", "1700000000", body); got != want {
+		t.Errorf("SignWebhook() = %q, want %q", got, want)
+	}
+
+	// Every input is covered by the signature
+	for name, got := range map[string]string{
+		"secret":    SignWebhook("whsec_other", "1700000000", body),
+		"timestamp": SignWebhook("whsec_test", "1700000001", body),
+		"body":      SignWebhook("whsec_test", "1700000000", []byte(`{"text":"Ana arrived in Spain"}`)),
+	} {
+		if got == want {
+			t.Errorf("signature unchanged with a different %s", name)
+		}
+	}
+}
+
+func TestWebhookDeliveryRequest(t *testing.T) {
+	body := []byte(`{"text":"Ana arrived in France"}`)
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	webhook := &db.GroupWebhook{ID: uuid.New(), URL: srv.URL, Secret: "whsec_test"}
+	before := time.Now().Unix()
+	if err := NewWebhookSender(nil, true).deliver(context.Background(), webhook, "delivery-1", body); err != nil {
+		t.Fatalf("deliver() error = %v", err)
+	}
+
+	if got.Method != http.MethodPost || string(gotBody) != string(body) {
+		t.Errorf("request = %s %q, want POST %q", got.Method, gotBody, body)
+	}
+	for header, want := range map[string]string{
+		"Content-Type":        "application/json",
+		WebhookEventHeader:    db.EventLocationUpdated,
+		WebhookDeliveryHeader: "delivery-1",
+	} {
+		if v := got.Header.Get(header); v != want {
+			t.Errorf("%s = %q, want %q", header, v, want)
+		}
+	}
+
+	timestamp := got.Header.Get(WebhookTimestampHeader)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || ts < before || ts > time.Now().Unix() {
+		t.Errorf("%s = %q, want the Unix time of the request", WebhookTimestampHeader, timestamp)
+	}
+	if sig := got.Header.Get(WebhookSignatureHeader); sig != SignWebhook("whsec_test", timestamp, body) {
+		t.Errorf("%s = %q, want the signature of the timestamp and body", WebhookSignatureHeader, sig)
+	}
+}
+
+func TestWebhookDeliveryStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantRetry bool
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusNoContent},
+		{status: http.StatusRequestTimeout, wantRetry: true},
+		{status: http.StatusTooManyRequests, wantRetry: true},
+		{status: http.StatusInternalServerError, wantRetry: true},
+		{status: http.StatusBadGateway, wantRetry: true},
+		{status: http.StatusServiceUnavailable, wantRetry: true},
+		{status: http.StatusBadRequest},
+		{status: http.StatusUnauthorized},
+		{status: http.StatusNotFound},
+		{status: http.StatusGone},
+	}
+
+	sender := NewWebhookSender(nil, true)
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			webhook := &db.GroupWebhook{ID: uuid.New(), URL: srv.URL, Secret: "s"}
+			err := sender.deliver(context.Background(), webhook, "d", []byte(`{}`))
+			if gotRetry := err != nil; gotRetry != tt.wantRetry {
+				t.Errorf("deliver() error = %v, want retry %v", err, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestWebhookDeliveryFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	webhook := &db.GroupWebhook{ID: uuid.New(), URL: srv.URL, Secret: "s"}
+	ctx := context.Background()
+
+	// A private address will not become public, so the delivery is dropped
+	if err := NewWebhookSender(nil, false).deliver(ctx, webhook, "d", []byte(`{}`)); err != nil {
+		t.Errorf("deliver() to a private address error = %v, want nil", err)
+	}
+
+	// Network errors are retried
+	srv.Close()
+	if err := NewWebhookSender(nil, true).deliver(ctx, webhook, "d", []byte(`{}`)); err == nil {
+		t.Error("deliver() to a closed server error = nil, want an error to retry")
+	}
+}
@@ -0,0 +1,280 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/db"
+)
+
+// HandlerFunc processes a single outbox event. Returning an error schedules
+// a retry with backoff; after the final attempt the event is dead-lettered.
+type HandlerFunc func(ctx context.Context, event *db.OutboxEvent) error
+
+// Config holds the outbox worker settings
+type Config struct {
+	// Workers is the number of concurrent processing goroutines
+	Workers int
+	// BatchSize is the number of events claimed per poll
+	BatchSize int
+	// PollInterval is how long an idle worker waits before polling again
+	PollInterval time.Duration
+	// Lease is how long a claimed event stays locked to one worker. It is
+	// renewed before each event of a batch and also bounds each handler run.
+	Lease time.Duration
+	// MaxAttempts is the number of attempts before an event is dead-lettered
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry; it doubles per attempt
+	BaseBackoff time.Duration
+	// MaxBackoff caps the retry delay
+	MaxBackoff time.Duration
+	// Retention is how long processed events are kept before they are purged
+	Retention time.Duration
+}
+
+const (
+	// purgeInterval is how often processed events past retention are purged
+	purgeInterval = time.Hour
+	// purgeBatchSize bounds the rows deleted per statement, so a large
+	// backlog is purged without holding locks for long
+	purgeBatchSize = 1000
+)
+
+// Worker processes outbox events with a pool of goroutines
+type Worker struct {
+	db       *db.DB
+	cfg      Config
+	handlers map[string]HandlerFunc
+}
+
+// NewWorker creates a new outbox worker
+func NewWorker(database *db.DB, cfg Config) *Worker {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 10
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 2 * time.Minute
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = 5 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 7 * 24 * time.Hour
+	}
+
+	return &Worker{
+		db:       database,
+		cfg:      cfg,
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Handle registers the handler for an event type. It must be called before Run.
+func (w *Worker) Handle(eventType string, handler HandlerFunc) {
+	w.handlers[eventType] = handler
+}
+
+// Run starts the worker pool and blocks until the context is cancelled and
+// all in-flight events are finished
+func (w *Worker) Run(ctx context.Context) {
+	log.Info().Int("workers", w.cfg.Workers).Msg("Starting outbox worker")
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.purgeLoop(ctx)
+	}()
+	wg.Wait()
+
+	log.Info().Msg("Outbox worker stopped")
+}
+
+// loop repeatedly claims and processes batches, sleeping when idle
+func (w *Worker) loop(ctx context.Context) {
+	for {
+		processed, err := w.processBatch(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to process outbox batch")
+		}
+
+		if processed > 0 && err == nil {
+			// More work may be waiting; poll again right away
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.cfg.PollInterval):
+		}
+	}
+}
+
+// purgeLoop periodically deletes processed events older than the retention
+// period, so the table does not grow without bound
+func (w *Worker) purgeLoop(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		w.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purge deletes processed events past retention in batches
+func (w *Worker) purge(ctx context.Context) {
+	before := time.Now().Add(-w.cfg.Retention)
+	var total int64
+	for ctx.Err() == nil {
+		n, err := w.db.PurgeOutboxEvents(ctx, before, purgeBatchSize)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to purge outbox events")
+			return
+		}
+		total += n
+		if n < purgeBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		log.Info().Int64("count", total).Msg("Purged processed outbox events")
+	}
+}
+
+// processBatch claims one batch of events and processes them in order
+func (w *Worker) processBatch(ctx context.Context) (int, error) {
+	events, err := w.db.ClaimOutboxEvents(ctx, w.cfg.BatchSize, w.cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		// Finish the batch even if shutdown started, so leases are released
+		w.process(context.WithoutCancel(ctx), event)
+	}
+	return len(events), nil
+}
+
+// process runs the handler for an event and records the outcome. The lease
+// is renewed first, since earlier events of the batch may have used up most
+// of it, and the handler is cut off when the renewed lease runs out.
+func (w *Worker) process(ctx context.Context, event *db.OutboxEvent) {
+	logger := log.With().
+		Str("event_id", event.ID.String()).
+		Str("event_type", event.EventType).
+		Int("attempt", event.Attempts).
+		Logger()
+
+	if err := w.db.ExtendOutboxLease(ctx, event.ID, event.Attempts, w.cfg.Lease); err != nil {
+		if errors.Is(err, db.ErrOutboxLeaseLost) {
+			logger.Warn().Msg("Outbox event was claimed by another worker, skipping")
+		} else {
+			// Leave the event for another worker once the lease expires
+			logger.Error().Err(err).Msg("Failed to extend outbox lease")
+		}
+		return
+	}
+
+	handler, ok := w.handlers[event.EventType]
+	if !ok {
+		logger.Error().Msg("No handler registered for outbox event")
+		if err := w.db.DeadLetterOutboxEvent(ctx, event.ID, event.Attempts, "no handler registered"); err != nil {
+			logOutcomeError(logger, err, "Failed to dead-letter outbox event")
+		}
+		return
+	}
+
+	handlerCtx, cancel := context.WithTimeout(ctx, w.cfg.Lease)
+	handlerErr := w.safeHandle(handlerCtx, handler, event)
+	cancel()
+
+	if handlerErr == nil {
+		if err := w.db.CompleteOutboxEvent(ctx, event.ID, event.Attempts); err != nil {
+			logOutcomeError(logger, err, "Failed to complete outbox event")
+		}
+		return
+	}
+
+	if event.Attempts >= w.cfg.MaxAttempts {
+		logger.Error().Err(handlerErr).Msg("Outbox event failed permanently")
+		if err := w.db.DeadLetterOutboxEvent(ctx, event.ID, event.Attempts, handlerErr.Error()); err != nil {
+			logOutcomeError(logger, err, "Failed to dead-letter outbox event")
+		}
+		return
+	}
+
+	next := time.Now().Add(w.backoff(event.Attempts))
+	logger.Warn().Err(handlerErr).Time("next_attempt_at", next).Msg("Outbox event failed, will retry")
+	if err := w.db.RetryOutboxEvent(ctx, event.ID, event.Attempts, handlerErr.Error(), next); err != nil {
+		logOutcomeError(logger, err, "Failed to reschedule outbox event")
+	}
+}
+
+// logOutcomeError logs a failure to record an event's outcome. A lost lease
+// means another worker has re-run the event, so this attempt's outcome is
+// dropped.
+func logOutcomeError(logger zerolog.Logger, err error, msg string) {
+	if errors.Is(err, db.ErrOutboxLeaseLost) {
+		logger.Warn().Msg("Outbox event lease expired before the outcome was recorded")
+		return
+	}
+	logger.Error().Err(err).Msg(msg)
+}
+
+// safeHandle runs a handler, turning a panic into an error
+func (w *Worker) safeHandle(ctx context.Context, handler HandlerFunc, event *db.OutboxEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, event)
+}
+
+// backoff returns the delay before the next attempt: exponential in the
+// number of attempts so far, capped, with up to 20% jitter
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.cfg.BaseBackoff
+	for i := 1; i < attempts && delay < w.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, w.cfg.MaxBackoff)
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay + jitter
+}
@@ -0,0 +1,174 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/auth"
+)
+
+const (
+	// writeTimeout bounds each WebSocket write, so a stalled client can't
+	// hold a connection open
+	writeTimeout = 10 * time.Second
+	// defaultHeartbeat is used when no positive heartbeat interval is given
+	defaultHeartbeat = 25 * time.Second
+)
+
+// Handler serves the event stream
+type Handler struct {
+	hub       *Hub
+	heartbeat time.Duration
+	upgrader  websocket.Upgrader
+}
+
+// NewHandler creates a new stream handler. A heartbeat is sent every
+// heartbeat interval to keep idle connections open through proxies.
+func NewHandler(hub *Hub, heartbeat time.Duration) *Handler {
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+	return &Handler{
+		hub:       hub,
+		heartbeat: heartbeat,
+		upgrader: websocket.Upgrader{
+			// Clients authenticate with a bearer token rather than cookies,
+			// so cross-origin connections can't ride on a user's session
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+	}
+}
+
+// RegisterRoutes registers the stream route
+func (h *Handler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
+	stream := router.Group("/stream")
+	stream.Use(authMiddleware)
+	{
+		stream.GET("", h.Stream)
+	}
+}
+
+// Stream pushes the user's events as server-sent events, or over a
+// WebSocket if the client asks for an upgrade. The stream ends when the
+// client disconnects, falls too far behind, or the server shuts down.
+func (h *Handler) Stream(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		h.serveWebSocket(c, user)
+		return
+	}
+	h.serveSSE(c, user)
+}
+
+// serveSSE streams events as server-sent events, with a comment line as
+// heartbeat
+func (h *Handler) serveSSE(c *gin.Context, user *auth.User) {
+	sub := h.hub.Subscribe(user.ID)
+	defer h.hub.Unsubscribe(sub)
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	w.Flush()
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-sub.Dropped():
+			fmt.Fprint(w, "event: reconnect\ndata: {}\n\n")
+			w.Flush()
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		case event := <-sub.Events():
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				log.Error().Err(err).Str("type", event.Type).Msg("Failed to encode stream event")
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
+
+// serveWebSocket streams events as JSON text messages, using ping frames as
+// heartbeat. Clients that stop answering pings are disconnected.
+func (h *Handler) serveWebSocket(c *gin.Context, user *auth.User) {
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		log.Debug().Err(err).Msg("Failed to upgrade stream to WebSocket")
+		return
+	}
+	defer conn.Close()
+
+	sub := h.hub.Subscribe(user.ID)
+	defer h.hub.Unsubscribe(sub)
+
+	// Clients don't send anything, but reading is needed to process pongs
+	// and close frames
+	readDeadline := 2 * h.heartbeat
+	conn.SetReadDeadline(time.Now().Add(readDeadline))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(readDeadline))
+	})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-sub.Dropped():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "reconnect"),
+				time.Now().Add(writeTimeout))
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		case event := <-sub.Events():
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}
+}
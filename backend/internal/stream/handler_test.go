@@ -0,0 +1,22 @@
+package stream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewHandlerDefaults(t *testing.T) {
+	tests := []struct {
+		heartbeat time.Duration
+		want      time.Duration
+	}{
+		{heartbeat: 10 * time.Second, want: 10 * time.Second},
+		{heartbeat: 0, want: defaultHeartbeat},
+		{heartbeat: -time.Second, want: defaultHeartbeat},
+	}
+	for _, tt := range tests {
+		if got := NewHandler(nil, tt.heartbeat).heartbeat; got != tt.want {
+			t.Errorf("NewHandler(nil, %v).heartbeat = %v, want %v", tt.heartbeat, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package stream pushes notifications and presence changes to connected
+// clients over server-sent events or WebSocket.
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/eventbus"
+)
+
+// Event types
+const (
+	EventNotification = "notification"
+	EventPresence     = "presence"
+)
+
+// subscriptionBuffer is how many events a subscriber may fall behind before
+// it is dropped
+const subscriptionBuffer = 64
+
+// busTopic is the event bus topic stream events travel on
+const busTopic = "stream_events"
+
+// busBatchSize caps the recipients per bus message, keeping messages well
+// under the Postgres payload limit
+const busBatchSize = 100
+
+// Event is a message pushed to a user's connected clients
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+}
+
+// Subscription receives the events of one user on one connection
+type Subscription struct {
+	userID  uuid.UUID
+	events  chan Event
+	dropped chan struct{}
+}
+
+// Events returns the subscription's events
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped is closed when the hub drops the subscription, either because the
+// client fell behind or because the server is shutting down
+func (s *Subscription) Dropped() <-chan struct{} {
+	return s.dropped
+}
+
+// busMessage is an encoded event with its recipients, as sent over the
+// event bus
+type busMessage struct {
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+	UserIDs []uuid.UUID     `json:"user_ids"`
+}
+
+// Hub fans events out to the subscriptions of each user. Events travel
+// over the event bus, so clients receive them whichever instance they are
+// connected to.
+type Hub struct {
+	bus eventbus.Bus
+
+	mu   sync.Mutex
+	subs map[uuid.UUID]map[*Subscription]struct{}
+}
+
+// NewHub creates a new hub and subscribes it to the bus
+func NewHub(bus eventbus.Bus) *Hub {
+	h := &Hub{
+		bus:  bus,
+		subs: make(map[uuid.UUID]map[*Subscription]struct{}),
+	}
+	bus.Subscribe(busTopic, h.receive)
+	return h
+}
+
+// Subscribe registers a new connection of a user
+func (h *Hub) Subscribe(userID uuid.UUID) *Subscription {
+	sub := &Subscription{
+		userID:  userID,
+		events:  make(chan Event, subscriptionBuffer),
+		dropped: make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes a connection. It is safe to call after the hub
+// dropped the subscription.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(sub)
+}
+
+// Publish sends an event to every connection of the given users on all
+// instances. Delivery is best effort, so failures are only logged.
+func (h *Hub) Publish(ctx context.Context, event Event, userIDs ...uuid.UUID) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		log.Error().Err(err).Str("type", event.Type).Msg("Failed to encode stream event")
+		return
+	}
+
+	for len(userIDs) > 0 {
+		batch := userIDs[:min(len(userIDs), busBatchSize)]
+		userIDs = userIDs[len(batch):]
+
+		payload, err := json.Marshal(busMessage{Type: event.Type, Data: data, UserIDs: batch})
+		if err != nil {
+			log.Error().Err(err).Str("type", event.Type).Msg("Failed to encode stream event")
+			return
+		}
+		if err := h.bus.Publish(ctx, busTopic, payload); err != nil {
+			log.Error().Err(err).Str("type", event.Type).Msg("Failed to publish stream event")
+		}
+	}
+}
+
+// receive handles a bus message by delivering it to local subscribers
+func (h *Hub) receive(payload []byte) {
+	var msg busMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Error().Err(err).Msg("Failed to decode stream event")
+		return
+	}
+	h.deliver(Event{Type: msg.Type, Data: msg.Data}, msg.UserIDs)
+}
+
+// deliver sends an event to the connections of the given users on this
+// instance. It never blocks: a subscriber whose buffer is full is dropped,
+// and its client is expected to reconnect and catch up through the REST
+// API.
+func (h *Hub) deliver(event Event, userIDs []uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, userID := range userIDs {
+		for sub := range h.subs[userID] {
+			select {
+			case sub.events <- event:
+			default:
+				log.Warn().Str("user_id", userID.String()).Msg("Dropping slow stream subscriber")
+				h.drop(sub)
+			}
+		}
+	}
+}
+
+// Close drops every subscription, so open streams end
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.drop(sub)
+		}
+	}
+}
+
+// drop removes a subscription and tells its connection to end. The caller
+// must hold h.mu.
+func (h *Hub) drop(sub *Subscription) {
+	if h.remove(sub) {
+		close(sub.dropped)
+	}
+}
+
+// remove deletes a subscription and reports whether it was registered. The
+// caller must hold h.mu.
+func (h *Hub) remove(sub *Subscription) bool {
+	subs := h.subs[sub.userID]
+	if _, ok := subs[sub]; !ok {
+		return false
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, sub.userID)
+	}
+	return true
+}
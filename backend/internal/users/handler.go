@@ -0,0 +1,104 @@
+package users
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/text/language"
+
+	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/db"
+)
+
+// Handler handles HTTP requests for the current user's profile
+type Handler struct {
+	db *db.DB
+}
+
+// NewHandler creates a new users handler
+func NewHandler(database *db.DB) *Handler {
+	return &Handler{db: database}
+}
+
+// RegisterRoutes registers all user-related routes
+func (h *Handler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
+	me := router.Group("/me")
+	me.Use(authMiddleware)
+	{
+		me.GET("", h.GetMe)
+		me.PATCH("", h.UpdateMe)
+		me.GET("/locations", h.ListLocations)
+		me.GET("/trips", h.ListTrips)
+		me.GET("/stats", h.GetStats)
+	}
+}
+
+// UserResponse represents the response for the current user
+type UserResponse struct {
+	User *db.User `json:"user"`
+}
+
+// GetMe returns the current user's profile
+func (h *Handler) GetMe(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	profile, err := h.db.GetUserByID(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+	if profile == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, UserResponse{User: profile})
+}
+
+// UpdateMeRequest represents the request body for updating the current user
+type UpdateMeRequest struct {
+	// Locale is a BCP 47 language tag, e.g. "fr" or "pt-BR"
+	Locale string `json:"locale" binding:"required,max=35"`
+}
+
+// UpdateMe updates the current user's preferences
+func (h *Handler) UpdateMe(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var req UpdateMeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag, err := language.Parse(req.Locale)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid locale"})
+		return
+	}
+
+	profile, err := h.db.UpdateUserLocale(c.Request.Context(), user.ID, tag.String())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update user locale")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+	if profile == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, UserResponse{User: profile})
+}
@@ -0,0 +1,251 @@
+package users
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/countries"
+	"github.com/marko/backend/internal/db"
+)
+
+// ListLocationsResponse represents a page of the user's location history
+type ListLocationsResponse struct {
+	Locations  []*db.UserLocation `json:"locations"`
+	NextCursor *string            `json:"next_cursor"` // nil on the last page
+}
+
+// ListLocations lists the current user's location history, newest first
+func (h *Handler) ListLocations(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	cursor, limit, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	locations, next, err := h.db.ListUserLocations(c.Request.Context(), user.ID, cursor, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list user locations")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list locations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListLocationsResponse{Locations: locations, NextCursor: encodeCursor(next)})
+}
+
+// ListTripsResponse represents a page of the user's trips
+type ListTripsResponse struct {
+	Trips      []*db.Trip `json:"trips"`
+	NextCursor *string    `json:"next_cursor"` // nil on the last page
+}
+
+// ListTrips lists the current user's trips, newest first. Each trip pairs
+// an arrival with the update that ended it.
+func (h *Handler) ListTrips(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	cursor, limit, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	trips, next, err := h.db.ListUserTrips(c.Request.Context(), user.ID, cursor, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list user trips")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list trips"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListTripsResponse{Trips: trips, NextCursor: encodeCursor(next)})
+}
+
+// YearStats summarizes the trips of one calendar year (UTC)
+type YearStats struct {
+	Year       int      `json:"year"`
+	Countries  []string `json:"countries"`   // countries visited, in order of first visit
+	Trips      int      `json:"trips"`       // trips started this year
+	DaysAbroad int      `json:"days_abroad"` // calendar days spent on a trip
+}
+
+// StatsResponse represents the current user's travel statistics
+type StatsResponse struct {
+	Home       *string      `json:"home"` // trips here don't count; nil without trips
+	Countries  []string     `json:"countries"`
+	Trips      int          `json:"trips"`
+	DaysAbroad int          `json:"days_abroad"`
+	Years      []*YearStats `json:"years"` // oldest first
+}
+
+// GetStats returns the current user's travel statistics. Trips in the home
+// country don't count as travel; it is given as ?home=US or defaults to the
+// country the user spent the most days in.
+func (h *Handler) GetStats(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var home string
+	if code := c.Query("home"); code != "" {
+		var ok bool
+		if home, ok = countries.Normalize(code); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown country code"})
+			return
+		}
+	}
+
+	trips, err := h.db.ListAllUserTrips(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list user trips")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, travelStats(trips, home, time.Now()))
+}
+
+// travelStats aggregates trips, given oldest first, per year and overall.
+// A trip spanning several years counts towards each of them. An empty home
+// is replaced by homeCountry.
+func travelStats(trips []*db.Trip, home string, now time.Time) *StatsResponse {
+	if home == "" {
+		home = homeCountry(trips, now)
+	}
+	stats := &StatsResponse{Countries: []string{}, Years: []*YearStats{}}
+	if home != "" {
+		stats.Home = &home
+	}
+	years := make(map[int]*YearStats)
+	yearFor := func(year int) *YearStats {
+		ys, ok := years[year]
+		if !ok {
+			ys = &YearStats{Year: year, Countries: []string{}}
+			years[year] = ys
+		}
+		return ys
+	}
+
+	seen := make(map[string]bool)
+	seenInYear := make(map[int]map[string]bool)
+	days := make(map[time.Time]bool)
+
+	for _, trip := range trips {
+		if trip.CountryCode == home {
+			continue
+		}
+
+		stats.Trips++
+		yearFor(trip.StartedAt.UTC().Year()).Trips++
+		if !seen[trip.CountryCode] {
+			seen[trip.CountryCode] = true
+			stats.Countries = append(stats.Countries, trip.CountryCode)
+		}
+
+		for _, day := range tripDays(trip, now) {
+			ys := yearFor(day.Year())
+			if seenInYear[day.Year()] == nil {
+				seenInYear[day.Year()] = make(map[string]bool)
+			}
+			if !seenInYear[day.Year()][trip.CountryCode] {
+				seenInYear[day.Year()][trip.CountryCode] = true
+				ys.Countries = append(ys.Countries, trip.CountryCode)
+			}
+			if !days[day] {
+				days[day] = true
+				ys.DaysAbroad++
+				stats.DaysAbroad++
+			}
+		}
+	}
+
+	for _, ys := range years {
+		stats.Years = append(stats.Years, ys)
+	}
+	sort.Slice(stats.Years, func(i, j int) bool { return stats.Years[i].Year < stats.Years[j].Year })
+	return stats
+}
+
+// homeCountry returns the country the user spent the most days in, the
+// earliest visited one on a tie, or "" without trips
+func homeCountry(trips []*db.Trip, now time.Time) string {
+	days := make(map[string]int)
+	home := ""
+	for _, trip := range trips {
+		days[trip.CountryCode] += len(tripDays(trip, now))
+		if home == "" || days[trip.CountryCode] > days[home] {
+			home = trip.CountryCode
+		}
+	}
+	return home
+}
+
+// tripDays returns the calendar days (UTC) a trip touches. Ongoing trips
+// last until now. A trip ending exactly at midnight does not touch the day
+// that starts then, but a trip always touches the day it started.
+func tripDays(trip *db.Trip, now time.Time) []time.Time {
+	end := now
+	if trip.EndedAt != nil {
+		end = *trip.EndedAt
+	}
+
+	days := []time.Time{truncateDay(trip.StartedAt)}
+	for day := days[0].AddDate(0, 0, 1); day.Before(end); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// truncateDay returns the start of t's calendar day in UTC
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// pageParams reads the cursor and limit query parameters (limit defaults to
+// 50, max 100). It writes an error response and returns false for an
+// invalid cursor or limit.
+func pageParams(c *gin.Context) (*db.Cursor, int, bool) {
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 1 || parsedLimit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return nil, 0, false
+		}
+		limit = parsedLimit
+	}
+
+	cursor, err := db.DecodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return nil, 0, false
+	}
+	return cursor, limit, true
+}
+
+// encodeCursor encodes the cursor of the next page, if any
+func encodeCursor(cursor *db.Cursor) *string {
+	if cursor == nil {
+		return nil
+	}
+	encoded := cursor.Encode()
+	return &encoded
+}
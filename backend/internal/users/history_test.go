@@ -0,0 +1,220 @@
+package users
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marko/backend/internal/db"
+)
+
+// at parses an RFC 3339 timestamp
+func at(t *testing.T, s string) time.Time {
+	t.Helper()
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatalf("time.Parse(%q) error = %v", s, err)
+	}
+	return ts
+}
+
+// trip returns a trip to country from start to end; an empty end leaves it ongoing
+func trip(t *testing.T, country, start, end string) *db.Trip {
+	t.Helper()
+	tr := &db.Trip{CountryCode: country, StartedAt: at(t, start)}
+	if end != "" {
+		ended := at(t, end)
+		tr.EndedAt = &ended
+	}
+	return tr
+}
+
+func TestTripDays(t *testing.T) {
+	now := "2024-03-10T12:00:00Z"
+	tests := []struct {
+		name       string
+		start, end string
+		want       int
+	}{
+		{name: "within a day", start: "2024-03-01T08:00:00Z", end: "2024-03-01T20:00:00Z", want: 1},
+		{name: "overnight", start: "2024-03-01T20:00:00Z", end: "2024-03-02T08:00:00Z", want: 2},
+		{name: "ends at midnight", start: "2024-03-01T08:00:00Z", end: "2024-03-03T00:00:00Z", want: 2},
+		{name: "ends just after midnight", start: "2024-03-01T08:00:00Z", end: "2024-03-03T00:00:01Z", want: 3},
+		{name: "starts and ends at midnight", start: "2024-03-01T00:00:00Z", end: "2024-03-01T00:00:00Z", want: 1},
+		{name: "starts at midnight", start: "2024-03-01T00:00:00Z", end: "2024-03-02T00:00:00Z", want: 1},
+		{name: "non-UTC offsets", start: "2024-03-01T23:30:00-05:00", end: "2024-03-02T01:00:00+02:00", want: 1},
+		{name: "ongoing", start: "2024-03-08T22:00:00Z", want: 3},
+		{name: "ongoing since today", start: "2024-03-10T01:00:00Z", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days := tripDays(trip(t, "FR", tt.start, tt.end), at(t, now))
+			if len(days) != tt.want {
+				t.Fatalf("tripDays() = %v, want %d days", days, tt.want)
+			}
+			for i, day := range days {
+				if day.Location() != time.UTC || day != truncateDay(day) {
+					t.Errorf("day %d = %v, want the start of a UTC day", i, day)
+				}
+			}
+		})
+	}
+}
+
+func TestTravelStats(t *testing.T) {
+	now := at(t, "2024-03-10T12:00:00Z")
+	tests := []struct {
+		name  string
+		trips []*db.Trip
+		home  string
+		want  *StatsResponse
+	}{
+		{
+			name:  "no trips",
+			trips: nil,
+			want:  &StatsResponse{Countries: []string{}, Years: []*YearStats{}},
+		},
+		{
+			name: "explicit home",
+			trips: []*db.Trip{
+				trip(t, "FR", "2023-06-01T10:00:00Z", "2023-06-03T10:00:00Z"),
+				trip(t, "US", "2023-06-03T10:00:00Z", "2023-06-20T10:00:00Z"),
+				trip(t, "IT", "2023-06-20T10:00:00Z", "2023-06-22T00:00:00Z"),
+			},
+			home: "US",
+			want: &StatsResponse{
+				Home:       strPtr("US"),
+				Countries:  []string{"FR", "IT"},
+				Trips:      2,
+				DaysAbroad: 5,
+				Years: []*YearStats{
+					{Year: 2023, Countries: []string{"FR", "IT"}, Trips: 2, DaysAbroad: 5},
+				},
+			},
+		},
+		{
+			name: "home defaults to the country with the most days",
+			trips: []*db.Trip{
+				trip(t, "US", "2023-01-01T10:00:00Z", "2023-05-01T10:00:00Z"),
+				trip(t, "MX", "2023-05-01T10:00:00Z", "2023-05-08T10:00:00Z"),
+				trip(t, "US", "2023-05-08T10:00:00Z", "2023-12-01T10:00:00Z"),
+				trip(t, "CA", "2023-12-01T10:00:00Z", "2023-12-02T10:00:00Z"),
+			},
+			want: &StatsResponse{
+				Home:       strPtr("US"),
+				Countries:  []string{"MX", "CA"},
+				Trips:      2,
+				DaysAbroad: 10,
+				Years: []*YearStats{
+					{Year: 2023, Countries: []string{"MX", "CA"}, Trips: 2, DaysAbroad: 10},
+				},
+			},
+		},
+		{
+			name: "trip spanning New Year counts towards both years",
+			trips: []*db.Trip{
+				trip(t, "DE", "2022-12-30T10:00:00Z", "2023-01-02T10:00:00Z"),
+			},
+			home: "US",
+			want: &StatsResponse{
+				Home:       strPtr("US"),
+				Countries:  []string{"DE"},
+				Trips:      1,
+				DaysAbroad: 4,
+				Years: []*YearStats{
+					{Year: 2022, Countries: []string{"DE"}, Trips: 1, DaysAbroad: 2},
+					{Year: 2023, Countries: []string{"DE"}, Trips: 0, DaysAbroad: 2},
+				},
+			},
+		},
+		{
+			name: "a day in two countries counts once",
+			trips: []*db.Trip{
+				trip(t, "FR", "2023-07-01T08:00:00Z", "2023-07-01T12:00:00Z"),
+				trip(t, "DE", "2023-07-01T12:00:00Z", "2023-07-02T12:00:00Z"),
+			},
+			home: "US",
+			want: &StatsResponse{
+				Home:       strPtr("US"),
+				Countries:  []string{"FR", "DE"},
+				Trips:      2,
+				DaysAbroad: 2,
+				Years: []*YearStats{
+					{Year: 2023, Countries: []string{"FR", "DE"}, Trips: 2, DaysAbroad: 2},
+				},
+			},
+		},
+		{
+			name: "ongoing trip lasts until now",
+			trips: []*db.Trip{
+				trip(t, "JP", "2024-03-08T22:00:00Z", ""),
+			},
+			home: "US",
+			want: &StatsResponse{
+				Home:       strPtr("US"),
+				Countries:  []string{"JP"},
+				Trips:      1,
+				DaysAbroad: 3,
+				Years: []*YearStats{
+					{Year: 2024, Countries: []string{"JP"}, Trips: 1, DaysAbroad: 3},
+				},
+			},
+		},
+		{
+			name: "repeat visits list a country once",
+			trips: []*db.Trip{
+				trip(t, "ES", "2023-04-01T10:00:00Z", "2023-04-02T10:00:00Z"),
+				trip(t, "ES", "2024-01-01T10:00:00Z", "2024-01-01T18:00:00Z"),
+			},
+			home: "GB",
+			want: &StatsResponse{
+				Home:       strPtr("GB"),
+				Countries:  []string{"ES"},
+				Trips:      2,
+				DaysAbroad: 3,
+				Years: []*YearStats{
+					{Year: 2023, Countries: []string{"ES"}, Trips: 1, DaysAbroad: 2},
+					{Year: 2024, Countries: []string{"ES"}, Trips: 1, DaysAbroad: 1},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := travelStats(tt.trips, tt.home, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("travelStats() = %s, want %s", statsString(got), statsString(tt.want))
+			}
+		})
+	}
+}
+
+func TestHomeCountryTie(t *testing.T) {
+	trips := []*db.Trip{
+		trip(t, "PT", "2023-01-01T10:00:00Z", "2023-01-02T10:00:00Z"),
+		trip(t, "ES", "2023-01-02T10:00:00Z", "2023-01-03T10:00:00Z"),
+	}
+	if got := homeCountry(trips, time.Now()); got != "PT" {
+		t.Errorf("homeCountry() = %q, want the earliest visited of the tied countries", got)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// statsString formats stats including the per-year entries behind the pointers
+func statsString(s *StatsResponse) string {
+	home := "<nil>"
+	if s.Home != nil {
+		home = *s.Home
+	}
+	years := make([]YearStats, len(s.Years))
+	for i, ys := range s.Years {
+		years[i] = *ys
+	}
+	return fmt.Sprintf("{Home:%s Countries:%v Trips:%d DaysAbroad:%d Years:%+v}", home, s.Countries, s.Trips, s.DaysAbroad, years)
+}
@@ -0,0 +1,180 @@
+package watchlists
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/marko/backend/internal/auth"
+	"github.com/marko/backend/internal/countries"
+	"github.com/marko/backend/internal/db"
+)
+
+// Handler handles HTTP requests for country watchlists
+type Handler struct {
+	db *db.DB
+}
+
+// NewHandler creates a new watchlists handler
+func NewHandler(database *db.DB) *Handler {
+	return &Handler{db: database}
+}
+
+// RegisterRoutes registers all watchlist-related routes. The global
+// watchlist lives under /me, group watchlists under their group.
+func (h *Handler) RegisterRoutes(router *gin.RouterGroup, authMiddleware gin.HandlerFunc) {
+	global := router.Group("/me/watchlist")
+	global.Use(authMiddleware)
+	{
+		global.GET("", h.GetWatchlist)
+		global.PUT("", h.SetWatchlist)
+		global.DELETE("", h.DeleteWatchlist)
+	}
+
+	group := router.Group("/groups/:id/watchlist")
+	group.Use(authMiddleware)
+	{
+		group.GET("", h.GetWatchlist)
+		group.PUT("", h.SetWatchlist)
+		group.DELETE("", h.DeleteWatchlist)
+	}
+}
+
+// WatchlistResponse represents a watchlist; it is null when the user is
+// notified about every country
+type WatchlistResponse struct {
+	Watchlist *db.CountryWatchlist `json:"watchlist"`
+}
+
+// GetWatchlist returns the user's global or group watchlist
+func (h *Handler) GetWatchlist(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, ok := h.scope(c, user.ID)
+	if !ok {
+		return
+	}
+
+	watchlist, err := h.db.GetCountryWatchlist(c.Request.Context(), user.ID, groupID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get country watchlist")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get watchlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, WatchlistResponse{Watchlist: watchlist})
+}
+
+// SetWatchlistRequest represents the request body for setting a watchlist
+type SetWatchlistRequest struct {
+	CountryCodes []string `json:"countryCodes" binding:"max=250"`
+	// SameCountry also watches whichever country the user is currently in
+	SameCountry bool `json:"sameCountry"`
+}
+
+// SetWatchlist creates or replaces the user's global or group watchlist
+func (h *Handler) SetWatchlist(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var req SetWatchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, invalid, ok := countries.NormalizeAll(req.CountryCodes)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown country code: " + invalid})
+		return
+	}
+	// An empty watchlist would silence the group; muting is the way to do that
+	if len(codes) == 0 && !req.SameCountry {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Watch at least one country or enable sameCountry"})
+		return
+	}
+
+	groupID, ok := h.scope(c, user.ID)
+	if !ok {
+		return
+	}
+
+	watchlist, err := h.db.SetCountryWatchlist(c.Request.Context(), user.ID, groupID, codes, req.SameCountry)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to set country watchlist")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set watchlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, WatchlistResponse{Watchlist: watchlist})
+}
+
+// DeleteWatchlist removes the user's global or group watchlist. Without a
+// group watchlist the global one applies again; without either the user is
+// notified about every country.
+func (h *Handler) DeleteWatchlist(c *gin.Context) {
+	user, err := auth.GetUserFromGin(c)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	groupID, ok := h.scope(c, user.ID)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.db.DeleteCountryWatchlist(c.Request.Context(), user.ID, groupID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete country watchlist")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete watchlist"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Watchlist not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Watchlist deleted"})
+}
+
+// scope returns the group a watchlist request is about, or nil for the
+// global watchlist. Group watchlists are only available to members. It
+// writes an error response and returns false on failure.
+func (h *Handler) scope(c *gin.Context, userID uuid.UUID) (*uuid.UUID, bool) {
+	param := c.Param("id")
+	if param == "" {
+		return nil, true
+	}
+
+	groupID, err := uuid.Parse(param)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group ID"})
+		return nil, false
+	}
+
+	isMember, err := h.db.IsGroupMember(c.Request.Context(), groupID, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check group membership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this group"})
+		return nil, false
+	}
+
+	return &groupID, true
+}
@@ -0,0 +1,18 @@
+-- Restore the single push token column from the most recently seen device
+ALTER TABLE users ADD COLUMN IF NOT EXISTS push_token TEXT;
+
+UPDATE users u
+SET push_token = d.push_token
+FROM (
+    SELECT DISTINCT ON (user_id) user_id, push_token
+    FROM devices
+    WHERE disabled_at IS NULL
+    ORDER BY user_id, last_seen_at DESC
+) d
+WHERE u.id = d.user_id;
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_devices_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS devices;
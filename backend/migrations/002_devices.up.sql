@@ -0,0 +1,23 @@
+-- Create devices table (a user can have many push tokens)
+CREATE TABLE IF NOT EXISTS devices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    push_token TEXT NOT NULL UNIQUE,
+    platform VARCHAR(16) NOT NULL CHECK (platform IN ('ios', 'android', 'web', 'unknown')),
+    app_version VARCHAR(32),
+    last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    disabled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Move existing single push tokens into devices
+INSERT INTO devices (user_id, push_token, platform)
+SELECT id, push_token, 'unknown'
+FROM users
+WHERE push_token IS NOT NULL AND push_token <> ''
+ON CONFLICT (push_token) DO NOTHING;
+
+ALTER TABLE users DROP COLUMN IF EXISTS push_token;
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices(user_id) WHERE disabled_at IS NULL;
@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_push_tickets_device_id;
+DROP INDEX IF EXISTS idx_push_tickets_notification_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS push_tickets;
@@ -0,0 +1,14 @@
+-- Create push_tickets table (one row per message handed to Expo)
+CREATE TABLE IF NOT EXISTS push_tickets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    notification_id UUID REFERENCES notifications(id) ON DELETE CASCADE,
+    device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    ticket_id TEXT,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('ok', 'error')),
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_push_tickets_notification_id ON push_tickets(notification_id);
+CREATE INDEX IF NOT EXISTS idx_push_tickets_device_id ON push_tickets(device_id);
@@ -0,0 +1,10 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_push_tickets_pending_receipts;
+
+-- Drop columns
+ALTER TABLE notifications DROP COLUMN IF EXISTS delivery_status;
+
+ALTER TABLE push_tickets
+    DROP COLUMN IF EXISTS receipt_checked_at,
+    DROP COLUMN IF EXISTS receipt_error,
+    DROP COLUMN IF EXISTS receipt_status;
@@ -0,0 +1,14 @@
+-- Track Expo push receipts per ticket
+ALTER TABLE push_tickets
+    ADD COLUMN IF NOT EXISTS receipt_status VARCHAR(10) CHECK (receipt_status IN ('ok', 'error', 'expired')),
+    ADD COLUMN IF NOT EXISTS receipt_error TEXT,
+    ADD COLUMN IF NOT EXISTS receipt_checked_at TIMESTAMP WITH TIME ZONE;
+
+-- Track delivery status per notification
+ALTER TABLE notifications
+    ADD COLUMN IF NOT EXISTS delivery_status VARCHAR(10) NOT NULL DEFAULT 'none'
+    CHECK (delivery_status IN ('none', 'pending', 'delivered', 'failed'));
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_push_tickets_pending_receipts ON push_tickets(created_at)
+    WHERE status = 'ok' AND receipt_status IS NULL;
@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_outbox_events_dead;
+DROP INDEX IF EXISTS idx_outbox_events_ready;
+
+-- Drop tables
+DROP TABLE IF EXISTS outbox_events;
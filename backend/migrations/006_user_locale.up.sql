@@ -0,0 +1,5 @@
+-- Add the locale used to render notifications for a user (BCP 47 tag)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(35) NOT NULL DEFAULT 'en';
+
+-- Normalize country codes written before codes were validated
+UPDATE user_locations SET country_code = UPPER(country_code) WHERE country_code <> UPPER(country_code);
@@ -0,0 +1,8 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_group_invites_group_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS group_invites;
+
+-- Drop columns
+ALTER TABLE groups DROP COLUMN IF EXISTS allow_id_join;
@@ -0,0 +1,18 @@
+-- Allow joining by group ID only for groups that opt in
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS allow_id_join BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create group_invites table
+CREATE TABLE IF NOT EXISTS group_invites (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    code VARCHAR(16) UNIQUE NOT NULL,
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    max_uses INTEGER CHECK (max_uses > 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_group_invites_group_id ON group_invites(group_id);
@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_group_members_owner;
+
+-- Drop columns
+ALTER TABLE group_members DROP COLUMN IF EXISTS role;
@@ -0,0 +1,23 @@
+-- Add member roles
+ALTER TABLE group_members ADD COLUMN IF NOT EXISTS role VARCHAR(10) NOT NULL DEFAULT 'member'
+    CHECK (role IN ('owner', 'admin', 'member'));
+
+-- The creator owns each existing group
+UPDATE group_members gm
+SET role = 'owner'
+FROM groups g
+WHERE gm.group_id = g.id AND gm.user_id = g.created_by;
+
+-- Groups whose creator has left are owned by their longest-standing member
+UPDATE group_members gm
+SET role = 'owner'
+FROM (
+    SELECT DISTINCT ON (group_id) id
+    FROM group_members
+    WHERE group_id NOT IN (SELECT group_id FROM group_members WHERE role = 'owner')
+    ORDER BY group_id, created_at, id
+) first_member
+WHERE gm.id = first_member.id;
+
+-- A group has at most one owner
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_members_owner ON group_members(group_id) WHERE role = 'owner';
@@ -0,0 +1,11 @@
+-- Restore cascading deletes; notifications of deleted groups are dropped
+DELETE FROM notifications WHERE group_id IS NULL;
+
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS notifications_group_id_fkey;
+ALTER TABLE notifications ADD CONSTRAINT notifications_group_id_fkey
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE;
+ALTER TABLE notifications ALTER COLUMN group_id SET NOT NULL;
+
+-- Drop columns
+ALTER TABLE notifications DROP COLUMN IF EXISTS title;
+ALTER TABLE notifications DROP COLUMN IF EXISTS type;
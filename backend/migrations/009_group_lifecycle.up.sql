@@ -0,0 +1,14 @@
+-- Notifications carry their own type and title (the group name at the time),
+-- so they outlive renames and deletion of their group
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS type VARCHAR(32) NOT NULL DEFAULT 'location_update';
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS title VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE notifications n
+SET title = g.name
+FROM groups g
+WHERE n.group_id = g.id;
+
+ALTER TABLE notifications ALTER COLUMN group_id DROP NOT NULL;
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS notifications_group_id_fkey;
+ALTER TABLE notifications ADD CONSTRAINT notifications_group_id_fkey
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE SET NULL;
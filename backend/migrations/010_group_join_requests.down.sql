@@ -0,0 +1,8 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_group_join_requests_pending;
+
+-- Drop tables
+DROP TABLE IF EXISTS group_join_requests;
+
+-- Drop columns
+ALTER TABLE groups DROP COLUMN IF EXISTS allow_join_requests;
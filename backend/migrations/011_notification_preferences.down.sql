@@ -0,0 +1,9 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_notifications_digest_pending;
+
+-- Drop columns
+ALTER TABLE notifications DROP COLUMN IF EXISTS digested_at;
+ALTER TABLE notifications DROP COLUMN IF EXISTS delivery;
+ALTER TABLE group_members DROP COLUMN IF EXISTS delivery;
+ALTER TABLE group_members DROP COLUMN IF EXISTS notify_on;
+ALTER TABLE group_members DROP COLUMN IF EXISTS muted_until;
@@ -0,0 +1,15 @@
+-- Add per-membership notification preferences
+ALTER TABLE group_members ADD COLUMN IF NOT EXISTS muted_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE group_members ADD COLUMN IF NOT EXISTS notify_on VARCHAR(10) NOT NULL DEFAULT 'all'
+    CHECK (notify_on IN ('all', 'arrivals', 'departures'));
+ALTER TABLE group_members ADD COLUMN IF NOT EXISTS delivery VARCHAR(10) NOT NULL DEFAULT 'instant'
+    CHECK (delivery IN ('instant', 'digest'));
+
+-- Digest notifications are pushed in periodic batches instead of one by one
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS delivery VARCHAR(10) NOT NULL DEFAULT 'instant'
+    CHECK (delivery IN ('instant', 'digest'));
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS digested_at TIMESTAMP WITH TIME ZONE;
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_notifications_digest_pending ON notifications(user_id)
+    WHERE delivery = 'digest' AND digested_at IS NULL;
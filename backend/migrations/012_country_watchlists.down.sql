@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_country_watchlists_user_group;
+DROP INDEX IF EXISTS idx_country_watchlists_user_global;
+
+-- Drop tables
+DROP TABLE IF EXISTS country_watchlists;
@@ -0,0 +1,18 @@
+-- Create country_watchlists table
+-- A watchlist with a NULL group_id applies to all of the user's groups; a
+-- group watchlist replaces it for that group. Users without a watchlist are
+-- notified about every country.
+CREATE TABLE IF NOT EXISTS country_watchlists (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    group_id UUID REFERENCES groups(id) ON DELETE CASCADE,
+    country_codes VARCHAR(2)[] NOT NULL DEFAULT '{}',
+    same_country BOOLEAN NOT NULL DEFAULT false,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE UNIQUE INDEX IF NOT EXISTS idx_country_watchlists_user_global ON country_watchlists(user_id)
+    WHERE group_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_country_watchlists_user_group ON country_watchlists(user_id, group_id)
+    WHERE group_id IS NOT NULL;
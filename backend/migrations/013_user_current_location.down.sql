@@ -0,0 +1,5 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_user_current_location_country;
+
+-- Drop tables
+DROP TABLE IF EXISTS user_current_location;
@@ -0,0 +1,22 @@
+-- Create user_current_location table
+-- Holds each user's latest user_locations row so current country lookups
+-- don't have to scan the history. Maintained in the same transaction as
+-- every insert into user_locations.
+CREATE TABLE IF NOT EXISTS user_current_location (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES user_locations(id) ON DELETE CASCADE,
+    country_code VARCHAR(2) NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('arrived', 'left')),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Backfill from the location history
+INSERT INTO user_current_location (user_id, location_id, country_code, status, updated_at)
+SELECT DISTINCT ON (user_id) user_id, id, country_code, status, updated_at
+FROM user_locations
+ORDER BY user_id, updated_at DESC
+ON CONFLICT (user_id) DO NOTHING;
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_user_current_location_country ON user_current_location(country_code)
+    WHERE status = 'arrived';
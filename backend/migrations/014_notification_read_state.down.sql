@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_notifications_unread;
+DROP INDEX IF EXISTS idx_notifications_user_created;
+
+-- Drop columns
+ALTER TABLE notifications DROP COLUMN IF EXISTS read_at;
@@ -0,0 +1,13 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_notifications_location_event_user;
+DROP INDEX IF EXISTS idx_notification_groups_group_id;
+DROP INDEX IF EXISTS idx_location_events_user_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS notification_groups;
+
+-- Drop columns
+ALTER TABLE notifications DROP COLUMN IF EXISTS location_event_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS location_events;
@@ -0,0 +1,32 @@
+-- Create location_events table
+-- One row per fanned out location update; its notifications reference it
+CREATE TABLE IF NOT EXISTS location_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL UNIQUE REFERENCES user_locations(id) ON DELETE CASCADE,
+    country_code VARCHAR(2) NOT NULL,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('arrived', 'left')),
+    from_country_code VARCHAR(2),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS location_event_id UUID REFERENCES location_events(id) ON DELETE SET NULL;
+
+-- Create notification_groups table
+-- Every group a notification is about; notifications.group_id is the first
+CREATE TABLE IF NOT EXISTS notification_groups (
+    notification_id UUID NOT NULL REFERENCES notifications(id) ON DELETE CASCADE,
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    PRIMARY KEY (notification_id, group_id)
+);
+
+INSERT INTO notification_groups (notification_id, group_id)
+SELECT id, group_id FROM notifications WHERE group_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_location_events_user_id ON location_events(user_id);
+CREATE INDEX IF NOT EXISTS idx_notification_groups_group_id ON notification_groups(group_id);
+-- One notification per recipient per location event
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_location_event_user ON notifications(location_event_id, user_id)
+    WHERE location_event_id IS NOT NULL;
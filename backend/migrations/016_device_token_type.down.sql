@@ -0,0 +1,2 @@
+-- Drop columns
+ALTER TABLE devices DROP COLUMN IF EXISTS token_type;
@@ -0,0 +1,4 @@
+-- Record which push service issued each device token
+ALTER TABLE devices
+    ADD COLUMN IF NOT EXISTS token_type VARCHAR(8) NOT NULL DEFAULT 'expo'
+    CHECK (token_type IN ('expo', 'fcm', 'apns'));
@@ -0,0 +1,8 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_group_webhooks_group_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS group_webhooks;
+
+-- Drop columns
+ALTER TABLE group_members DROP COLUMN IF EXISTS email_notifications;
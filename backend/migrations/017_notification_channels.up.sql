@@ -0,0 +1,18 @@
+-- Let members also receive a group's notifications by email
+ALTER TABLE group_members ADD COLUMN IF NOT EXISTS email_notifications BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create group_webhooks table
+-- Outbound HTTP endpoints a group's location updates are posted to
+CREATE TABLE IF NOT EXISTS group_webhooks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    notify_on VARCHAR(10) NOT NULL DEFAULT 'all'
+        CHECK (notify_on IN ('all', 'arrivals', 'departures')),
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_group_webhooks_group_id ON group_webhooks(group_id);
@@ -0,0 +1,3 @@
+-- Restore NOT NULL, using the user ID as a unique placeholder for missing emails
+UPDATE users SET email = id::text WHERE email IS NULL;
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
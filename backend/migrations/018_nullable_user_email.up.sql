@@ -0,0 +1,3 @@
+-- Users signed in anonymously or by phone have no email
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
+UPDATE users SET email = NULL WHERE email = '';
@@ -0,0 +1,4 @@
+-- Restore the created_at index
+DROP INDEX IF EXISTS idx_push_tickets_pending_receipts;
+CREATE INDEX IF NOT EXISTS idx_push_tickets_pending_receipts ON push_tickets(created_at)
+    WHERE status = 'ok' AND receipt_status IS NULL;
@@ -0,0 +1,4 @@
+-- Poll pending receipts least recently checked first
+DROP INDEX IF EXISTS idx_push_tickets_pending_receipts;
+CREATE INDEX IF NOT EXISTS idx_push_tickets_pending_receipts ON push_tickets(receipt_checked_at NULLS FIRST, created_at)
+    WHERE status = 'ok' AND receipt_status IS NULL;
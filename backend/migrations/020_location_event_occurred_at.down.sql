@@ -0,0 +1,6 @@
+-- Drop indexes
+DROP INDEX IF EXISTS idx_user_locations_user_updated_at;
+DROP INDEX IF EXISTS idx_location_events_user_occurred_at;
+
+-- Drop columns
+ALTER TABLE location_events DROP COLUMN IF EXISTS occurred_at;
@@ -0,0 +1,14 @@
+-- Record when each announced update happened, so fan-out can compare new
+-- updates against the last state members were told about
+ALTER TABLE location_events ADD COLUMN IF NOT EXISTS occurred_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE location_events e
+SET occurred_at = l.updated_at
+FROM user_locations l
+WHERE l.id = e.location_id AND e.occurred_at IS NULL;
+
+ALTER TABLE location_events ALTER COLUMN occurred_at SET NOT NULL;
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_location_events_user_occurred_at ON location_events(user_id, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_user_locations_user_updated_at ON user_locations(user_id, updated_at);
@@ -0,0 +1,10 @@
+-- One ticket per notification and device, so a retried delivery skips the
+-- devices that were already pushed to
+DELETE FROM push_tickets a
+USING push_tickets b
+WHERE a.notification_id = b.notification_id
+  AND a.device_id = b.device_id
+  AND (a.created_at, a.id) > (b.created_at, b.id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_push_tickets_notification_device ON push_tickets(notification_id, device_id)
+    WHERE notification_id IS NOT NULL;
@@ -0,0 +1,3 @@
+-- Find processed events that are due for purging
+CREATE INDEX IF NOT EXISTS idx_outbox_events_done ON outbox_events(processed_at)
+    WHERE status = 'done';
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_group_join_requests_rejected;
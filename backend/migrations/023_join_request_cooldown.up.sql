@@ -0,0 +1,3 @@
+-- Find a user's latest rejected request to a group
+CREATE INDEX IF NOT EXISTS idx_group_join_requests_rejected ON group_join_requests(group_id, user_id, decided_at DESC)
+    WHERE status = 'rejected';
@@ -3,13 +3,13 @@ import { View, ScrollView } from 'react-native';
 import { Text, TextInput } from 'react-native-paper';
 import Button from '../../components/Button';
 import GroupCard from '../../components/GroupCard';
-import { useGroups, createGroup, joinGroup } from '../../lib/api';
+import { useGroups, createGroup, acceptInvite } from '../../lib/api';
 import { useRouter } from 'expo-router';
 
 export default function Groups() {
   const { groups, isLoading, mutate } = useGroups();
   const [name, setName] = useState('');
-  const [joinId, setJoinId] = useState('');
+  const [inviteCode, setInviteCode] = useState('');
   const router = useRouter();
 
   const onCreate = async () => {
@@ -20,9 +20,9 @@ export default function Groups() {
   };
 
   const onJoin = async () => {
-    if (!joinId.trim()) return;
-    await joinGroup(joinId.trim());
-    setJoinId('');
+    if (!inviteCode.trim()) return;
+    await acceptInvite(inviteCode.trim());
+    setInviteCode('');
     mutate();
   };
 
@@ -34,7 +34,7 @@ export default function Groups() {
         <Button onPress={onCreate}>Create</Button>
       </View>
       <View style={{ marginTop: 16, gap: 8 }}>
-        <TextInput label="Join group by ID" value={joinId} onChangeText={setJoinId} />
+        <TextInput label="Invite code" value={inviteCode} onChangeText={setInviteCode} autoCapitalize="characters" />
         <Button onPress={onJoin}>Join</Button>
       </View>
       <View style={{ marginTop: 24 }}>
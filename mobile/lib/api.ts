@@ -32,8 +32,8 @@ export const swrConfig: SWRConfiguration = {
 
 // API helpers
 export type Group = { id: string; name: string; createdAt?: string };
-export type Notification = { id: string; message: string; createdAt: string };
-export type Member = { id: string; name?: string; joinedAt?: string };
+export type Notification = { id: string; type?: string; title?: string; message: string; createdAt: string };
+export type Member = { id: string; name?: string; role?: 'owner' | 'admin' | 'member'; joinedAt?: string };
 
 export async function createGroup(name: string) {
   const res = await axiosInstance.post('/api/v1/groups', { name });
@@ -45,11 +45,31 @@ export async function joinGroup(groupId: string) {
   return res.data as { success: boolean };
 }
 
-export async function postLocationUpdate(payload: { countryCode: string; status: 'arrived' | 'left' }) {
+export async function acceptInvite(code: string) {
+  const res = await axiosInstance.post(`/api/v1/invites/${encodeURIComponent(code)}/accept`);
+  return res.data as { group: Group; message: string };
+}
+
+export async function postLocationUpdate(payload: {
+  countryCode?: string;
+  latitude?: number;
+  longitude?: number;
+  status: 'arrived' | 'left';
+}) {
   const res = await axiosInstance.post('/api/v1/locations', payload);
   return res.data;
 }
 
+export async function registerDevice(payload: { token: string; platform: 'ios' | 'android' | 'web'; appVersion?: string }) {
+  const res = await axiosInstance.post('/api/v1/devices', payload);
+  return res.data;
+}
+
+export async function unregisterDevice(token: string) {
+  const res = await axiosInstance.delete('/api/v1/devices', { data: { token } });
+  return res.data;
+}
+
 // SWR hooks
 export function useHealth() {
   const { data, error, isLoading } = useSWR('/healthz');
@@ -11,13 +11,13 @@ export async function updateCurrentCountry(status: 'arrived' | 'left') {
   if (!hasPerm) throw new Error('Location permission not granted');
 
   const pos = await Location.getCurrentPositionAsync({});
-  const geocode = await Location.reverseGeocodeAsync({
-    latitude: pos.coords.latitude,
-    longitude: pos.coords.longitude,
-  });
-  const entry = geocode[0];
-  const countryCode = (entry?.isoCountryCode || entry?.country || '').toUpperCase();
-  if (!countryCode) throw new Error('Unable to determine country');
+  const { latitude, longitude } = pos.coords;
 
-  return postLocationUpdate({ countryCode, status });
-}
\ No newline at end of file
+  // The backend resolves the country from coordinates; the on-device result
+  // is only a fallback for points it cannot place (e.g. just off the coast)
+  const geocode = await Location.reverseGeocodeAsync({ latitude, longitude }).catch(() => []);
+  const isoCode = geocode[0]?.isoCountryCode?.toUpperCase();
+  const countryCode = isoCode && isoCode.length === 2 ? isoCode : undefined;
+
+  return postLocationUpdate({ countryCode, latitude, longitude, status });
+}
@@ -1,5 +1,6 @@
 import * as Notifications from 'expo-notifications';
 import { Platform } from 'react-native';
+import { registerDevice } from './api';
 
 export async function registerForPushNotificationsAsync() {
   let token: string | undefined;
@@ -26,7 +27,5 @@ export async function registerForPushNotificationsAsync() {
 }
 
 export async function sendPushTokenToBackend(token: string) {
-  // Placeholder: backend endpoint not defined in spec.
-  // Implement when backend exposes token registration endpoint.
-  console.log('Expo push token:', token);
-}
\ No newline at end of file
+  await registerDevice({ token, platform: Platform.OS === 'android' ? 'android' : Platform.OS === 'web' ? 'web' : 'ios' });
+}